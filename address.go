@@ -0,0 +1,228 @@
+package mailfile
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// ParseAddressList 宽松解析地址列表 (RFC 5322 3.4)，返回解析出的地址和无法解析的剩余部分（以 ", " 连接）。
+// 除标准语法外，兼容实际邮件中常见的写法：
+//   - 地址组 "undisclosed-recipients:;"、"team: a@x, b@y;"；
+//   - 注释 "a@x (John Doe)"，显示名缺失时用注释作为显示名；
+//   - 过时的路由地址 "<@relay.example:a@x>"；
+//   - 未加引号的 8 位显示名、引号内的逗号、RFC 2047 编码的显示名；
+//   - 缺少尖括号 "John Doe a@x"、以 ";" 或不带空格的 "," 分隔。
+func ParseAddressList(list string) ([]*mail.Address, string) {
+	var (
+		addrs []*mail.Address
+		rest  []string
+	)
+	for _, entry := range splitAddressList(unfold(list)) {
+		if addr, ok := parseAddress(entry); ok {
+			addrs = append(addrs, addr)
+		} else if len(entry) > 0 {
+			rest = append(rest, entry)
+		}
+	}
+	return addrs, strings.Join(rest, ", ")
+}
+
+// ParseAddress 宽松解析单个地址，见 ParseAddressList
+func ParseAddress(address string) (*mail.Address, bool) {
+	addrs, _ := ParseAddressList(address)
+	if len(addrs) == 0 {
+		return nil, false
+	}
+	return addrs[0], true
+}
+
+// splitAddressList 在引号、注释和尖括号之外按 "," ";" 拆分地址，并去掉地址组的组名
+func splitAddressList(list string) []string {
+	var (
+		entries = make([]string, 0)
+		entry   strings.Builder
+		quoted  bool
+		depth   int // 注释嵌套层数
+		angle   bool
+	)
+	for i := 0; i < len(list); i++ {
+		c := list[i]
+		switch {
+		case c == '\\' && (quoted || depth > 0) && i+1 < len(list):
+			entry.WriteByte(c)
+			i++
+			c = list[i]
+		case quoted:
+			quoted = c != '"'
+		case depth > 0:
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				depth--
+			}
+		case angle:
+			angle = c != '>'
+		case c == '"':
+			quoted = true
+		case c == '(':
+			depth++
+		case c == '<':
+			angle = true
+		case c == '=' && strings.HasPrefix(list[i:], "=?"):
+			// encoded-word 中不规范的 "," 不是分隔符，如 =?utf-8?Q?Doe,_John?=
+			if loc := expEncodedWord.FindStringIndex(list[i:]); loc != nil && loc[0] == 0 {
+				entry.WriteString(list[i : i+loc[1]])
+				i += loc[1] - 1
+				continue
+			}
+		case c == ',', c == ';':
+			entries = append(entries, strings.TrimSpace(entry.String()))
+			entry.Reset()
+			continue
+		case c == ':':
+			// 地址组 "display-name:"，组名不是地址
+			entry.Reset()
+			continue
+		}
+		entry.WriteByte(c)
+	}
+	return append(entries, strings.TrimSpace(entry.String()))
+}
+
+// parseAddress 解析单个地址: [display-name] <addr-spec>、addr-spec [(comment)] 或 display-name addr-spec
+func parseAddress(entry string) (*mail.Address, bool) {
+	var (
+		display  strings.Builder
+		comment  strings.Builder
+		inner    strings.Builder
+		quoted   bool
+		depth    int
+		angle    bool
+		hasAngle bool
+	)
+	for i := 0; i < len(entry); i++ {
+		c := entry[i]
+		switch {
+		case c == '\\' && (quoted || depth > 0) && i+1 < len(entry):
+			i++
+			c = entry[i]
+			if depth > 0 {
+				comment.WriteByte(c)
+				continue
+			}
+		case depth > 0:
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				if depth--; depth == 0 {
+					comment.WriteByte(' ')
+					continue
+				}
+			}
+			comment.WriteByte(c)
+			continue
+		case quoted:
+			if c == '"' {
+				quoted = false
+				continue
+			}
+		case c == '"':
+			quoted = true
+			continue
+		case angle:
+			if c == '>' {
+				angle = false
+				continue
+			}
+		case c == '(':
+			depth++
+			continue
+		case c == '<' && !hasAngle:
+			angle, hasAngle = true, true
+			continue
+		}
+
+		if angle {
+			inner.WriteByte(c)
+		} else {
+			display.WriteByte(c)
+		}
+	}
+
+	var address, name string
+	if hasAngle {
+		address, name = inner.String(), display.String()
+		if idx := strings.LastIndexByte(address, ':'); idx >= 0 && strings.HasPrefix(strings.TrimSpace(address), "@") {
+			address = address[idx+1:] // 过时的路由地址 <@a,@b:user@domain>
+		}
+	} else {
+		words := strings.Fields(display.String())
+		for i := len(words) - 1; i >= 0; i-- {
+			if strings.Contains(words[i], "@") {
+				address = words[i]
+				name = strings.Join(append(words[:i:i], words[i+1:]...), " ")
+				break
+			}
+		}
+	}
+
+	address = strings.Trim(strings.TrimSpace(address), "'<>.")
+	if !validAddress(address) {
+		return nil, false
+	}
+
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		name = strings.TrimSpace(comment.String())
+	}
+	if len(name) > 1 && name[0] == '\'' && name[len(name)-1] == '\'' {
+		name = strings.TrimSpace(name[1 : len(name)-1])
+	}
+	return &mail.Address{Name: DecodeHeader(name).Value, Address: address}, true
+}
+
+// validAddress 检查 addr-spec 的基本结构: local@domain，不含空白
+func validAddress(address string) bool {
+	idx := strings.LastIndexByte(address, '@')
+	if idx <= 0 || idx == len(address)-1 {
+		return false
+	}
+	return !strings.ContainsAny(address, " \t\r\n<>,;")
+}
+
+// 重发字段 (RFC 5322 3.6.6)，每次重发在邮件头顶部插入一组
+var resentFields = []string{
+	"Resent-Date", "Resent-Message-Id", "Resent-Sender", "Resent-From", "Resent-To", "Resent-Cc", "Resent-Bcc",
+}
+
+// ParseResent 按出现顺序解析重发字段，最近一次重发在前。
+// 头部以 map 保存时各组字段的对应关系只能按序号还原。
+func ParseResent(headers mail.Header) []Resent {
+	count := 0
+	for _, key := range resentFields {
+		if n := len(headers[key]); n > count {
+			count = n
+		}
+	}
+
+	var resents []Resent
+	for i := 0; i < count; i++ {
+		value := func(key string) string {
+			if values := headers[key]; i < len(values) {
+				return values[i]
+			}
+			return ""
+		}
+
+		var resent Resent
+		resent.Date = value("Resent-Date")
+		resent.MessageID = value("Resent-Message-Id")
+		resent.Sender, _ = ParseAddress(value("Resent-Sender"))
+		resent.From, _ = ParseAddressList(value("Resent-From"))
+		resent.To, _ = ParseAddressList(value("Resent-To"))
+		resent.Cc, _ = ParseAddressList(value("Resent-Cc"))
+		resent.Bcc, _ = ParseAddressList(value("Resent-Bcc"))
+		resents = append(resents, resent)
+	}
+	return resents
+}
@@ -0,0 +1,106 @@
+// Package analyze reports findings over a normalized message for phishing
+// triage: header spoofing and anomalies, lookalike domains, Unicode tricks in
+// subjects, names and filenames, and the client a message was sent with, each
+// with a code, a severity and the evidence that raised it.
+package analyze
+
+import (
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/mel2oo/mailfile"
+	"github.com/mel2oo/mailfile/dmarc"
+)
+
+// Severity is how suspicious a finding is.
+type Severity string
+
+const (
+	Info   Severity = "info"
+	Low    Severity = "low"
+	Medium Severity = "medium"
+	High   Severity = "high"
+)
+
+// Finding is a concrete observation about a message.
+type Finding struct {
+	// Code identifies the kind of finding, such as CodeReplyToMismatch.
+	Code     string   `json:"code"`
+	Severity Severity `json:"severity"`
+	// Message describes the finding for a reader.
+	Message string `json:"message"`
+	// Evidence are the values that raised it, by name, such as
+	// "from" and "reply-to".
+	Evidence map[string]string `json:"evidence"`
+}
+
+// Options configures the analysis.
+type Options struct {
+	// MaxDateSkew is how far the Date field may be from the first Received
+	// timestamp, DefaultMaxDateSkew if zero.
+	MaxDateSkew time.Duration
+	// Suffixes finds organizational domains, dmarc.PublicSuffixes if nil.
+	Suffixes *dmarc.SuffixList
+	// Protected are the domains lookalikes are looked for, such as
+	// "paypal.com", and Brands the names, such as "PayPal".
+	Protected []string
+	Brands    []string
+}
+
+// DefaultMaxDateSkew ...
+const DefaultMaxDateSkew = 24 * time.Hour
+
+// Message runs every analysis over a message and returns the findings.
+func Message(msg *mailfile.Message, opts *Options) []Finding {
+	findings := Headers(msg, opts)
+	findings = append(findings, lookalikeFindings(Lookalikes(msg, opts))...)
+	findings = append(findings, inspectionFindings(Inspections(msg))...)
+	findings = append(findings, fingerprintFindings(Fingerprints(msg))...)
+	return findings
+}
+
+// options returns opts with the defaults filled in.
+func options(opts *Options) *Options {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxDateSkew == 0 {
+		o.MaxDateSkew = DefaultMaxDateSkew
+	}
+	if o.Suffixes == nil {
+		o.Suffixes = dmarc.PublicSuffixes
+	}
+	return &o
+}
+
+// headerValues returns the values of a field, whatever the case of its name
+// in h.
+func headerValues(h mail.Header, name string) []string {
+	var values []string
+	for key, v := range h {
+		if strings.EqualFold(key, name) {
+			values = append(values, v...)
+		}
+	}
+	return values
+}
+
+// domainOf returns the lower case domain of an address.
+func domainOf(address string) string {
+	address = strings.Trim(strings.TrimSpace(address), "<>")
+	if i := strings.LastIndexByte(address, '@'); i >= 0 {
+		return strings.ToLower(strings.TrimSuffix(address[i+1:], "."))
+	}
+	return ""
+}
+
+// orgDomain returns the organizational domain of a domain, or the domain
+// itself if it is a public suffix.
+func (o *Options) orgDomain(domain string) string {
+	if org := o.Suffixes.OrganizationalDomain(domain); len(org) > 0 {
+		return org
+	}
+	return domain
+}
@@ -0,0 +1,228 @@
+package analyze
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// confusables maps characters that look like Latin letters or digits to them,
+// a subset of the Unicode confusables (UTS #39) covering the scripts seen in
+// homograph attacks.
+var confusables = map[rune]string{
+	// Cyrillic
+	'а': "a", 'в': "b", 'е': "e", 'ё': "e", 'к': "k", 'м': "m", 'н': "h", 'о': "o",
+	'р': "p", 'с': "c", 'т': "t", 'у': "y", 'х': "x", 'ѕ': "s", 'і': "i", 'ї': "i",
+	'ј': "j", 'ԁ': "d", 'ԛ': "q", 'ԝ': "w", 'һ': "h", 'ӏ': "l", 'ɡ': "g", 'ь': "b",
+	'А': "a", 'В': "b", 'Е': "e", 'К': "k", 'М': "m", 'Н': "h", 'О': "o", 'Р': "p",
+	'С': "c", 'Т': "t", 'У': "y", 'Х': "x", 'Ѕ': "s", 'І': "l", 'Ј': "j", 'Ԛ': "q",
+	'Ԝ': "w", 'Ӏ': "l",
+	// Greek
+	'α': "a", 'β': "b", 'ε': "e", 'ι': "i", 'κ': "k", 'ν': "v", 'ο': "o", 'ρ': "p",
+	'τ': "t", 'υ': "u", 'χ': "x", 'ω': "w", 'Α': "a", 'Β': "b", 'Ε': "e", 'Ζ': "z",
+	'Η': "h", 'Ι': "l", 'Κ': "k", 'Μ': "m", 'Ν': "n", 'Ο': "o", 'Ρ': "p", 'Τ': "t",
+	'Υ': "y", 'Χ': "x",
+	// Armenian, Cherokee and Latin lookalikes
+	'օ': "o", 'ս': "u", 'ց': "g", 'հ': "h", 'ո': "n", 'Ꭺ': "a", 'Ꮯ': "c", 'Ꭼ': "e",
+	'ı': "i", 'ȷ': "j", 'ł': "l", 'ƚ': "l", 'ɑ': "a", 'ɩ': "i", 'ʟ': "l", 'ℓ': "l",
+	// digits and symbols
+	'0': "o", '1': "l", '|': "l",
+}
+
+// asciiConfusables are letter sequences that look like another letter.
+var asciiConfusables = strings.NewReplacer("rn", "m", "vv", "w", "cl", "d")
+
+// Skeleton returns the form of s that strings looking alike share: compatibility
+// decomposed without marks, lower case, with confusable characters replaced
+// by the Latin letters they imitate, as of UTS #39. "pаypal" in Cyrillic,
+// "PAYPAL", "paypa1" and "pаypаl" all have the skeleton "paypal".
+func Skeleton(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r) || isInvisible(r):
+			continue
+		case len(confusables[r]) > 0:
+			b.WriteString(confusables[r])
+		default:
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return asciiConfusables.Replace(b.String())
+}
+
+// scripts are the scripts mixed-script detection tells apart.
+var scripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Greek", unicode.Greek},
+	{"Armenian", unicode.Armenian},
+	{"Cherokee", unicode.Cherokee},
+	{"Han", unicode.Han},
+	{"Hiragana", unicode.Hiragana},
+	{"Katakana", unicode.Katakana},
+	{"Hangul", unicode.Hangul},
+	{"Arabic", unicode.Arabic},
+	{"Hebrew", unicode.Hebrew},
+	{"Thai", unicode.Thai},
+}
+
+// scriptOf returns the script of a letter, empty for other characters and
+// scripts that are not told apart.
+func scriptOf(r rune) string {
+	if !unicode.IsLetter(r) {
+		return ""
+	}
+	for _, s := range scripts {
+		if unicode.Is(s.table, r) {
+			return s.name
+		}
+	}
+	return ""
+}
+
+// mixedScripts returns the scripts of the letters of s, in order of first
+// use, if there is more than one. Han, Hiragana, Katakana and Hangul are
+// allowed together and with Latin, as Chinese, Japanese and Korean text mix
+// them (UTS #39, highly restrictive).
+func mixedScripts(s string) []string {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, r := range s {
+		if name := scriptOf(r); len(name) > 0 && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if len(names) < 2 {
+		return nil
+	}
+	cjk, latin := 0, 0
+	for _, name := range names {
+		switch name {
+		case "Han", "Hiragana", "Katakana", "Hangul":
+			cjk++
+		case "Latin":
+			latin++
+		}
+	}
+	if cjk > 0 && cjk+latin == len(names) {
+		return nil
+	}
+	return names
+}
+
+// isInvisible reports whether r renders as nothing: format characters such
+// as zero-width spaces and joiners, and invisible operators.
+func isInvisible(r rune) bool {
+	return unicode.Is(unicode.Cf, r) || r == '\u3164' || r == '\uffa0' || r == '\u115f' || r == '\u1160'
+}
+
+// errPunycode is the error of an invalid punycode label.
+var errPunycode = errors.New("analyze: invalid punycode")
+
+// toUnicode returns a domain with its punycode ("xn--") labels decoded, and
+// whether any was.
+func toUnicode(domain string) (string, bool) {
+	labels := strings.Split(domain, ".")
+	decoded := false
+	for i, label := range labels {
+		if !strings.HasPrefix(strings.ToLower(label), "xn--") {
+			continue
+		}
+		if u, err := decodePunycode(label[4:]); err == nil {
+			labels[i], decoded = u, true
+		}
+	}
+	return strings.Join(labels, "."), decoded
+}
+
+// decodePunycode decodes a punycode label without its "xn--" prefix
+// (RFC 3492).
+func decodePunycode(s string) (string, error) {
+	const (
+		base        = 36
+		tmin        = 1
+		tmax        = 26
+		skew        = 38
+		damp        = 700
+		initialBias = 72
+		initialN    = 128
+	)
+	output := make([]rune, 0, len(s))
+	if i := strings.LastIndexByte(s, '-'); i >= 0 {
+		for _, r := range s[:i] {
+			if r >= 0x80 {
+				return "", errPunycode
+			}
+			output = append(output, r)
+		}
+		s = s[i+1:]
+	}
+
+	adapt := func(delta, points int, first bool) int {
+		if first {
+			delta /= damp
+		} else {
+			delta /= 2
+		}
+		delta += delta / points
+		k := 0
+		for delta > ((base-tmin)*tmax)/2 {
+			delta /= base - tmin
+			k += base
+		}
+		return k + (base-tmin+1)*delta/(delta+skew)
+	}
+
+	n, bias, i := initialN, initialBias, 0
+	for pos := 0; pos < len(s); {
+		oldi, w := i, 1
+		for k := base; ; k += base {
+			if pos == len(s) {
+				return "", errPunycode
+			}
+			c := s[pos]
+			pos++
+			var digit int
+			switch {
+			case c >= 'a' && c <= 'z':
+				digit = int(c - 'a')
+			case c >= 'A' && c <= 'Z':
+				digit = int(c - 'A')
+			case c >= '0' && c <= '9':
+				digit = int(c-'0') + 26
+			default:
+				return "", errPunycode
+			}
+			i += digit * w
+			t := k - bias
+			if t < tmin {
+				t = tmin
+			} else if t > tmax {
+				t = tmax
+			}
+			if digit < t {
+				break
+			}
+			w *= base - t
+			if w > 1<<24 || i > 1<<24 {
+				return "", errPunycode
+			}
+		}
+		bias = adapt(i-oldi, len(output)+1, oldi == 0)
+		n += i / (len(output) + 1)
+		i %= len(output) + 1
+		if n > unicode.MaxRune {
+			return "", errPunycode
+		}
+		output = append(output[:i], append([]rune{rune(n)}, output[i:]...)...)
+		i++
+	}
+	return string(output), nil
+}
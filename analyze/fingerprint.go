@@ -0,0 +1,328 @@
+package analyze
+
+import (
+	"fmt"
+	"mime"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mel2oo/mailfile"
+)
+
+// Fingerprint finding codes.
+const (
+	CodeMailerMismatch = "mailer-mismatch"
+	CodePhishingKit    = "phishing-kit"
+)
+
+// Fingerprint categories.
+const (
+	CategoryClient      = "client"
+	CategoryWebmail     = "webmail"
+	CategoryLibrary     = "library"
+	CategoryPlatform    = "platform"
+	CategoryPhishingKit = "phishing-kit"
+)
+
+// Fingerprint is a client or platform a message may have been sent with.
+type Fingerprint struct {
+	Name string `json:"name"`
+	// Category is CategoryClient, CategoryWebmail, CategoryLibrary,
+	// CategoryPlatform or CategoryPhishingKit.
+	Category string `json:"category"`
+	// Version is the version the X-Mailer or User-Agent field names.
+	Version string `json:"version,omitempty"`
+	// Score weighs the evidence: 3 for a named mailer, 2 for a Message-ID,
+	// a boundary or a vendor field, 1 for the header order.
+	Score    int    `json:"score"`
+	Evidence []Clue `json:"evidence"`
+}
+
+// Clue is a value matching a fingerprint.
+type Clue struct {
+	// Field is where the value was found: a field name such as "X-Mailer",
+	// "boundary", or "header-order".
+	Field string `json:"field"`
+	Value string `json:"value"`
+}
+
+// Claimed reports whether the X-Mailer or User-Agent field names the
+// fingerprint.
+func (f *Fingerprint) Claimed() bool {
+	for _, c := range f.Evidence {
+		if strings.EqualFold(c.Field, "X-Mailer") || strings.EqualFold(c.Field, "User-Agent") {
+			return true
+		}
+	}
+	return false
+}
+
+// signature is what a client or platform leaves in the messages it sends.
+type signature struct {
+	name, category string
+	// mailer matches the X-Mailer or User-Agent field, its first group the
+	// version
+	mailer    *regexp.Regexp
+	messageID *regexp.Regexp
+	boundary  *regexp.Regexp
+	// headers are fields only it adds
+	headers []string
+	// order are fields it writes in this order
+	order []string
+}
+
+var signatures = []signature{
+	{
+		name:      "Microsoft Outlook Express",
+		category:  CategoryClient,
+		mailer:    regexp.MustCompile(`(?i)^Microsoft Outlook Express ([\d.]+)`),
+		messageID: regexp.MustCompile(`^<[0-9a-f]{12}\$[0-9a-f]{8}\$[0-9a-f]{8}@`),
+		boundary:  regexp.MustCompile(`^----=_NextPart_\d{3}_[0-9A-F]{4}_[0-9A-F]{8}\.[0-9A-F]{8}$`),
+		headers:   []string{"X-MimeOLE"},
+	},
+	{
+		name:      "Microsoft Outlook",
+		category:  CategoryClient,
+		mailer:    regexp.MustCompile(`(?i)^Microsoft (?:Office )?Outlook(?: IMO)?,? (?:Build )?([\d.]+)`),
+		messageID: regexp.MustCompile(`^<[0-9a-f]{12}\$[0-9a-f]{8}\$[0-9a-f]{8}\$@`),
+		boundary:  regexp.MustCompile(`^----=_NextPart_\d{3}_[0-9A-F]{4}_[0-9A-F]{8}\.[0-9A-F]{8}$`),
+		headers:   []string{"Thread-Index"},
+	},
+	{
+		name:      "Microsoft Outlook for Mac",
+		category:  CategoryClient,
+		mailer:    regexp.MustCompile(`^Microsoft-MacOutlook/([\d.]+)`),
+		messageID: regexp.MustCompile(`^<[0-9A-F]{8}-[0-9A-F]{4}-[0-9A-F]{4}-[0-9A-F]{4}-[0-9A-F]{12}@`),
+		boundary:  regexp.MustCompile(`^B_\d{10}_\d+$`),
+	},
+	{
+		name:      "Microsoft Exchange / Outlook on the web",
+		category:  CategoryWebmail,
+		messageID: regexp.MustCompile(`(?i)@[a-z0-9]+\.[a-z]+\d+\.prod\.outlook\.com>$`),
+		boundary:  regexp.MustCompile(`^_\d{3}_[A-Za-z0-9]+_$`),
+		headers:   []string{"X-MS-Has-Attach", "X-MS-TNEF-Correlator"},
+	},
+	{
+		name:      "Gmail",
+		category:  CategoryWebmail,
+		messageID: regexp.MustCompile(`^<CA[A-Za-z0-9+_=.-]+@mail\.gmail\.com>$`),
+		boundary:  regexp.MustCompile(`^0{12}[0-9a-f]{16}$`),
+		headers:   []string{"X-Gm-Message-State", "X-Google-Smtp-Source"},
+		order:     []string{"MIME-Version", "From", "Date", "Message-ID", "Subject", "To"},
+	},
+	{
+		name:      "Apple Mail",
+		category:  CategoryClient,
+		mailer:    regexp.MustCompile(`^(?:Apple Mail|iPhone Mail|iPad Mail) \(([\w.]+)\)`),
+		messageID: regexp.MustCompile(`^<[0-9A-F]{8}-[0-9A-F]{4}-[0-9A-F]{4}-[0-9A-F]{4}-[0-9A-F]{12}@`),
+		boundary:  regexp.MustCompile(`^Apple-Mail`),
+	},
+	{
+		name:      "Mozilla Thunderbird",
+		category:  CategoryClient,
+		mailer:    regexp.MustCompile(`Thunderbird/([\d.]+)`),
+		messageID: regexp.MustCompile(`^<[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}@`),
+		boundary:  regexp.MustCompile(`^-{12}[0-9A-Za-z]{24}$`),
+	},
+	{
+		name:     "PHPMailer",
+		category: CategoryLibrary,
+		mailer:   regexp.MustCompile(`(?i)^PHPMailer (?:\[version )?v?([\d.]+)`),
+		boundary: regexp.MustCompile(`^b\d[_=]`),
+	},
+	{
+		name:     "PHP mail()",
+		category: CategoryLibrary,
+		mailer:   regexp.MustCompile(`^PHP/([\d.]+)`),
+		headers:  []string{"X-PHP-Originating-Script", "X-PHP-Script"},
+	},
+	{
+		name:      "Python email",
+		category:  CategoryLibrary,
+		messageID: regexp.MustCompile(`^<\d{12,}\.\d+\.\d+(?:\.[^@]*)?@`),
+		boundary:  regexp.MustCompile(`^={15}\d{18,20}==$`),
+	},
+	{
+		name:     "Nodemailer",
+		category: CategoryLibrary,
+		mailer:   regexp.MustCompile(`(?i)^Nodemailer \(([\d.]+)`),
+		boundary: regexp.MustCompile(`^--_NmP-`),
+	},
+	{
+		name:      "Swift Mailer",
+		category:  CategoryLibrary,
+		messageID: regexp.MustCompile(`@swift\.generated>$`),
+		boundary:  regexp.MustCompile(`^_=_swift_`),
+	},
+	{
+		name:      "SendGrid",
+		category:  CategoryPlatform,
+		messageID: regexp.MustCompile(`@(?:geopod-)?ismtpd`),
+		headers:   []string{"X-SG-EID", "X-SG-ID"},
+	},
+	{
+		name:      "Mailchimp",
+		category:  CategoryPlatform,
+		mailer:    regexp.MustCompile(`(?i)^MailChimp Mailer`),
+		messageID: regexp.MustCompile(`(?i)\.mcsv\.net>$`),
+		headers:   []string{"X-MC-User", "X-campaignid"},
+	},
+	{
+		name:      "Mandrill",
+		category:  CategoryPlatform,
+		messageID: regexp.MustCompile(`(?i)@mandrillapp\.com>$`),
+		headers:   []string{"X-Mandrill-User"},
+	},
+	{
+		name:      "Amazon SES",
+		category:  CategoryPlatform,
+		messageID: regexp.MustCompile(`(?i)@(?:[a-z0-9-]+\.)*amazonses\.com>$`),
+		headers:   []string{"X-SES-Outgoing", "X-SES-Configuration-Set"},
+	},
+	{
+		name:     "Leaf PHPMailer",
+		category: CategoryPhishingKit,
+		mailer:   regexp.MustCompile(`(?i)^Leaf PHPMailer`),
+	},
+	{
+		name:     "Gammadyne Mailer",
+		category: CategoryPhishingKit,
+		mailer:   regexp.MustCompile(`(?i)^Gammadyne`),
+	},
+	{
+		name:     "Atomic Mail Sender",
+		category: CategoryPhishingKit,
+		mailer:   regexp.MustCompile(`(?i)^Atomic Mail Sender`),
+	},
+}
+
+// Fingerprints returns the clients and platforms a message may have been
+// sent with, from its X-Mailer and User-Agent fields, Message-ID format,
+// MIME boundary, vendor fields and header order, the most likely first.
+func Fingerprints(msg *mailfile.Message) []*Fingerprint {
+	mailers := make([]Clue, 0)
+	for _, name := range []string{"X-Mailer", "User-Agent"} {
+		for _, value := range headerValues(msg.Headers, name) {
+			mailers = append(mailers, Clue{Field: name, Value: strings.TrimSpace(value)})
+		}
+	}
+	messageID := strings.TrimSpace(msg.MessageID)
+	if values := headerValues(msg.Headers, "Message-ID"); len(values) > 0 {
+		messageID = strings.TrimSpace(values[0])
+	}
+	boundary := ""
+	contentType := msg.ContentType
+	if values := headerValues(msg.Headers, "Content-Type"); len(values) > 0 {
+		contentType = values[0]
+	}
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		boundary = params["boundary"]
+	}
+
+	fingerprints := make([]*Fingerprint, 0)
+	for _, sig := range signatures {
+		f := &Fingerprint{Name: sig.name, Category: sig.category, Evidence: make([]Clue, 0)}
+		for _, c := range mailers {
+			if sig.mailer == nil {
+				break
+			}
+			if m := sig.mailer.FindStringSubmatch(c.Value); m != nil {
+				if len(m) > 1 {
+					f.Version = m[1]
+				}
+				f.Score += 3
+				f.Evidence = append(f.Evidence, c)
+				break
+			}
+		}
+		if sig.messageID != nil && sig.messageID.MatchString(messageID) {
+			f.Score += 2
+			f.Evidence = append(f.Evidence, Clue{Field: "Message-ID", Value: messageID})
+		}
+		if sig.boundary != nil && sig.boundary.MatchString(boundary) {
+			f.Score += 2
+			f.Evidence = append(f.Evidence, Clue{Field: "boundary", Value: boundary})
+		}
+		for _, name := range sig.headers {
+			if values := headerValues(msg.Headers, name); len(values) > 0 {
+				f.Score += 2
+				f.Evidence = append(f.Evidence, Clue{Field: name, Value: strings.TrimSpace(values[0])})
+				break
+			}
+		}
+		if len(sig.order) > 0 && inOrder(msg.HeaderOrder, sig.order) {
+			f.Score++
+			f.Evidence = append(f.Evidence, Clue{Field: "header-order", Value: strings.Join(sig.order, ", ")})
+		}
+		if f.Score > 0 {
+			fingerprints = append(fingerprints, f)
+		}
+	}
+
+	sort.SliceStable(fingerprints, func(i, j int) bool {
+		return fingerprints[i].Score > fingerprints[j].Score
+	})
+	return fingerprints
+}
+
+// inOrder reports whether the fields are all in names, in this order.
+func inOrder(names, fields []string) bool {
+	next := 0
+	for _, name := range names {
+		if next < len(fields) && strings.EqualFold(name, fields[next]) {
+			next++
+		}
+	}
+	return next == len(fields)
+}
+
+// fingerprintFindings reports phishing kits, and a client named by X-Mailer
+// or User-Agent that nothing else in the message points to while a library
+// or kit left its marks.
+func fingerprintFindings(fingerprints []*Fingerprint) []Finding {
+	findings := make([]Finding, 0)
+	for _, f := range fingerprints {
+		if f.Category != CategoryPhishingKit {
+			continue
+		}
+		findings = append(findings, Finding{
+			Code:     CodePhishingKit,
+			Severity: High,
+			Message:  fmt.Sprintf("sent with %s, a mass mailer used by phishing campaigns", f.Name),
+			Evidence: clueEvidence(f),
+		})
+	}
+
+	for _, claimed := range fingerprints {
+		if !claimed.Claimed() || len(claimed.Evidence) > 1 ||
+			claimed.Category != CategoryClient && claimed.Category != CategoryWebmail {
+			continue
+		}
+		for _, f := range fingerprints {
+			if f.Claimed() || f.Category != CategoryLibrary && f.Category != CategoryPhishingKit {
+				continue
+			}
+			evidence := clueEvidence(f)
+			evidence["claimed"] = claimed.Name
+			evidence[strings.ToLower(claimed.Evidence[0].Field)] = claimed.Evidence[0].Value
+			findings = append(findings, Finding{
+				Code:     CodeMailerMismatch,
+				Severity: High,
+				Message:  fmt.Sprintf("claims to be sent with %s, but looks sent with %s", claimed.Name, f.Name),
+				Evidence: evidence,
+			})
+			break
+		}
+	}
+	return findings
+}
+
+// clueEvidence returns the evidence of a fingerprint as finding evidence.
+func clueEvidence(f *Fingerprint) map[string]string {
+	evidence := map[string]string{"fingerprint": f.Name, "category": f.Category}
+	for _, c := range f.Evidence {
+		evidence[strings.ToLower(c.Field)] = c.Value
+	}
+	return evidence
+}
@@ -0,0 +1,194 @@
+package analyze
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mel2oo/mailfile"
+)
+
+// Header finding codes.
+const (
+	CodeReplyToMismatch    = "reply-to-mismatch"
+	CodeReturnPathMismatch = "return-path-mismatch"
+	CodeDisplayNameAddress = "display-name-address"
+	CodeSenderMismatch     = "sender-mismatch"
+	CodeMessageIDDomain    = "message-id-domain"
+	CodeDateSkew           = "date-skew"
+	CodeInvalidDate        = "invalid-date"
+	CodeMissingHeader      = "missing-header"
+	CodeDuplicateHeader    = "duplicate-header"
+)
+
+// singletonFields may appear at most once (RFC 5322, section 3.6).
+var singletonFields = []string{
+	"Date", "From", "Sender", "Reply-To", "To", "Cc", "Bcc",
+	"Message-ID", "In-Reply-To", "References", "Subject",
+}
+
+// expAddress matches an email address written in a display name.
+var expAddress = regexp.MustCompile(`[A-Za-z0-9._%+'-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+
+// Headers reports header spoofing and anomalies: mismatched From, Reply-To,
+// Return-Path and Sender domains, addresses in display names, a Message-ID
+// from another domain, a Date far from the first Received timestamp, and
+// missing or duplicated fields.
+func Headers(msg *mailfile.Message, opts *Options) []Finding {
+	o := options(opts)
+	findings := make([]Finding, 0)
+
+	var from *mail.Address
+	if len(msg.From) > 0 {
+		from = msg.From[0]
+	}
+	fromDomain := ""
+	if from != nil {
+		fromDomain = domainOf(from.Address)
+	}
+
+	// From, Reply-To and Return-Path domains
+	if len(fromDomain) > 0 {
+		for _, addr := range msg.ReplyTo {
+			if domain := domainOf(addr.Address); len(domain) > 0 && o.orgDomain(domain) != o.orgDomain(fromDomain) {
+				findings = append(findings, Finding{
+					Code:     CodeReplyToMismatch,
+					Severity: Medium,
+					Message:  fmt.Sprintf("replies go to %s, not to the From domain %s", domain, fromDomain),
+					Evidence: map[string]string{"from": from.Address, "reply-to": addr.Address},
+				})
+			}
+		}
+		for _, value := range headerValues(msg.Headers, "Return-Path") {
+			domain := domainOf(value)
+			if len(domain) > 0 && o.orgDomain(domain) != o.orgDomain(fromDomain) {
+				findings = append(findings, Finding{
+					Code:     CodeReturnPathMismatch,
+					Severity: Low,
+					Message:  fmt.Sprintf("the envelope sender domain %s is not the From domain %s", domain, fromDomain),
+					Evidence: map[string]string{"from": from.Address, "return-path": strings.TrimSpace(value)},
+				})
+			}
+		}
+	}
+
+	// addresses in display names
+	named := make([]*mail.Address, 0, len(msg.From)+len(msg.ReplyTo)+1)
+	named = append(named, msg.From...)
+	if msg.Sender != nil {
+		named = append(named, msg.Sender)
+	}
+	named = append(named, msg.ReplyTo...)
+	for _, addr := range named {
+		for _, shown := range expAddress.FindAllString(addr.Name, -1) {
+			if strings.EqualFold(shown, addr.Address) {
+				continue
+			}
+			severity := High
+			if o.orgDomain(domainOf(shown)) == o.orgDomain(domainOf(addr.Address)) {
+				severity = Medium
+			}
+			findings = append(findings, Finding{
+				Code:     CodeDisplayNameAddress,
+				Severity: severity,
+				Message:  fmt.Sprintf("the display name shows %s but the address is %s", shown, addr.Address),
+				Evidence: map[string]string{"name": addr.Name, "address": addr.Address, "shown": shown},
+			})
+		}
+	}
+
+	// Sender
+	if msg.Sender != nil && from != nil && !strings.EqualFold(msg.Sender.Address, from.Address) {
+		severity := Low
+		if o.orgDomain(domainOf(msg.Sender.Address)) != o.orgDomain(fromDomain) {
+			severity = Medium
+		}
+		findings = append(findings, Finding{
+			Code:     CodeSenderMismatch,
+			Severity: severity,
+			Message:  fmt.Sprintf("sent by %s on behalf of %s", msg.Sender.Address, from.Address),
+			Evidence: map[string]string{"from": from.Address, "sender": msg.Sender.Address},
+		})
+	}
+
+	// Message-ID
+	if len(msg.MessageID) > 0 && len(fromDomain) > 0 {
+		domain := domainOf(msg.MessageID)
+		if len(domain) > 0 && o.orgDomain(domain) != o.orgDomain(fromDomain) {
+			findings = append(findings, Finding{
+				Code:     CodeMessageIDDomain,
+				Severity: Low,
+				Message:  fmt.Sprintf("the Message-ID was made at %s, not at the From domain %s", domain, fromDomain),
+				Evidence: map[string]string{"from": from.Address, "message-id": msg.MessageID},
+			})
+		}
+	}
+
+	// Date
+	if len(msg.Date) > 0 {
+		date, err := mail.ParseDate(msg.Date)
+		if err != nil {
+			findings = append(findings, Finding{
+				Code:     CodeInvalidDate,
+				Severity: Low,
+				Message:  "the Date field cannot be parsed",
+				Evidence: map[string]string{"date": msg.Date},
+			})
+		} else if hop := firstDatedHop(mailfile.ParseTrace(msg.Headers).Hops); hop != nil {
+			skew := hop.Date.Sub(date)
+			if skew > o.MaxDateSkew || -skew > o.MaxDateSkew {
+				direction := "before"
+				if skew < 0 {
+					direction, skew = "after", -skew
+				}
+				findings = append(findings, Finding{
+					Code:     CodeDateSkew,
+					Severity: Medium,
+					Message:  fmt.Sprintf("the Date is %s %s the first Received timestamp", skew, direction),
+					Evidence: map[string]string{"date": msg.Date, "received": hop.Date.String(), "skew": skew.String()},
+				})
+			}
+		}
+	}
+
+	// missing and duplicated fields, of messages that were sent
+	if len(msg.Headers) == 0 {
+		return findings
+	}
+	for _, field := range []struct {
+		name     string
+		severity Severity
+	}{{"From", Medium}, {"Date", Medium}, {"Message-ID", Low}} {
+		if len(headerValues(msg.Headers, field.name)) == 0 {
+			findings = append(findings, Finding{
+				Code:     CodeMissingHeader,
+				Severity: field.severity,
+				Message:  fmt.Sprintf("the %s field is missing", field.name),
+				Evidence: map[string]string{"field": field.name},
+			})
+		}
+	}
+	for _, name := range singletonFields {
+		if n := len(headerValues(msg.Headers, name)); n > 1 {
+			findings = append(findings, Finding{
+				Code:     CodeDuplicateHeader,
+				Severity: Medium,
+				Message:  fmt.Sprintf("the %s field appears %d times", name, n),
+				Evidence: map[string]string{"field": name, "count": strconv.Itoa(n)},
+			})
+		}
+	}
+	return findings
+}
+
+// firstDatedHop returns the oldest hop whose date could be parsed.
+func firstDatedHop(hops []*mailfile.Hop) *mailfile.Hop {
+	for _, hop := range hops {
+		if !hop.Date.IsZero() {
+			return hop
+		}
+	}
+	return nil
+}
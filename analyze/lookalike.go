@@ -0,0 +1,340 @@
+package analyze
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mel2oo/mailfile"
+)
+
+// CodeLookalikeDomain is the finding of a domain imitating a protected one.
+const CodeLookalikeDomain = "lookalike-domain"
+
+// Lookalike techniques, from the most to the least certain.
+const (
+	// TechniqueHomograph is an internationalized domain whose characters
+	// look like the protected one, such as "pаypal.com" in Cyrillic or its
+	// punycode "xn--pypal-4ve.com".
+	TechniqueHomograph = "homograph"
+	// TechniqueConfusable is an ASCII domain whose characters look like the
+	// protected one, such as "paypa1.com" or "rnicrosoft.com".
+	TechniqueConfusable = "confusable"
+	// TechniqueSubdomain puts the protected domain in front of another, such
+	// as "paypal.com.evil.tld" or "paypal-com.evil.tld".
+	TechniqueSubdomain = "subdomain"
+	// TechniqueTLDSwap keeps the name under another suffix, such as
+	// "paypal.co".
+	TechniqueTLDSwap = "tld-swap"
+	// TechniqueKeyboardTypo replaces a character with a neighbouring key,
+	// such as "paypak.com".
+	TechniqueKeyboardTypo = "keyboard-typo"
+	// TechniqueEditDistance is a few characters inserted, deleted, replaced
+	// or swapped, such as "paypall.com" or "pyapal.com".
+	TechniqueEditDistance = "edit-distance"
+	// TechniqueBrand uses the protected name or a brand within another
+	// name, such as "paypal-secure.com".
+	TechniqueBrand = "brand"
+)
+
+// Lookalike is a domain imitating a protected domain or brand.
+type Lookalike struct {
+	// Source is where the domain was found: "from", "reply-to", "sender" or
+	// "url".
+	Source string `json:"source"`
+	// Value is the address or URL holding the domain.
+	Value string `json:"value"`
+	// Domain is the lower case domain, and Unicode its punycode labels
+	// decoded, if any.
+	Domain  string `json:"domain"`
+	Unicode string `json:"unicode,omitempty"`
+	// Protected is the protected domain or brand imitated.
+	Protected string `json:"protected"`
+	Technique string `json:"technique"`
+}
+
+// qwerty lists the keys around each key of a QWERTY keyboard.
+var qwerty = map[rune]string{
+	'1': "2q", '2': "13qw", '3': "24we", '4': "35er", '5': "46rt", '6': "57ty", '7': "68yu",
+	'8': "79ui", '9': "80io", '0': "9op", '-': "0p",
+	'q': "12wa", 'w': "23qeas", 'e': "34wrsd", 'r': "45etdf", 't': "56ryfg",
+	'y': "67tugh", 'u': "78yihj", 'i': "89uojk", 'o': "90ipkl", 'p': "0-ol",
+	'a': "qwsz", 's': "weadzx", 'd': "erfsxc", 'f': "rtgdcv", 'g': "tyhfvb",
+	'h': "yujgbn", 'j': "uikhnm", 'k': "iojlm", 'l': "opk",
+	'z': "asx", 'x': "sdzc", 'c': "dfxv", 'v': "fgcb", 'b': "ghvn", 'n': "hjbm", 'm': "jkn",
+}
+
+// LookalikeDomain returns how a domain imitates one of opts.Protected or
+// opts.Brands, or nil if it does not. The protected domains and their
+// subdomains do not imitate anything.
+func LookalikeDomain(domain string, opts *Options) *Lookalike {
+	o := options(opts)
+	domain = strings.ToLower(strings.Trim(strings.TrimSpace(domain), "."))
+	if len(domain) == 0 || net.ParseIP(domain) != nil {
+		return nil
+	}
+	for _, p := range o.Protected {
+		p = strings.ToLower(strings.Trim(p, "."))
+		if len(p) > 0 && (domain == p || strings.HasSuffix(domain, "."+p)) {
+			return nil
+		}
+	}
+
+	l := &Lookalike{Domain: domain}
+	unicodeDomain, decoded := toUnicode(domain)
+	if decoded {
+		l.Unicode = unicodeDomain
+	}
+	idn := decoded || !isASCII(domain)
+
+	// the name under the public suffix, and the labels in front of it
+	suffix := o.Suffixes.PublicSuffix(unicodeDomain)
+	org := o.orgDomain(unicodeDomain)
+	name := strings.TrimSuffix(strings.TrimSuffix(org, suffix), ".")
+	prefix := strings.TrimSuffix(strings.TrimSuffix(unicodeDomain, org), ".")
+
+	for _, p := range o.Protected {
+		p = strings.ToLower(strings.Trim(p, "."))
+		pSuffix := o.Suffixes.PublicSuffix(p)
+		pName := strings.TrimSuffix(strings.TrimSuffix(o.orgDomain(p), pSuffix), ".")
+		if len(pName) == 0 {
+			continue
+		}
+		if technique := imitates(name, suffix, prefix, idn, pName, pSuffix, p); len(technique) > 0 {
+			l.Protected, l.Technique = p, technique
+			return l
+		}
+	}
+
+	skeleton := Skeleton(strings.TrimSuffix(strings.TrimSuffix(unicodeDomain, suffix), "."))
+	for _, brand := range o.Brands {
+		b := Skeleton(strings.Join(strings.Fields(brand), ""))
+		if len(b) > 0 && strings.Contains(skeleton, b) {
+			l.Protected, l.Technique = brand, TechniqueBrand
+			if idn {
+				l.Technique = TechniqueHomograph
+			}
+			return l
+		}
+	}
+	return nil
+}
+
+// imitates returns the technique by which a domain, as its name, public
+// suffix and the labels in front of them, imitates a protected domain, empty
+// if it does not.
+func imitates(name, suffix, prefix string, idn bool, pName, pSuffix, protected string) string {
+	switch {
+	case name == pName:
+		return TechniqueTLDSwap
+	case Skeleton(name) == Skeleton(pName):
+		if idn {
+			return TechniqueHomograph
+		}
+		return TechniqueConfusable
+	}
+
+	dotted := "." + prefix + "."
+	if len(prefix) > 0 && (strings.Contains(dotted, "."+protected+".") ||
+		strings.Contains(prefix, strings.ReplaceAll(protected, ".", "-"))) {
+		return TechniqueSubdomain
+	}
+
+	if suffix == pSuffix && keyboardTypo(name, pName) {
+		return TechniqueKeyboardTypo
+	}
+	n := utf8.RuneCountInString(pName)
+	if n >= 4 {
+		limit := 1
+		if n > 6 {
+			limit = 2
+		}
+		if editDistance(name, pName) <= limit {
+			return TechniqueEditDistance
+		}
+		if containsName(name, pName) || strings.Contains(dotted, "."+pName+".") {
+			return TechniqueBrand
+		}
+	}
+	return ""
+}
+
+// containsName reports whether name holds pName as one of its hyphenated
+// words, or at all if pName is long enough not to be part of common words, as
+// "apple" is of "pineapple".
+func containsName(name, pName string) bool {
+	if utf8.RuneCountInString(pName) >= 6 {
+		return strings.Contains(name, pName)
+	}
+	for _, word := range strings.Split(name, "-") {
+		if word == pName {
+			return true
+		}
+	}
+	return false
+}
+
+// keyboardTypo reports whether s is t with one character replaced by a
+// neighbouring key.
+func keyboardTypo(s, t string) bool {
+	a, b := []rune(s), []rune(t)
+	if len(a) != len(b) {
+		return false
+	}
+	typos := 0
+	for i := range a {
+		if a[i] == b[i] {
+			continue
+		}
+		if typos++; typos > 1 || !strings.ContainsRune(qwerty[b[i]], a[i]) {
+			return false
+		}
+	}
+	return typos == 1
+}
+
+// editDistance returns the Damerau-Levenshtein distance between s and t,
+// with adjacent transpositions counting as one edit.
+func editDistance(s, t string) int {
+	a, b := []rune(s), []rune(t)
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// minInt ...
+func minInt(n int, ns ...int) int {
+	for _, v := range ns {
+		if v < n {
+			n = v
+		}
+	}
+	return n
+}
+
+// isASCII ...
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Lookalikes returns the sender, reply-to and link domains of a message that
+// imitate opts.Protected or opts.Brands.
+func Lookalikes(msg *mailfile.Message, opts *Options) []*Lookalike {
+	o := options(opts)
+	lookalikes := make([]*Lookalike, 0)
+	if len(o.Protected) == 0 && len(o.Brands) == 0 {
+		return lookalikes
+	}
+	check := func(source, value, domain string) {
+		if l := LookalikeDomain(domain, o); l != nil {
+			l.Source, l.Value = source, value
+			lookalikes = append(lookalikes, l)
+		}
+	}
+
+	for _, addr := range msg.From {
+		check("from", addr.Address, domainOf(addr.Address))
+	}
+	for _, addr := range msg.ReplyTo {
+		check("reply-to", addr.Address, domainOf(addr.Address))
+	}
+	if msg.Sender != nil {
+		check("sender", msg.Sender.Address, domainOf(msg.Sender.Address))
+	}
+
+	seen := make(map[string]bool)
+	html, text := readBodies(msg)
+	for _, link := range mailfile.ExtractURLs(html, text) {
+		raw := link
+		if strings.HasPrefix(strings.ToLower(raw), "www.") {
+			raw = "http://" + raw
+		}
+		u, err := url.Parse(raw)
+		if err != nil || len(u.Hostname()) == 0 || seen[strings.ToLower(u.Hostname())] {
+			continue
+		}
+		seen[strings.ToLower(u.Hostname())] = true
+		check("url", link, u.Hostname())
+	}
+	return lookalikes
+}
+
+// lookalikeFindings turns lookalikes into findings.
+func lookalikeFindings(lookalikes []*Lookalike) []Finding {
+	findings := make([]Finding, 0, len(lookalikes))
+	for _, l := range lookalikes {
+		severity := High
+		if l.Technique == TechniqueEditDistance || l.Technique == TechniqueBrand {
+			severity = Medium
+		}
+		shown := l.Domain
+		if len(l.Unicode) > 0 {
+			shown = l.Unicode
+		}
+		evidence := map[string]string{
+			"source":    l.Source,
+			"value":     l.Value,
+			"domain":    l.Domain,
+			"protected": l.Protected,
+			"technique": l.Technique,
+		}
+		if len(l.Unicode) > 0 {
+			evidence["unicode"] = l.Unicode
+		}
+		if scripts := mixedScripts(shown); len(scripts) > 0 {
+			evidence["scripts"] = strings.Join(scripts, ",")
+		}
+		findings = append(findings, Finding{
+			Code:     CodeLookalikeDomain,
+			Severity: severity,
+			Message:  fmt.Sprintf("the %s domain %s imitates %s (%s)", l.Source, shown, l.Protected, l.Technique),
+			Evidence: evidence,
+		})
+	}
+	return findings
+}
+
+// readBodies reads the html and text bodies of a message, leaving them to be
+// read again.
+func readBodies(msg *mailfile.Message) (html, text []byte) {
+	same := msg.Body != nil && msg.Body == msg.Html
+	if msg.Html != nil {
+		html, _ = io.ReadAll(msg.Html)
+		msg.Html = bytes.NewBuffer(html)
+	}
+	if same {
+		// a message without a text body reads the html one
+		msg.Body = msg.Html
+	} else if msg.Body != nil {
+		text, _ = io.ReadAll(msg.Body)
+		msg.Body = bytes.NewBuffer(text)
+	}
+	return html, text
+}
@@ -0,0 +1,332 @@
+package analyze
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/mel2oo/mailfile"
+)
+
+// Unicode finding codes.
+const (
+	CodeBidiControl        = "bidi-control"
+	CodeInvisibleCharacter = "invisible-character"
+	CodeMixedScript        = "mixed-script"
+)
+
+// Trick kinds.
+const (
+	// TrickBidiControl reorders the text around it, such as RIGHT-TO-LEFT
+	// OVERRIDE (U+202E) making "invoice\u202efdp.exe" show as
+	// "invoiceexe.pdf".
+	TrickBidiControl = "bidi-control"
+	// TrickInvisible renders as nothing, such as ZERO WIDTH SPACE (U+200B),
+	// splitting words for filters while showing them whole.
+	TrickInvisible = "invisible"
+	// TrickSeparator breaks lines or words without showing, such as LINE
+	// SEPARATOR (U+2028).
+	TrickSeparator = "separator"
+	// TrickMixedScript is a word mixing scripts, such as "Рayment" starting
+	// with a Cyrillic letter.
+	TrickMixedScript = "mixed-script"
+)
+
+// Trick is a run of deceptive characters in a string.
+type Trick struct {
+	Kind string `json:"kind"`
+	// Position is the index of the first character, in runes, and Length
+	// the number of them.
+	Position int `json:"position"`
+	Length   int `json:"length"`
+	// Text is what was found: the code points of control and invisible
+	// characters, such as "U+202E", or the word of mixed scripts.
+	Text string `json:"text"`
+	// Name describes it, such as "RIGHT-TO-LEFT OVERRIDE" or
+	// "Latin, Cyrillic".
+	Name string `json:"name"`
+}
+
+// Inspection is a string checked for Unicode tricks.
+type Inspection struct {
+	// Field is where the string was found: "subject", "from", "sender",
+	// "reply-to", "to", "cc" or "attachment".
+	Field string `json:"field,omitempty"`
+	Value string `json:"value"`
+	// Rendered is the string as it is shown: reordered by its bidi
+	// overrides, without invisible characters. Skeleton is the rendered
+	// string with confusable characters replaced, see Skeleton.
+	Rendered string  `json:"rendered"`
+	Skeleton string  `json:"skeleton"`
+	Tricks   []Trick `json:"tricks"`
+}
+
+// controlNames are the names of the bidi controls and invisible characters.
+var controlNames = map[rune]string{
+	'\u00ad': "SOFT HYPHEN",
+	'\u034f': "COMBINING GRAPHEME JOINER",
+	'\u061c': "ARABIC LETTER MARK",
+	'\u115f': "HANGUL CHOSEONG FILLER",
+	'\u1160': "HANGUL JUNGSEONG FILLER",
+	'\u180e': "MONGOLIAN VOWEL SEPARATOR",
+	'\u200b': "ZERO WIDTH SPACE",
+	'\u200c': "ZERO WIDTH NON-JOINER",
+	'\u200d': "ZERO WIDTH JOINER",
+	'\u200e': "LEFT-TO-RIGHT MARK",
+	'\u200f': "RIGHT-TO-LEFT MARK",
+	'\u2028': "LINE SEPARATOR",
+	'\u2029': "PARAGRAPH SEPARATOR",
+	'\u202a': "LEFT-TO-RIGHT EMBEDDING",
+	'\u202b': "RIGHT-TO-LEFT EMBEDDING",
+	'\u202c': "POP DIRECTIONAL FORMATTING",
+	'\u202d': "LEFT-TO-RIGHT OVERRIDE",
+	'\u202e': "RIGHT-TO-LEFT OVERRIDE",
+	'\u2060': "WORD JOINER",
+	'\u2061': "FUNCTION APPLICATION",
+	'\u2062': "INVISIBLE TIMES",
+	'\u2063': "INVISIBLE SEPARATOR",
+	'\u2064': "INVISIBLE PLUS",
+	'\u2066': "LEFT-TO-RIGHT ISOLATE",
+	'\u2067': "RIGHT-TO-LEFT ISOLATE",
+	'\u2068': "FIRST STRONG ISOLATE",
+	'\u2069': "POP DIRECTIONAL ISOLATE",
+	'\u3164': "HANGUL FILLER",
+	'\ufeff': "ZERO WIDTH NO-BREAK SPACE",
+	'\uffa0': "HALFWIDTH HANGUL FILLER",
+}
+
+// trickKind returns the kind of trick a character at i of s is, empty if it
+// is none.
+func trickKind(s []rune, i int) string {
+	r := s[i]
+	switch {
+	case r >= '\u202a' && r <= '\u202e', r >= '\u2066' && r <= '\u2069':
+		return TrickBidiControl
+	case r == '\u2028' || r == '\u2029' || r == '\u2063' || r == '\u180e':
+		return TrickSeparator
+	case r == '\u200c' || r == '\u200d' || r == '\u200e' || r == '\u200f' || r == '\u061c':
+		// joiners and marks are part of emoji sequences and of non-Latin
+		// scripts
+		for _, j := range []int{i - 1, i + 1} {
+			if j >= 0 && j < len(s) && (unicode.Is(unicode.So, s[j]) || len(scriptOf(s[j])) > 0 && scriptOf(s[j]) != "Latin") {
+				return ""
+			}
+		}
+		return TrickInvisible
+	case isInvisible(r) || r == '\u034f':
+		return TrickInvisible
+	}
+	return ""
+}
+
+// Inspect returns the bidi controls, invisible characters and mixed-script
+// words of s, with how s is shown and its skeleton.
+func Inspect(s string) *Inspection {
+	runes := []rune(s)
+	in := &Inspection{Value: s, Tricks: make([]Trick, 0)}
+
+	for i := 0; i < len(runes); i++ {
+		kind := trickKind(runes, i)
+		if len(kind) == 0 {
+			continue
+		}
+		t := Trick{Kind: kind, Position: i}
+		codes, names := make([]string, 0), make([]string, 0)
+		for ; i < len(runes) && trickKind(runes, i) == kind; i++ {
+			codes = append(codes, fmt.Sprintf("U+%04X", runes[i]))
+			name, ok := controlNames[runes[i]]
+			if !ok {
+				name = "FORMAT CHARACTER"
+			}
+			if len(names) == 0 || names[len(names)-1] != name {
+				names = append(names, name)
+			}
+		}
+		i--
+		t.Length = len(codes)
+		t.Text, t.Name = strings.Join(codes, " "), strings.Join(names, ", ")
+		in.Tricks = append(in.Tricks, t)
+	}
+
+	// words mixing scripts, ignoring the characters tricks are made of
+	for start := 0; start < len(runes); {
+		if !isWordRune(runes[start]) {
+			start++
+			continue
+		}
+		end := start
+		var word strings.Builder
+		for ; end < len(runes) && (isWordRune(runes[end]) || len(trickKind(runes, end)) > 0); end++ {
+			if isWordRune(runes[end]) {
+				word.WriteRune(runes[end])
+			}
+		}
+		if scripts := mixedScripts(word.String()); len(scripts) > 0 {
+			in.Tricks = append(in.Tricks, Trick{
+				Kind:     TrickMixedScript,
+				Position: start,
+				Length:   end - start,
+				Text:     word.String(),
+				Name:     strings.Join(scripts, ", "),
+			})
+		}
+		start = end
+	}
+
+	in.Rendered = string(render(runes))
+	in.Skeleton = Skeleton(in.Rendered)
+	return in
+}
+
+// isWordRune ...
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// render returns the characters as shown: laid out by their left-to-right
+// and right-to-left overrides, without controls and invisible characters
+// (UAX #9, rule L2). Embeddings and isolates do not reorder the letters and
+// digits these tricks are written in, so they keep the level around them.
+func render(runes []rune) []rune {
+	out := make([]rune, 0, len(runes))
+	levels := make([]int, 0, len(runes))
+	stack := []int{0}
+	for i, r := range runes {
+		level := stack[len(stack)-1]
+		switch {
+		case r == '\u202d':
+			stack = append(stack, level+2-level%2)
+		case r == '\u202e':
+			stack = append(stack, level+1+level%2)
+		case r == '\u202a' || r == '\u202b':
+			stack = append(stack, level)
+		case r == '\u202c':
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case len(trickKind(runes, i)) > 0 || r >= '\u200e' && r <= '\u200f' || r == '\u061c':
+		default:
+			out = append(out, r)
+			levels = append(levels, level)
+		}
+	}
+
+	highest := 0
+	for _, level := range levels {
+		if level > highest {
+			highest = level
+		}
+	}
+	for level := highest; level > 0; level-- {
+		for start := 0; start < len(out); start++ {
+			if levels[start] < level {
+				continue
+			}
+			end := start
+			for end < len(out) && levels[end] >= level {
+				end++
+			}
+			for a, b := start, end-1; a < b; a, b = a+1, b-1 {
+				out[a], out[b] = out[b], out[a]
+			}
+			start = end
+		}
+	}
+	return out
+}
+
+// Inspections returns the subject, display names and attachment filenames
+// of a message that hold Unicode tricks.
+func Inspections(msg *mailfile.Message) []*Inspection {
+	inspections := make([]*Inspection, 0)
+	check := func(field, value string) {
+		if len(value) == 0 {
+			return
+		}
+		if in := Inspect(value); len(in.Tricks) > 0 {
+			in.Field = field
+			inspections = append(inspections, in)
+		}
+	}
+
+	check("subject", msg.Subject)
+	for _, addr := range msg.From {
+		check("from", addr.Name)
+	}
+	if msg.Sender != nil {
+		check("sender", msg.Sender.Name)
+	}
+	for _, addr := range msg.ReplyTo {
+		check("reply-to", addr.Name)
+	}
+	for _, addr := range msg.To {
+		check("to", addr.Name)
+	}
+	for _, addr := range msg.Cc {
+		check("cc", addr.Name)
+	}
+	for _, a := range msg.Attachments {
+		check("attachment", a.Filename)
+	}
+	return inspections
+}
+
+// inspectionFindings turns inspections into findings, one for each kind of
+// trick in a string.
+func inspectionFindings(inspections []*Inspection) []Finding {
+	findings := make([]Finding, 0)
+	for _, in := range inspections {
+		byKind := make(map[string][]Trick)
+		kinds := make([]string, 0)
+		for _, t := range in.Tricks {
+			if _, ok := byKind[t.Kind]; !ok {
+				kinds = append(kinds, t.Kind)
+			}
+			byKind[t.Kind] = append(byKind[t.Kind], t)
+		}
+
+		for _, kind := range kinds {
+			tricks := byKind[kind]
+			positions, texts := make([]string, 0, len(tricks)), make([]string, 0, len(tricks))
+			for _, t := range tricks {
+				positions = append(positions, fmt.Sprint(t.Position))
+				texts = append(texts, t.Text)
+			}
+			evidence := map[string]string{
+				"field":     in.Field,
+				"value":     in.Value,
+				"rendered":  in.Rendered,
+				"skeleton":  in.Skeleton,
+				"positions": strings.Join(positions, ","),
+				"text":      strings.Join(texts, ","),
+			}
+
+			f := Finding{Evidence: evidence}
+			switch kind {
+			case TrickBidiControl:
+				f.Code, f.Severity = CodeBidiControl, Medium
+				f.Message = fmt.Sprintf("the %s holds bidi controls and shows as %q", in.Field, in.Rendered)
+				if in.Field == "attachment" {
+					// a filename shown with another extension than it has
+					if ext, shown := strings.ToLower(path.Ext(in.Value)), strings.ToLower(path.Ext(in.Rendered)); ext != shown {
+						f.Severity = High
+						f.Message = fmt.Sprintf("the attachment shows as %q but is a %s file", in.Rendered, ext)
+						evidence["extension"] = ext
+					}
+				}
+			case TrickMixedScript:
+				f.Code, f.Severity = CodeMixedScript, Medium
+				f.Message = fmt.Sprintf("the %s has words mixing scripts, read as %q", in.Field, in.Skeleton)
+			default:
+				f.Code, f.Severity = CodeInvisibleCharacter, Low
+				f.Message = fmt.Sprintf("the %s holds invisible characters (%s)", in.Field, strings.Join(texts, ", "))
+				if in.Field == "attachment" {
+					f.Severity = Medium
+				}
+			}
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
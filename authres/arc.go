@@ -0,0 +1,167 @@
+package authres
+
+import (
+	"fmt"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxARCInstances is the limit of ARC sets in a chain.
+const MaxARCInstances = 50
+
+// ARC chain validation status, of the cv= tag and of a whole chain.
+const (
+	ChainNone = "none"
+	ChainPass = "pass"
+	ChainFail = "fail"
+)
+
+// ARCSet is the set of ARC fields one intermediary added, of the same
+// instance.
+type ARCSet struct {
+	Instance int `json:"instance"`
+
+	// Results are of the ARC-Authentication-Results field, what the
+	// intermediary found when it received the message.
+	Results *Results `json:"results"`
+
+	// ChainValidation is the cv= tag of the ARC-Seal, the status of the
+	// chain the intermediary found.
+	ChainValidation string `json:"cv"`
+	SealDomain      string `json:"seal-domain"`
+	SealSelector    string `json:"seal-selector"`
+
+	SignatureDomain   string   `json:"signature-domain"`
+	SignatureSelector string   `json:"signature-selector"`
+	SignedHeaders     []string `json:"signed-headers"`
+}
+
+// Chain is the ARC chain of a message.
+type Chain struct {
+	// Sets are in instance order, the first intermediary first.
+	Sets []*ARCSet `json:"sets"`
+
+	// Status is the validity of the chain from its structure and the cv=
+	// tags the seals declare: ChainNone with no sets, ChainFail if an
+	// instance is missing, duplicated or incomplete, or a seal declares a
+	// failure. The seal and message signatures are not checked.
+	Status string `json:"status"`
+	// Reason tells why the Status is ChainFail.
+	Reason string `json:"reason"`
+}
+
+// ParseARC parses the ARC fields of a message header. A chain that is not
+// valid has a ChainFail status, an error is only returned for fields that
+// cannot be parsed.
+func ParseARC(h mail.Header) (*Chain, error) {
+	c := &Chain{Sets: make([]*ARCSet, 0), Status: ChainNone}
+	sets := make(map[int]*ARCSet)
+	counts := make(map[string]int)
+	set := func(field string, instance int) *ARCSet {
+		counts[field+"/"+strconv.Itoa(instance)]++
+		if sets[instance] == nil {
+			sets[instance] = &ARCSet{Instance: instance}
+		}
+		return sets[instance]
+	}
+
+	for _, value := range values(h, "ARC-Authentication-Results") {
+		instance, rest, err := arcInstance(value)
+		if err != nil {
+			return c, fmt.Errorf("ARC-Authentication-Results: %w", err)
+		}
+		results, err := Parse(rest)
+		if err != nil {
+			return c, fmt.Errorf("ARC-Authentication-Results: %w", err)
+		}
+		set("aar", instance).Results = results
+	}
+	for _, value := range values(h, "ARC-Message-Signature") {
+		tags := parseTags(value)
+		instance, err := strconv.Atoi(tags["i"])
+		if err != nil {
+			return c, fmt.Errorf("ARC-Message-Signature: %w: invalid i= tag", ErrSyntax)
+		}
+		s := set("ams", instance)
+		s.SignatureDomain, s.SignatureSelector = strings.ToLower(tags["d"]), tags["s"]
+		for _, name := range strings.Split(tags["h"], ":") {
+			if name = strings.ToLower(strings.TrimSpace(name)); len(name) > 0 {
+				s.SignedHeaders = append(s.SignedHeaders, name)
+			}
+		}
+	}
+	for _, value := range values(h, "ARC-Seal") {
+		tags := parseTags(value)
+		instance, err := strconv.Atoi(tags["i"])
+		if err != nil {
+			return c, fmt.Errorf("ARC-Seal: %w: invalid i= tag", ErrSyntax)
+		}
+		s := set("as", instance)
+		s.ChainValidation = strings.ToLower(tags["cv"])
+		s.SealDomain, s.SealSelector = strings.ToLower(tags["d"]), tags["s"]
+	}
+
+	for _, s := range sets {
+		c.Sets = append(c.Sets, s)
+	}
+	sort.Slice(c.Sets, func(i, j int) bool { return c.Sets[i].Instance < c.Sets[j].Instance })
+	if len(c.Sets) > 0 {
+		c.Status, c.Reason = validateChain(c.Sets, counts)
+	}
+	return c, nil
+}
+
+// validateChain checks the structure of a chain (RFC 8617, section 5.2).
+func validateChain(sets []*ARCSet, counts map[string]int) (string, string) {
+	if len(sets) > MaxARCInstances {
+		return ChainFail, fmt.Sprintf("more than %d ARC sets", MaxARCInstances)
+	}
+	for i, s := range sets {
+		if s.Instance != i+1 {
+			return ChainFail, fmt.Sprintf("ARC set %d is missing", i+1)
+		}
+		for _, field := range []string{"aar", "ams", "as"} {
+			if n := counts[field+"/"+strconv.Itoa(s.Instance)]; n != 1 {
+				return ChainFail, fmt.Sprintf("ARC set %d has %d %s fields", s.Instance, n, arcFieldNames[field])
+			}
+		}
+	}
+	last := sets[len(sets)-1]
+	if last.ChainValidation == ChainFail {
+		return ChainFail, fmt.Sprintf("ARC set %d declares the chain failed", last.Instance)
+	}
+	for _, s := range sets {
+		expected := ChainPass
+		if s.Instance == 1 {
+			expected = ChainNone
+		}
+		if s.ChainValidation != expected {
+			return ChainFail, fmt.Sprintf("ARC set %d has cv=%s, expected cv=%s", s.Instance, s.ChainValidation, expected)
+		}
+	}
+	return ChainPass, ""
+}
+
+// arcFieldNames ...
+var arcFieldNames = map[string]string{
+	"aar": "ARC-Authentication-Results",
+	"ams": "ARC-Message-Signature",
+	"as":  "ARC-Seal",
+}
+
+// arcInstance splits the leading "i=N;" of an ARC-Authentication-Results
+// value from the results.
+func arcInstance(value string) (int, string, error) {
+	tag, rest, ok := strings.Cut(value, ";")
+	name, number, _ := strings.Cut(tag, "=")
+	if !ok || strings.TrimSpace(name) != "i" {
+		return 0, "", fmt.Errorf("%w: missing i= tag", ErrSyntax)
+	}
+	instance, err := strconv.Atoi(strings.TrimSpace(number))
+	if err != nil || instance < 1 {
+		return 0, "", fmt.Errorf("%w: invalid i= tag", ErrSyntax)
+	}
+	return instance, rest, nil
+}
@@ -0,0 +1,183 @@
+// Package authres parses the verdicts receiving servers record in a message:
+// Authentication-Results (RFC 8601), Received-SPF (RFC 7208) and the ARC
+// header fields (RFC 8617).
+package authres
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/mel2oo/mailfile"
+)
+
+// ErrSyntax is the error of a header field that cannot be parsed.
+var ErrSyntax = errors.New("authres: invalid syntax")
+
+// Results are the results of an Authentication-Results field.
+type Results struct {
+	// AuthServID names the server that did the checks, such as
+	// "mx.google.com".
+	AuthServID string `json:"authserv-id"`
+	Version    int    `json:"version"`
+	// Results have the method, the result, the reason and the properties,
+	// such as "smtp.mailfrom", "header.d" and "header.from".
+	Results []mailfile.AuthResult `json:"results"`
+}
+
+// Parse parses the value of an Authentication-Results field.
+func Parse(value string) (*Results, error) {
+	tokens, err := tokenize(value)
+	if err != nil {
+		return nil, err
+	}
+	segments, _ := splitTokens(tokens)
+
+	// authserv-id [version], which Exchange Online leaves out
+	r := &Results{Version: 1, Results: make([]mailfile.AuthResult, 0)}
+	if head := segments[0]; len(head) < 2 || head[1].kind != equalToken {
+		if len(head) == 0 || len(head) > 2 || head[0].kind == equalToken {
+			return nil, fmt.Errorf("%w: missing authserv-id", ErrSyntax)
+		}
+		r.AuthServID = head[0].value
+		if len(head) == 2 {
+			if r.Version, err = strconv.Atoi(head[1].value); err != nil {
+				return nil, fmt.Errorf("%w: invalid version %q", ErrSyntax, head[1].value)
+			}
+		}
+		segments = segments[1:]
+	}
+
+	for _, segment := range segments {
+		if len(segment) == 0 {
+			continue
+		}
+		// no-result
+		if len(segment) == 1 && strings.EqualFold(segment[0].value, "none") {
+			continue
+		}
+		var result mailfile.AuthResult
+		err := parsePairs(segment, func(name, value string) {
+			switch {
+			case len(result.Method) == 0:
+				method, _, _ := strings.Cut(name, "/")
+				result.Method = strings.ToLower(method)
+				result.Result = strings.ToLower(value)
+				result.Properties = make(map[string]string)
+			case strings.EqualFold(name, "reason"):
+				result.Reason = value
+			default:
+				result.Properties[strings.ToLower(name)] = value
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		r.Results = append(r.Results, result)
+	}
+	return r, nil
+}
+
+// ParseReceivedSPF parses the value of a Received-SPF field: the result, the
+// comment as the reason, and the key-value pairs, such as "client-ip",
+// "envelope-from" and "helo", as the properties.
+func ParseReceivedSPF(value string) (*mailfile.AuthResult, error) {
+	tokens, err := tokenize(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 || tokens[0].kind != wordToken {
+		return nil, fmt.Errorf("%w: missing SPF result", ErrSyntax)
+	}
+	result := &mailfile.AuthResult{
+		Method:     "spf",
+		Result:     strings.ToLower(tokens[0].value),
+		Properties: make(map[string]string),
+	}
+	tokens = tokens[1:]
+	if len(tokens) > 0 && tokens[0].kind == commentToken {
+		result.Reason = tokens[0].value
+		tokens = tokens[1:]
+	}
+
+	segments, _ := splitTokens(tokens)
+	for _, segment := range segments {
+		err := parsePairs(segment, func(name, value string) {
+			result.Properties[strings.ToLower(name)] = value
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Headers are the verdicts recorded in the header of a message, topmost,
+// that is most recent, first.
+type Headers struct {
+	AuthenticationResults []*Results             `json:"authentication-results"`
+	ReceivedSPF           []*mailfile.AuthResult `json:"received-spf"`
+	ARC                   *Chain                 `json:"arc"`
+
+	// Errors are the errors of the fields that could not be parsed, which
+	// are left out.
+	Errors []error `json:"-"`
+}
+
+// ParseHeaders parses the verdicts recorded in a message header.
+func ParseHeaders(h mail.Header) *Headers {
+	hs := &Headers{
+		AuthenticationResults: make([]*Results, 0),
+		ReceivedSPF:           make([]*mailfile.AuthResult, 0),
+	}
+	for _, value := range values(h, "Authentication-Results") {
+		r, err := Parse(value)
+		if err != nil {
+			hs.Errors = append(hs.Errors, fmt.Errorf("Authentication-Results: %w", err))
+			continue
+		}
+		hs.AuthenticationResults = append(hs.AuthenticationResults, r)
+	}
+	for _, value := range values(h, "Received-SPF") {
+		r, err := ParseReceivedSPF(value)
+		if err != nil {
+			hs.Errors = append(hs.Errors, fmt.Errorf("Received-SPF: %w", err))
+			continue
+		}
+		hs.ReceivedSPF = append(hs.ReceivedSPF, r)
+	}
+	var err error
+	if hs.ARC, err = ParseARC(h); err != nil {
+		hs.Errors = append(hs.Errors, err)
+	}
+	return hs
+}
+
+// Trusted returns the results recorded by the named servers, such as the
+// gateways of the receiving organization. Results claiming another authserv-id
+// may have been added by anyone on the way and should not be relied on.
+func (hs *Headers) Trusted(authServIDs ...string) []mailfile.AuthResult {
+	results := make([]mailfile.AuthResult, 0)
+	for _, r := range hs.AuthenticationResults {
+		for _, id := range authServIDs {
+			if strings.EqualFold(r.AuthServID, id) {
+				results = append(results, r.Results...)
+				break
+			}
+		}
+	}
+	return results
+}
+
+// values returns the values of a field, whatever the case of its name in h.
+func values(h mail.Header, name string) []string {
+	var list []string
+	for key, v := range h {
+		if strings.EqualFold(key, name) {
+			list = append(list, v...)
+		}
+	}
+	return list
+}
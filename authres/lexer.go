@@ -0,0 +1,131 @@
+package authres
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tokenKind is the kind of a token of a header value.
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	quotedToken
+	commentToken
+	equalToken
+	semicolonToken
+)
+
+// token is a token of a header value: a word, a quoted string, a comment or
+// one of the separators '=' and ';'.
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+// tokenize splits a header value into tokens, with comments and quoted
+// strings unescaped.
+func tokenize(s string) ([]token, error) {
+	tokens := make([]token, 0)
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '=':
+			tokens = append(tokens, token{kind: equalToken, value: "="})
+			i++
+		case c == ';':
+			tokens = append(tokens, token{kind: semicolonToken, value: ";"})
+			i++
+		case c == '(':
+			var b strings.Builder
+			depth := 0
+			for ; i < len(s); i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+					b.WriteByte(s[i])
+					continue
+				}
+				if s[i] == '(' {
+					if depth++; depth == 1 {
+						continue
+					}
+				} else if s[i] == ')' {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+				b.WriteByte(s[i])
+			}
+			if depth > 0 {
+				return nil, fmt.Errorf("%w: unterminated comment", ErrSyntax)
+			}
+			tokens = append(tokens, token{kind: commentToken, value: strings.TrimSpace(b.String())})
+			i++
+		case c == '"':
+			var b strings.Builder
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("%w: unterminated quoted string", ErrSyntax)
+			}
+			tokens = append(tokens, token{kind: quotedToken, value: b.String()})
+			i++
+		default:
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t\r\n=;()\"", rune(s[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: wordToken, value: s[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+// splitTokens splits tokens into the segments between semicolons, and the
+// comments of each segment, which are left out of it.
+func splitTokens(tokens []token) (segments [][]token, comments [][]string) {
+	segment, segmentComments := make([]token, 0), make([]string, 0)
+	for _, t := range tokens {
+		switch t.kind {
+		case semicolonToken:
+			segments, comments = append(segments, segment), append(comments, segmentComments)
+			segment, segmentComments = make([]token, 0), make([]string, 0)
+		case commentToken:
+			segmentComments = append(segmentComments, t.value)
+		default:
+			segment = append(segment, t)
+		}
+	}
+	return append(segments, segment), append(comments, segmentComments)
+}
+
+// parsePairs parses "name=value" pairs, the value a word or quoted string.
+func parsePairs(segment []token, visit func(name, value string)) error {
+	for i := 0; i < len(segment); i += 3 {
+		if i+2 >= len(segment) || segment[i].kind != wordToken || segment[i+1].kind != equalToken ||
+			segment[i+2].kind != wordToken && segment[i+2].kind != quotedToken {
+			return fmt.Errorf("%w: expected name=value near %q", ErrSyntax, segment[i].value)
+		}
+		visit(segment[i].value, segment[i+2].value)
+	}
+	return nil
+}
+
+// parseTags parses a tag list, as of ARC-Seal and ARC-Message-Signature.
+func parseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, spec := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(spec, "=")
+		if !ok {
+			continue
+		}
+		tags[strings.TrimSpace(name)] = strings.Join(strings.Fields(value), "")
+	}
+	return tags
+}
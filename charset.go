@@ -0,0 +1,11 @@
+package mailfile
+
+import (
+	"github.com/mel2oo/mailfile/charset"
+)
+
+// NormalizeCharset 规范化字符集名称，见 charset.Normalize。
+// 例如 "GB2312" -> "gb18030"，"cp1251" -> "windows-1251"，"ISO8859_5" -> "iso-8859-5"。
+func NormalizeCharset(name string) string {
+	return charset.Normalize(name)
+}
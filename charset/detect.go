@@ -0,0 +1,236 @@
+// Package charset converts mail text to UTF-8 with pure Go decoders, and
+// detects the character encoding of text that does not declare one, or
+// declares it wrongly.
+//
+// Every candidate encoding is scored in two steps: the data must decode without
+// invalid byte sequences, and the decoded characters are weighted by how
+// common they are in the languages written in that encoding. The resulting
+// confidences are comparable across candidates, so guesses can be ranked.
+package charset
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Guess is a candidate charset of some data.
+type Guess struct {
+	Charset string `json:"charset"`
+
+	// Confidence is between 0 and 1, higher is more likely.
+	Confidence float64 `json:"confidence"`
+}
+
+// sampleSize is how much of the data is examined.
+const sampleSize = 64 << 10
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+
+	// escapes announcing a switch to a multibyte set in ISO-2022-JP
+	iso2022JP = [][]byte{[]byte("\x1b$B"), []byte("\x1b$@"), []byte("\x1b(J"), []byte("\x1b(I")}
+)
+
+// Detect returns the charsets data may be encoded in, the most likely first.
+// Data with a byte order mark is reported as the marked Unicode encoding, data
+// that is plain ASCII as us-ascii. The result is empty if no candidate can
+// decode the data.
+func Detect(data []byte) []Guess {
+	data = sample(data)
+
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return []Guess{{Charset: "utf-8", Confidence: 1}}
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return []Guess{{Charset: "utf-16le", Confidence: 1}}
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return []Guess{{Charset: "utf-16be", Confidence: 1}}
+	}
+
+	if isASCII(data) {
+		for _, esc := range iso2022JP {
+			if bytes.Contains(data, esc) {
+				return []Guess{{Charset: "iso-2022-jp", Confidence: 0.99}, {Charset: "us-ascii", Confidence: 0.01}}
+			}
+		}
+		return []Guess{{Charset: "us-ascii", Confidence: 1}}
+	}
+
+	guesses := make([]Guess, 0)
+	if confidence := utf8Confidence(data); confidence > 0 {
+		guesses = append(guesses, Guess{Charset: "utf-8", Confidence: confidence})
+	}
+	for _, m := range models {
+		if confidence := m.confidence(data); confidence > 0 {
+			guesses = append(guesses, Guess{Charset: m.charset, Confidence: confidence})
+		}
+	}
+
+	sort.SliceStable(guesses, func(i, j int) bool {
+		return guesses[i].Confidence > guesses[j].Confidence
+	})
+	return guesses
+}
+
+// Best returns the most likely charset of data, or an empty string if no
+// candidate can decode it.
+func Best(data []byte) string {
+	if guesses := Detect(data); len(guesses) > 0 {
+		return guesses[0].Charset
+	}
+	return ""
+}
+
+// Confidence returns the confidence that data is encoded in the named
+// charset, and false if the detector has no model of that charset.
+func Confidence(data []byte, name string) (float64, bool) {
+	data = sample(data)
+	switch name {
+	case "us-ascii":
+		if isASCII(data) {
+			return 1, true
+		}
+		return 0, true
+	case "utf-8":
+		if isASCII(data) {
+			return 1, true
+		}
+		return utf8Confidence(data), true
+	}
+
+	for _, m := range models {
+		if m.charset == name {
+			if isASCII(data) {
+				return 1, true
+			}
+			return m.confidence(data), true
+		}
+	}
+	return 0, false
+}
+
+// sample cuts data to sampleSize, backing off to an ASCII byte so that no
+// multibyte character is split.
+func sample(data []byte) []byte {
+	if len(data) <= sampleSize {
+		return data
+	}
+	data = data[:sampleSize]
+	for i := len(data) - 1; i >= len(data)-8; i-- {
+		if data[i] < utf8.RuneSelf {
+			return data[:i+1]
+		}
+	}
+	return data
+}
+
+// utf8Confidence grows with the number of multibyte sequences, each of which
+// is unlikely to be valid by chance in another encoding.
+func utf8Confidence(data []byte) float64 {
+	if !utf8.Valid(data) {
+		return 0
+	}
+
+	n := 0
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r >= utf8.RuneSelf {
+			n++
+		}
+		data = data[size:]
+	}
+	return 0.99 * (1 - math.Pow(0.5, float64(n+1)))
+}
+
+// confidence decodes data and scores the decoded characters with the
+// language model of the encoding.
+func (m *model) confidence(data []byte) float64 {
+	text, err := m.encoding.NewDecoder().Bytes(data)
+	if err != nil {
+		return 0
+	}
+
+	var (
+		total   int
+		invalid int
+		score   float64
+		prev    = ' '
+		run     int // consecutive non-ASCII letters
+	)
+	for len(text) > 0 {
+		r, size := utf8.DecodeRune(text)
+		text = text[size:]
+
+		if r < utf8.RuneSelf {
+			prev, run = r, 0
+			continue
+		}
+
+		total++
+		if unicode.IsLetter(r) {
+			run++
+		} else {
+			run = 0
+		}
+
+		switch {
+		case r == utf8.RuneError, r >= 0x80 && r <= 0x9F:
+			// undefined bytes and C1 controls do not occur in text
+			invalid++
+		default:
+			score += m.lang.weight(r, prev, run)
+		}
+		prev = r
+	}
+	if total == 0 || invalid*4 >= total {
+		return 0
+	}
+
+	validity := 1 - float64(invalid*4)/float64(total)
+	evidence := float64(total) / float64(total+2)
+	return m.prior * validity * evidence * score / float64(total)
+}
+
+// weight is how much a decoded character r, following prev and ending a run
+// of run non-ASCII letters, speaks for the language.
+func (l *language) weight(r, prev rune, run int) float64 {
+	w, ok := l.common[r]
+	if !ok {
+		return 0
+	}
+	if !l.alphabetic || !unicode.IsLetter(r) {
+		return w
+	}
+
+	if prev < utf8.RuneSelf && unicode.IsLetter(prev) && !l.latin {
+		// a letter of another script glued to an ASCII letter
+		return 0
+	}
+	if l.latin && run >= 3 {
+		// accented letters come alone in Latin scripts
+		return 0
+	}
+	if unicode.IsUpper(r) {
+		if unicode.IsLower(prev) {
+			// a capital inside a word
+			return 0
+		}
+		return w / 2
+	}
+	return w
+}
+
+// isASCII ...
+func isASCII(data []byte) bool {
+	for _, c := range data {
+		if c >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
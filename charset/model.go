@@ -0,0 +1,150 @@
+package charset
+
+import (
+	"unicode"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// language is a frequency model of the non-ASCII characters of a language or
+// of a group of languages sharing an encoding.
+type language struct {
+	// common weights the characters frequent in the language, 1 for the
+	// most frequent ones.
+	common map[rune]float64
+
+	// alphabetic languages have letter case and words, and are checked for
+	// capitals inside words and letters of mixed scripts.
+	alphabetic bool
+
+	// latin languages mix their accented letters with ASCII letters.
+	latin bool
+}
+
+// model is a candidate encoding.
+type model struct {
+	charset  string
+	encoding encoding.Encoding
+	lang     *language
+
+	// prior ranks encodings sharing a language, and breaks ties between
+	// encodings decoding the data identically.
+	prior float64
+}
+
+// The most frequent characters of each language. Their share in running text
+// is what tells a right decoding from a wrong one: a wrong decoding yields
+// characters spread over the whole repertoire of the encoding.
+const (
+	hans = "的一是不了在人有我他这个们中来上大为和国地到以说时要就出会可也你对生能而子那得于着下自之年过发后作里用道行所然家种事成方多经么去法学如都同现当没动面起看定天分还进好小部其些主样理心她本前开但因只从想实日军者意无力它与长把机十民第公此已工使情明性知全三又关点正业外将两高间由问很最重并物手应战向头文体政美相见被利什二等产或新己制身果加西斯月话合回特代内信表化老给世位次度门任常先海通教儿原东声提立及比员解水名真论处走义各入几口认条平系气题活尔更别打女变四神总何电数安少报才结反受目太量再感建务做接必场件计管期市直德资命山金指克许统区保至队形社便空决治展马科司五基眼书非则听白却界达光放强即像难且权思王象完设式色路记南品住告类求据程北边死张该交规万取拉格望觉术领共确传师观清今切院让识候带导争运笑飞风步改收根干造言联持组每济车亲极林服快办议往元英士证近失转夫令准布始怎存未远叫台单影具罗字爱击流备兵连调深商算质团集百需价花党华城石级整府离况亚请技际约示复病息究线似官火断精满支视消越器容照须九增研写称企八功包片史委乎查轻易早曾除农找装广显吧阿李标谈吃图念六引历首医局突专费号尽另周较注语仅考落青随选列武红"
+
+	hant = "的一是不了在人有我他這個們中來上大為和國地到以說時要就出會可也你對生能而子那得於著下自之年過發後作裡用道行所然家種事成方多經麼去法學如都同現當沒動面起看定天分還進好小部其些主樣理心她本前開但因只從想實日軍者意無力它與長把機十民第公此已工使情明性知全三又關點正業外將兩高間由問很最重並物手應戰向頭文體政美相見被利什二等產或新己制身果加西斯月話合回特代內信表化老給世位次度門任常先海通教兒原東聲提立及比員解水名真論處走義各入幾口認條平系氣題活爾更別打女變四神總何電數安少報才結反受目太量再感建務做接必場件計管期市直德資命山金指克許統區保至隊形社便空決治展馬科司五基眼書非則聽白卻界達光放強即像難且權思王象完設式色路記南品住告類求據程北邊死張該交規萬取拉格望覺術領共確傳師觀清今切院讓識候帶導爭運笑飛風步改收根乾造言聯持組每濟車親極林服快辦議往元英士證近失轉夫令準布始怎呢存未遠叫台單影具羅字愛擊流備兵連調深商算質團集百需價花黨華城石級整府離況亞請技際約示復病息究線似官火斷精滿支視消越器容照須九增研寫稱企八功嗎包片史委乎查輕易早曾除農找裝廣顯吧阿李標談吃圖念六引歷首醫局突專費號盡另周較注語僅考落青隨選列"
+
+	kanji = "日本人大年一中出事会上国生時分行者見後前自的子何物田地方同業社内手間合東部場動用入下長新話気思言実家高発明月所立対作見学者電体市経目当関民定通会議理来最代政員問部外"
+
+	hangul = "이다는의에고하을가지로한서기리사도를대은자아어수인해시게나정들있구부보전일만상것제주국라과면원적우장그소성내동여연중었거세공관할요오조방문신경무비화러마분개위실니발생치없미유계모단저데까말되월회했였습년물학야행던드령선심통명후교불터결래트스르운영재반안날때음작용입식법현체산석민당히출및진차양간업건강합며감권외호점준달목크더된님받론표본람두번알않함째립육처려잘각배봐필약록직같될살속든"
+
+	kana = "ぁあぃいぅうぇえぉおかがきぎくぐけげこごさざしじすずせぜそぞただちぢっつづてでとどなにぬねのはばぱひびぴふぶぷへべぺほぼぽまみむめもゃやゅゆょよらりるれろゎわゐゑをんァアィイゥウェエォオカガキギクグケゲコゴサザシジスズセゼソゾタダチヂッツヅテデトドナニヌネノハバパヒビピフブプヘベペホボポマミムメモャヤュユョヨラリルレロヮワヰヱヲンヴヵヶー"
+
+	// punctuation of CJK text
+	cjkPunct = "、。〃々〈〉《》「」『』【】〔〕〖〗〜・！＂＃％＆＇（）＊＋，－．／：；＜＝＞？＠［＼］＿｛｜｝～￥…—‘’“”·"
+
+	westernFrequent = "éèàáóíúñçüöäßêâôãõ’‘“”–—…€«»°"
+	westernRare     = "ìòùøåæëïîûýÿœšžðþ¿¡·•™©®ºª£§"
+
+	centralFrequent = "áéíóúýčďěňřšťůžąćęłńśźżőűöüä„“”–—…"
+	centralRare     = "ôĺľŕâăîşţ°§·"
+
+	cyrillicFrequent = "оеаинтсрвлкмдпуя«»–—…№„“”"
+	cyrillicRare     = "бвгжзйфхцчшщъыьэюёіїєґў"
+
+	greekFrequent = "αοιετνσςυρπκμληάέίόώ«»–—…"
+	greekRare     = "βγδζθξφχψωήύϊϋΐΰ"
+
+	turkishFrequent = "çğıöşüâîû’“”–—…"
+
+	hebrewFrequent = "יוהלארמבתשנם–—…"
+	hebrewRare     = "גדזחטךכןסעףפץצק"
+
+	arabicFrequent = "اليمنوهرتبةعفكدأ،؛؟"
+	arabicRare     = "ءآؤإئثجحخذزسشصضطظغقى"
+
+	balticFrequent = "ąčęėįšųūžāēīķļņõöüäģ„“”–—…"
+
+	vietnamese = "ăâđêôơưàáảãạèéẻẽẹìíỉĩịòóỏõọùúủũụỳýỷỹỵ̣̀́̃̉"
+)
+
+var (
+	langChineseSimplified  = cjk(hans + cjkPunct)
+	langChineseTraditional = cjk(hant + cjkPunct)
+	langJapanese           = cjk(kana + kanji + cjkPunct)
+	langKorean             = cjk(hangul + cjkPunct)
+
+	langWestern    = alphabet(true, westernFrequent, westernRare)
+	langCentral    = alphabet(true, centralFrequent, centralRare)
+	langTurkish    = alphabet(true, turkishFrequent+westernFrequent, westernRare)
+	langBaltic     = alphabet(true, balticFrequent, westernRare)
+	langVietnamese = alphabet(true, vietnamese, "")
+	langCyrillic   = alphabet(false, cyrillicFrequent, cyrillicRare)
+	langGreek      = alphabet(false, greekFrequent, greekRare)
+	langHebrew     = alphabet(false, hebrewFrequent, hebrewRare)
+	langArabic     = alphabet(false, arabicFrequent, arabicRare)
+)
+
+// models are the candidate encodings, besides UTF-8.
+var models = []*model{
+	{"gb18030", simplifiedchinese.GB18030, langChineseSimplified, 1},
+	{"big5", traditionalchinese.Big5, langChineseTraditional, 0.99},
+	{"shift_jis", japanese.ShiftJIS, langJapanese, 1},
+	{"euc-jp", japanese.EUCJP, langJapanese, 0.99},
+	{"euc-kr", korean.EUCKR, langKorean, 1},
+
+	{"windows-1252", charmap.Windows1252, langWestern, 0.99},
+	{"iso-8859-1", charmap.ISO8859_1, langWestern, 0.98},
+	{"iso-8859-15", charmap.ISO8859_15, langWestern, 0.97},
+	{"windows-1250", charmap.Windows1250, langCentral, 0.97},
+	{"iso-8859-2", charmap.ISO8859_2, langCentral, 0.96},
+	{"windows-1251", charmap.Windows1251, langCyrillic, 0.98},
+	{"koi8-r", charmap.KOI8R, langCyrillic, 0.97},
+	{"iso-8859-5", charmap.ISO8859_5, langCyrillic, 0.9},
+	{"windows-1253", charmap.Windows1253, langGreek, 0.95},
+	{"iso-8859-7", charmap.ISO8859_7, langGreek, 0.94},
+	{"windows-1254", charmap.Windows1254, langTurkish, 0.95},
+	{"iso-8859-9", charmap.ISO8859_9, langTurkish, 0.94},
+	{"windows-1255", charmap.Windows1255, langHebrew, 0.95},
+	{"iso-8859-8", charmap.ISO8859_8, langHebrew, 0.94},
+	{"windows-1256", charmap.Windows1256, langArabic, 0.95},
+	{"iso-8859-6", charmap.ISO8859_6, langArabic, 0.9},
+	{"windows-1257", charmap.Windows1257, langBaltic, 0.94},
+	{"iso-8859-13", charmap.ISO8859_13, langBaltic, 0.93},
+	{"windows-1258", charmap.Windows1258, langVietnamese, 0.9},
+}
+
+// cjk builds the model of a language written with ideographs or syllables.
+func cjk(frequent string) *language {
+	l := &language{common: make(map[rune]float64)}
+	for _, r := range frequent {
+		l.common[r] = 1
+	}
+	return l
+}
+
+// alphabet builds the model of an alphabetic language from its frequent and
+// rare non-ASCII characters, given in lower case.
+func alphabet(latin bool, frequent, rare string) *language {
+	l := &language{common: make(map[rune]float64), alphabetic: true, latin: latin}
+	for _, r := range rare {
+		l.common[r] = 0.5
+		l.common[unicode.ToUpper(r)] = 0.5
+	}
+	for _, r := range frequent {
+		l.common[r] = 1
+		l.common[unicode.ToUpper(r)] = 1
+	}
+	return l
+}
@@ -0,0 +1,206 @@
+package charset
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// aliases maps common charset names to the names used by the registry.
+// gb2312 and gbk are decoded as their superset gb18030, ks_c_5601-1987 as
+// euc-kr, whose decoder covers the whole of code page 949.
+var aliases = map[string]string{
+	"utf8":              "utf-8",
+	"unicode-1-1-utf-8": "utf-8",
+	"ascii":             "us-ascii",
+	"ansi_x3.4-1968":    "us-ascii",
+	"iso646-us":         "us-ascii",
+	"gb2312":            "gb18030",
+	"gb_2312-80":        "gb18030",
+	"csgb2312":          "gb18030",
+	"x-gbk":             "gb18030",
+	"gbk":               "gb18030",
+	"cp936":             "gb18030",
+	"ms936":             "gb18030",
+	"windows-936":       "gb18030",
+	"euc-cn":            "gb18030",
+	"x-mac-chinesesimp": "gb18030",
+	"big5-hkscs":        "big5",
+	"x-x-big5":          "big5",
+	"cp950":             "big5",
+	"x-mac-chinesetrad": "big5",
+	"ks_c_5601-1987":    "euc-kr",
+	"ks_c_5601":         "euc-kr",
+	"ksc5601":           "euc-kr",
+	"cp949":             "euc-kr",
+	"windows-949":       "euc-kr",
+	"x-mac-korean":      "euc-kr",
+	"x-sjis":            "shift_jis",
+	"sjis":              "shift_jis",
+	"shift-jis":         "shift_jis",
+	"ms_kanji":          "shift_jis",
+	"windows-31j":       "shift_jis",
+	"cp932":             "shift_jis",
+	"x-mac-japanese":    "shift_jis",
+	"x-euc-jp":          "euc-jp",
+	"latin1":            "iso-8859-1",
+	"latin-1":           "iso-8859-1",
+	"l1":                "iso-8859-1",
+	"koi8r":             "koi8-r",
+	"koi8u":             "koi8-u",
+	"ucs-2":             "utf-16le",
+	"macintosh":         "x-mac-roman",
+	"mac":               "x-mac-roman",
+	"macroman":          "x-mac-roman",
+	"x-mac-ukrainian":   "x-mac-cyrillic",
+	"unicode-1-1-utf-7": "utf-7",
+	"csunicode11utf7":   "utf-7",
+	"x-unicode20utf7":   "utf-7",
+}
+
+// builtin are the encodings of the charsets met in mail. Charsets not listed
+// here are looked up in the WHATWG and IANA indexes.
+var builtin = map[string]encoding.Encoding{
+	"utf-8":          unicode.UTF8,
+	"utf-16":         unicode.UTF16(unicode.BigEndian, unicode.UseBOM),
+	"utf-16le":       unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf-16be":       unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"utf-7":          UTF7,
+	"gb18030":        simplifiedchinese.GB18030,
+	"hz-gb-2312":     simplifiedchinese.HZGB2312,
+	"big5":           traditionalchinese.Big5,
+	"shift_jis":      japanese.ShiftJIS,
+	"euc-jp":         japanese.EUCJP,
+	"iso-2022-jp":    japanese.ISO2022JP,
+	"euc-kr":         korean.EUCKR,
+	"koi8-r":         charmap.KOI8R,
+	"koi8-u":         charmap.KOI8U,
+	"x-mac-roman":    charmap.Macintosh,
+	"x-mac-cyrillic": charmap.MacintoshCyrillic,
+	"ibm866":         charmap.CodePage866,
+	"windows-874":    charmap.Windows874,
+	"windows-1250":   charmap.Windows1250,
+	"windows-1251":   charmap.Windows1251,
+	"windows-1252":   charmap.Windows1252,
+	"windows-1253":   charmap.Windows1253,
+	"windows-1254":   charmap.Windows1254,
+	"windows-1255":   charmap.Windows1255,
+	"windows-1256":   charmap.Windows1256,
+	"windows-1257":   charmap.Windows1257,
+	"windows-1258":   charmap.Windows1258,
+	// like browsers, us-ascii and iso-8859-1 are read as their superset
+	// windows-1252, whose quotes and dashes are often sent under these names
+	"us-ascii":     charmap.Windows1252,
+	"iso-8859-1":   charmap.Windows1252,
+	"iso-8859-2":   charmap.ISO8859_2,
+	"iso-8859-3":   charmap.ISO8859_3,
+	"iso-8859-4":   charmap.ISO8859_4,
+	"iso-8859-5":   charmap.ISO8859_5,
+	"iso-8859-6":   charmap.ISO8859_6,
+	"iso-8859-7":   charmap.ISO8859_7,
+	"iso-8859-8":   charmap.ISO8859_8,
+	"iso-8859-8-i": charmap.ISO8859_8I,
+	"iso-8859-9":   charmap.Windows1254,
+	"iso-8859-10":  charmap.ISO8859_10,
+	"iso-8859-13":  charmap.ISO8859_13,
+	"iso-8859-14":  charmap.ISO8859_14,
+	"iso-8859-15":  charmap.ISO8859_15,
+	"iso-8859-16":  charmap.ISO8859_16,
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]encoding.Encoding)
+)
+
+// Register makes an encoding available under a charset name, in addition to
+// or in place of the built in ones. It is the hook for decoders missing from
+// golang.org/x/text, such as vendor code pages.
+func Register(name string, enc encoding.Encoding) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[Normalize(name)] = enc
+}
+
+// Normalize returns the canonical form of a charset name: unquoted, lower
+// case, with common aliases resolved, for example "GB2312" -> "gb18030",
+// "cp1251" -> "windows-1251", "ISO8859_5" -> "iso-8859-5".
+func Normalize(name string) string {
+	name = strings.ToLower(strings.Trim(strings.TrimSpace(name), `"'`))
+	if alias, ok := aliases[name]; ok {
+		return alias
+	}
+
+	switch {
+	case strings.HasPrefix(name, "iso8859"), strings.HasPrefix(name, "iso_8859"), strings.HasPrefix(name, "iso-8859"):
+		part := strings.TrimLeft(name[strings.Index(name, "8859")+4:], "-_")
+		if idx := strings.IndexByte(part, ':'); idx >= 0 {
+			part = part[:idx] // iso_8859-1:1987
+		}
+		return "iso-8859-" + part
+	case strings.HasPrefix(name, "cp125"), strings.HasPrefix(name, "win125"), strings.HasPrefix(name, "x-cp125"):
+		return "windows-" + name[strings.Index(name, "125"):]
+	}
+	return name
+}
+
+// Lookup returns the encoding of a charset name.
+func Lookup(name string) (encoding.Encoding, error) {
+	name = Normalize(name)
+
+	registryMu.RLock()
+	enc, ok := registry[name]
+	registryMu.RUnlock()
+	if ok {
+		return enc, nil
+	}
+
+	if enc, ok := builtin[name]; ok {
+		return enc, nil
+	}
+	if enc, err := htmlindex.Get(name); err == nil && enc != nil {
+		return enc, nil
+	}
+	for _, index := range []*ianaindex.Index{ianaindex.IANA, ianaindex.MIME} {
+		if enc, err := index.Encoding(name); err == nil && enc != nil {
+			return enc, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported charset %q", name)
+}
+
+// Convert decodes data from a charset to a UTF-8 string. Invalid sequences
+// are replaced with U+FFFD. For an unsupported charset data is returned
+// unchanged, along with the error.
+func Convert(data []byte, name string) (string, error) {
+	if name = Normalize(name); name == "utf-8" {
+		return string(data), nil
+	}
+	if name == "us-ascii" && isASCII(data) {
+		return string(data), nil
+	}
+
+	enc, err := Lookup(name)
+	if err != nil {
+		return string(data), err
+	}
+	text, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data), err
+	}
+	if !utf8.Valid(text) {
+		return string(data), fmt.Errorf("invalid %s text", name)
+	}
+	return string(text), nil
+}
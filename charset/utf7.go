@@ -0,0 +1,160 @@
+package charset
+
+import (
+	"encoding/base64"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+)
+
+// UTF7 is the UTF-7 encoding of RFC 2152, still met in old mail and in
+// Outlook exports. Characters outside the direct set are written as
+// UTF-16 in modified base64, between '+' and an optional '-'.
+var UTF7 encoding.Encoding = utf7{}
+
+type utf7 struct{}
+
+func (utf7) NewDecoder() *encoding.Decoder {
+	return &encoding.Decoder{Transformer: &utf7Decoder{}}
+}
+
+func (utf7) NewEncoder() *encoding.Encoder {
+	return &encoding.Encoder{Transformer: &utf7Encoder{}}
+}
+
+func (utf7) String() string {
+	return "UTF-7"
+}
+
+// base64UTF7 is the base64 alphabet of UTF-7, without padding.
+var base64UTF7 = base64.RawStdEncoding
+
+func isBase64(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '+' || c == '/'
+}
+
+// isDirect reports whether r is written as itself: the direct and optional
+// direct characters of RFC 2152, except '+', '\' and '~'.
+func isDirect(r rune) bool {
+	return r < utf8.RuneSelf && r != '+' && r != '\\' && r != '~' &&
+		(r >= ' ' || r == '\t' || r == '\r' || r == '\n')
+}
+
+type utf7Decoder struct {
+	transform.NopResetter
+}
+
+func (d *utf7Decoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		if src[nSrc] != '+' {
+			if nDst >= len(dst) {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			dst[nDst] = src[nSrc]
+			nDst++
+			nSrc++
+			continue
+		}
+
+		end := nSrc + 1
+		for end < len(src) && isBase64(src[end]) {
+			end++
+		}
+		if end == len(src) && !atEOF {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+		next := end
+		if end < len(src) && src[end] == '-' {
+			next++ // the '-' ending the base64 run is absorbed
+		}
+
+		var text []byte
+		if encoded := src[nSrc+1 : end]; len(encoded) == 0 {
+			text = []byte{'+'} // "+-"
+		} else {
+			text = decodeUTF7Run(encoded)
+		}
+		if nDst+len(text) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], text)
+		nSrc = next
+	}
+	return nDst, nSrc, nil
+}
+
+// decodeUTF7Run decodes the UTF-16 text of a base64 run.
+func decodeUTF7Run(encoded []byte) []byte {
+	if len(encoded)%4 == 1 {
+		encoded = encoded[:len(encoded)-1] // a dangling sextet carries no bits
+	}
+	raw := make([]byte, base64UTF7.DecodedLen(len(encoded)))
+	n, err := base64UTF7.Decode(raw, encoded)
+	if err != nil {
+		return []byte(string(utf8.RuneError))
+	}
+	raw = raw[:n-n%2]
+
+	units := make([]uint16, 0, len(raw)/2)
+	for i := 0; i < len(raw); i += 2 {
+		units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+	}
+	return []byte(string(utf16.Decode(units)))
+}
+
+type utf7Encoder struct {
+	transform.NopResetter
+}
+
+func (e *utf7Encoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		r, size := utf8.DecodeRune(src[nSrc:])
+		if r == utf8.RuneError && size == 1 && !atEOF && !utf8.FullRune(src[nSrc:]) {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+
+		if isDirect(r) {
+			if nDst >= len(dst) {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			dst[nDst] = byte(r)
+			nDst++
+			nSrc += size
+			continue
+		}
+		if r == '+' {
+			if nDst+2 > len(dst) {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			nDst += copy(dst[nDst:], "+-")
+			nSrc += size
+			continue
+		}
+
+		// collect the run of characters to shift, up to what is buffered
+		end := nSrc
+		var units []uint16
+		for end < len(src) {
+			r, size := utf8.DecodeRune(src[end:])
+			if isDirect(r) || r == '+' || r == utf8.RuneError && size == 1 && !atEOF && !utf8.FullRune(src[end:]) {
+				break
+			}
+			units = append(units, utf16.Encode([]rune{r})...)
+			end += size
+		}
+
+		raw := make([]byte, 0, len(units)*2)
+		for _, u := range units {
+			raw = append(raw, byte(u>>8), byte(u))
+		}
+		encoded := "+" + base64UTF7.EncodeToString(raw) + "-"
+		if nDst+len(encoded) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], encoded)
+		nSrc = end
+	}
+	return nDst, nSrc, nil
+}
@@ -0,0 +1,164 @@
+// Package dkim signs messages and verifies their signatures with DKIM
+// (RFC 6376), using RSA-SHA256 or Ed25519-SHA256 (RFC 8463).
+package dkim
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Canonicalization is a DKIM canonicalization algorithm.
+type Canonicalization string
+
+const (
+	// Simple tolerates no change of the header fields or the body,
+	// except for empty lines at the end of the body.
+	Simple Canonicalization = "simple"
+	// Relaxed tolerates changes of white space and of the case of field
+	// names, and the folding of header fields.
+	Relaxed Canonicalization = "relaxed"
+)
+
+// SignatureField is the name of the DKIM signature header field.
+const SignatureField = "DKIM-Signature"
+
+// crlf converts the line breaks of data to CRLF: messages read from files
+// often use bare LF, which becomes CRLF on the wire.
+func crlf(data []byte) []byte {
+	if !bytes.Contains(data, []byte("\n")) && !bytes.Contains(data, []byte("\r")) {
+		return data
+	}
+	out := make([]byte, 0, len(data)+len(data)/32)
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == '\r' && i+1 < len(data) && data[i+1] == '\n':
+			out = append(out, '\r', '\n')
+			i++
+		case c == '\r' || c == '\n':
+			out = append(out, '\r', '\n')
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// splitHeader splits a message with CRLF line breaks into its header
+// fields, each with its folding and final CRLF, and its body.
+func splitHeader(data []byte) ([][]byte, []byte) {
+	fields := make([][]byte, 0)
+	for len(data) > 0 {
+		end := bytes.Index(data, []byte("\r\n"))
+		if end < 0 {
+			end = len(data)
+		} else {
+			end += 2
+		}
+		line := data[:end]
+		if bytes.Equal(line, []byte("\r\n")) {
+			return fields, data[end:]
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			last := fields[len(fields)-1]
+			fields[len(fields)-1] = last[:len(last)+len(line)]
+		} else {
+			fields = append(fields, line)
+		}
+		data = data[end:]
+	}
+	return fields, nil
+}
+
+// fieldName returns the name of a header field, in lower case.
+func fieldName(field []byte) string {
+	idx := bytes.IndexByte(field, ':')
+	if idx < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(string(field[:idx])))
+}
+
+// canonicalHeader returns a header field in canonical form, ending with CRLF.
+func canonicalHeader(field []byte, c Canonicalization) []byte {
+	if c != Relaxed {
+		return field
+	}
+	idx := bytes.IndexByte(field, ':')
+	if idx < 0 {
+		return field
+	}
+	name := strings.ToLower(strings.TrimRight(string(field[:idx]), " \t"))
+	value := bytes.ReplaceAll(field[idx+1:], []byte("\r\n"), nil)
+	return append([]byte(name+":"), append(compressSpace(bytes.Trim(value, " \t")), '\r', '\n')...)
+}
+
+// canonicalBody returns a body in canonical form.
+func canonicalBody(body []byte, c Canonicalization) []byte {
+	if c == Relaxed {
+		lines := bytes.SplitAfter(body, []byte("\r\n"))
+		out := make([]byte, 0, len(body))
+		for _, line := range lines {
+			content := bytes.TrimSuffix(line, []byte("\r\n"))
+			out = append(out, bytes.TrimRight(compressSpace(content), " ")...)
+			if len(content) < len(line) {
+				out = append(out, '\r', '\n')
+			}
+		}
+		body = out
+	}
+
+	// empty lines at the end are ignored, and a last line is ended
+	for bytes.HasSuffix(body, []byte("\r\n\r\n")) {
+		body = body[:len(body)-2]
+	}
+	if bytes.Equal(body, []byte("\r\n")) {
+		body = nil
+	}
+	if len(body) > 0 && !bytes.HasSuffix(body, []byte("\r\n")) {
+		body = append(body, '\r', '\n')
+	}
+	if len(body) == 0 && c == Simple {
+		return []byte("\r\n")
+	}
+	return body
+}
+
+// compressSpace reduces runs of spaces and tabs to a single space.
+func compressSpace(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	space := false
+	for _, c := range data {
+		if c == ' ' || c == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			out = append(out, ' ')
+			space = false
+		}
+		out = append(out, c)
+	}
+	if space {
+		out = append(out, ' ')
+	}
+	return out
+}
+
+// signedFields returns the header fields a signature covers, for the names
+// of its h= tag: each name takes the last field of that name not taken yet,
+// or none once they are all taken.
+func signedFields(fields [][]byte, names []string) [][]byte {
+	taken := make(map[int]bool)
+	signed := make([][]byte, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !taken[i] && fieldName(fields[i]) == name {
+				taken[i] = true
+				signed = append(signed, fields[i])
+				break
+			}
+		}
+	}
+	return signed
+}
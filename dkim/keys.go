@@ -0,0 +1,153 @@
+package dkim
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/mel2oo/mailfile"
+)
+
+// KeyLookup looks up the TXT records of a DNS name, such as
+// "selector._domainkey.example.com". It is an interface so that keys can come
+// from somewhere else than DNS, such as a local file with LoadKeys.
+type KeyLookup interface {
+	LookupTXT(name string) ([]string, error)
+}
+
+// DNSLookup looks up keys in DNS with net.LookupTXT.
+type DNSLookup struct{}
+
+// LookupTXT ...
+func (DNSLookup) LookupTXT(name string) ([]string, error) {
+	records, err := net.LookupTXT(name)
+	if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+		return nil, ErrKeyNotFound
+	}
+	return records, err
+}
+
+// Keys are TXT records by DNS name, for offline verification.
+type Keys map[string][]string
+
+// LookupTXT ...
+func (k Keys) LookupTXT(name string) ([]string, error) {
+	records, ok := k[strings.ToLower(strings.TrimSuffix(name, "."))]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return records, nil
+}
+
+// LoadKeys reads TXT records from lines of a DNS name and the record text,
+// in the style of a zone file:
+//
+//	mail._domainkey.example.com. IN TXT "v=DKIM1; k=rsa; " "p=MIIBIjAN..."
+//	s1._domainkey.example.org v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo=
+//
+// The class and type are optional, quoted strings are joined, and lines
+// starting with '#' or ';' are comments.
+func LoadKeys(r io.Reader) (Keys, error) {
+	keys := Keys{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		fields := strings.Fields(line)
+		name := strings.ToLower(strings.TrimSuffix(fields[0], "."))
+		rest := strings.TrimSpace(line[len(fields[0]):])
+		for _, word := range []string{"IN", "TXT"} {
+			if len(rest) > len(word) && strings.EqualFold(rest[:len(word)], word) && (rest[len(word)] == ' ' || rest[len(word)] == '\t') {
+				rest = strings.TrimSpace(rest[len(word):])
+			}
+		}
+		keys[name] = append(keys[name], mailfile.UnquoteTXT(rest))
+	}
+	return keys, scanner.Err()
+}
+
+// ErrKeyNotFound is returned by a KeyLookup when there is no record.
+var ErrKeyNotFound = errors.New("dkim: no key record")
+
+// key is a parsed DKIM key record.
+type key struct {
+	public  crypto.PublicKey
+	testing bool // t=y
+	strict  bool // t=s, i= must be in d= exactly
+}
+
+// parseKey parses a DKIM key record (RFC 6376, section 3.6.1), for an
+// algorithm of the signature.
+func parseKey(record, keyType string) (*key, error) {
+	tags, err := parseTags(record)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := tags["v"]; ok && v != "DKIM1" {
+		return nil, errors.New("dkim: key record version is not DKIM1")
+	}
+	if k, ok := tags["k"]; ok && k != keyType || !ok && keyType != "rsa" {
+		return nil, errors.New("dkim: key type does not match the algorithm")
+	}
+	if h, ok := tags["h"]; ok && !hasTagValue(h, "sha256") {
+		return nil, errors.New("dkim: key does not allow sha256")
+	}
+	if s, ok := tags["s"]; ok && !hasTagValue(s, "*") && !hasTagValue(s, "email") {
+		return nil, errors.New("dkim: key is not for email")
+	}
+
+	p := strings.Join(strings.Fields(tags["p"]), "")
+	if len(p) == 0 {
+		return nil, errors.New("dkim: key is revoked")
+	}
+	der, err := base64.StdEncoding.DecodeString(p)
+	if err != nil {
+		return nil, errors.New("dkim: key is not base64")
+	}
+
+	k := &key{testing: hasTagValue(tags["t"], "y"), strict: hasTagValue(tags["t"], "s")}
+	switch keyType {
+	case "ed25519":
+		if len(der) != ed25519.PublicKeySize {
+			return nil, errors.New("dkim: invalid Ed25519 key")
+		}
+		k.public = ed25519.PublicKey(der)
+	default:
+		public, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			// some records hold a bare PKCS #1 key
+			if public, err = x509.ParsePKCS1PublicKey(der); err != nil {
+				return nil, errors.New("dkim: invalid RSA key")
+			}
+		}
+		rsaKey, ok := public.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("dkim: key is not RSA")
+		}
+		if rsaKey.N.BitLen() < 1024 {
+			return nil, errors.New("dkim: RSA key shorter than 1024 bits")
+		}
+		k.public = rsaKey
+	}
+	return k, nil
+}
+
+// hasTagValue reports whether a colon separated tag value holds value.
+func hasTagValue(list, value string) bool {
+	for _, v := range strings.Split(list, ":") {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,242 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mel2oo/mailfile/eml"
+)
+
+// DefaultHeaders are the header fields signed when SignOptions.Headers is
+// nil, those present in the message.
+var DefaultHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc",
+	"Resent-Date", "Resent-From", "Resent-To", "Resent-Cc",
+	"In-Reply-To", "References", "Message-Id",
+	"List-Id", "List-Help", "List-Unsubscribe", "List-Subscribe", "List-Post", "List-Owner", "List-Archive",
+	"Mime-Version", "Content-Type", "Content-Transfer-Encoding",
+}
+
+// SignOptions configures a signature.
+type SignOptions struct {
+	// Domain and Selector locate the public key, at
+	// Selector._domainkey.Domain.
+	Domain   string
+	Selector string
+
+	// Signer is an *rsa.PrivateKey or an ed25519.PrivateKey.
+	Signer crypto.Signer
+
+	// HeaderCanonicalization and BodyCanonicalization are Relaxed if empty.
+	HeaderCanonicalization Canonicalization
+	BodyCanonicalization   Canonicalization
+
+	// Headers are the header fields to sign, when present, DefaultHeaders
+	// if nil. From is always signed.
+	Headers []string
+
+	// Oversign are header fields signed once more than they appear, so that
+	// fields of that name added later break the signature.
+	Oversign []string
+
+	// Identifier is the i= tag, the agent or user signing, none if empty.
+	Identifier string
+
+	// Time is the t= tag, the current time if zero.
+	Time time.Time
+
+	// Expiration is the validity of the signature from Time, forever if 0.
+	Expiration time.Duration
+}
+
+// ErrSignOptions is returned when SignOptions lack a domain, a selector or
+// a supported key.
+var ErrSignOptions = errors.New("dkim: sign options need a domain, a selector and an RSA or Ed25519 key")
+
+// SignMessage signs the output of m.WriteTo, and returns it with the
+// DKIM-Signature field prepended.
+func SignMessage(m *eml.Message, opts *SignOptions) ([]byte, error) {
+	data, err := m.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return Sign(data, opts)
+}
+
+// Sign signs a message, and returns it with the DKIM-Signature field
+// prepended.
+func Sign(data []byte, opts *SignOptions) ([]byte, error) {
+	field, err := Signature(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(field), data...), nil
+}
+
+// Signature signs a message, and returns the DKIM-Signature field, ending
+// with CRLF.
+func Signature(data []byte, opts *SignOptions) (string, error) {
+	if len(opts.Domain) == 0 || len(opts.Selector) == 0 || opts.Signer == nil {
+		return "", ErrSignOptions
+	}
+	var algorithm string
+	switch opts.Signer.Public().(type) {
+	case *rsa.PublicKey:
+		algorithm = "rsa-sha256"
+	case ed25519.PublicKey:
+		algorithm = "ed25519-sha256"
+	default:
+		return "", ErrSignOptions
+	}
+	headerCanon, bodyCanon := opts.HeaderCanonicalization, opts.BodyCanonicalization
+	if len(headerCanon) == 0 {
+		headerCanon = Relaxed
+	}
+	if len(bodyCanon) == 0 {
+		bodyCanon = Relaxed
+	}
+	signTime := opts.Time
+	if signTime.IsZero() {
+		signTime = time.Now()
+	}
+
+	fields, body := splitHeader(crlf(data))
+	bodySum := sha256.Sum256(canonicalBody(body, bodyCanon))
+	names := signedNames(fields, opts)
+
+	tags := []string{
+		"v=1",
+		"a=" + algorithm,
+		"c=" + string(headerCanon) + "/" + string(bodyCanon),
+		"d=" + opts.Domain,
+		"s=" + opts.Selector,
+	}
+	if len(opts.Identifier) > 0 {
+		tags = append(tags, "i="+opts.Identifier)
+	}
+	tags = append(tags, fmt.Sprintf("t=%d", signTime.Unix()))
+	if opts.Expiration > 0 {
+		tags = append(tags, fmt.Sprintf("x=%d", signTime.Add(opts.Expiration).Unix()))
+	}
+	tags = append(tags,
+		"h="+strings.Join(names, ":"),
+		"bh="+base64.StdEncoding.EncodeToString(bodySum[:]),
+		"b=",
+	)
+	field := foldTags(SignatureField+": ", tags)
+
+	// the signature covers the signed fields, then its own field without
+	// the value of b= and without the final line break
+	hash := sha256.New()
+	for _, f := range signedFields(fields, names) {
+		hash.Write(canonicalHeader(f, headerCanon))
+	}
+	hash.Write(bytes.TrimSuffix(canonicalHeader([]byte(field+"\r\n"), headerCanon), []byte("\r\n")))
+	sum := hash.Sum(nil)
+
+	var signature []byte
+	var err error
+	if algorithm == "rsa-sha256" {
+		signature, err = opts.Signer.Sign(rand.Reader, sum, crypto.SHA256)
+	} else {
+		signature, err = opts.Signer.Sign(rand.Reader, sum, crypto.Hash(0))
+	}
+	if err != nil {
+		return "", err
+	}
+	return field + foldBase64(base64.StdEncoding.EncodeToString(signature)) + "\r\n", nil
+}
+
+// signedNames returns the h= tag names: the fields to sign present in the
+// message, as many times as they appear, and once more if oversigned.
+func signedNames(fields [][]byte, opts *SignOptions) []string {
+	keys := opts.Headers
+	if keys == nil {
+		keys = DefaultHeaders
+	}
+	keys = append([]string{"From"}, keys...)
+
+	count := make(map[string]int)
+	for _, f := range fields {
+		count[fieldName(f)]++
+	}
+	oversign := make(map[string]bool)
+	for _, key := range opts.Oversign {
+		oversign[strings.ToLower(key)] = true
+	}
+
+	names := make([]string, 0, len(keys))
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		name := strings.ToLower(key)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		n := count[name]
+		if oversign[name] {
+			n++
+		}
+		for i := 0; i < n; i++ {
+			names = append(names, name)
+		}
+	}
+	for _, key := range opts.Oversign {
+		if name := strings.ToLower(key); !seen[name] {
+			seen[name] = true
+			for i := 0; i <= count[name]; i++ {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// foldTags joins the tags of a signature field, folding the field before a
+// tag that would go past 78 columns.
+func foldTags(prefix string, tags []string) string {
+	var b strings.Builder
+	b.WriteString(prefix)
+	lineLen := len(prefix)
+	for i, tag := range tags {
+		if i < len(tags)-1 {
+			tag += ";"
+		}
+		if i > 0 {
+			if lineLen+1+len(tag) > 78 {
+				b.WriteString("\r\n\t")
+				lineLen = 1
+			} else {
+				b.WriteString(" ")
+				lineLen++
+			}
+		}
+		b.WriteString(tag)
+		lineLen += len(tag)
+	}
+	return b.String()
+}
+
+// foldBase64 folds the value of b= on lines of its own.
+func foldBase64(s string) string {
+	var b strings.Builder
+	for len(s) > 0 {
+		n := len(s)
+		if n > 72 {
+			n = 72
+		}
+		b.WriteString("\r\n\t")
+		b.WriteString(s[:n])
+		s = s[n:]
+	}
+	return b.String()
+}
@@ -0,0 +1,330 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mel2oo/mailfile/eml"
+)
+
+// Result is the result of verifying a signature, as named in
+// Authentication-Results (RFC 8601).
+type Result string
+
+const (
+	Pass      Result = "pass"
+	Fail      Result = "fail"
+	Neutral   Result = "neutral"
+	PermError Result = "permerror"
+	TempError Result = "temperror"
+)
+
+// Verification is the result of verifying one DKIM-Signature field.
+type Verification struct {
+	Result Result `json:"result"`
+	// Err tells why the result is not Pass.
+	Err error `json:"-"`
+
+	Domain     string `json:"domain"`
+	Selector   string `json:"selector"`
+	Identifier string `json:"identifier"`
+	Algorithm  string `json:"algorithm"`
+
+	HeaderCanonicalization Canonicalization `json:"header-canonicalization"`
+	BodyCanonicalization   Canonicalization `json:"body-canonicalization"`
+
+	// Headers are the names of the signed header fields, from the h= tag.
+	Headers []string `json:"headers"`
+
+	// BodyHashMatch reports whether the body hash matches the bh= tag.
+	BodyHashMatch bool `json:"body-hash-match"`
+	// BodyLength is the l= tag, the length of the signed body, or -1.
+	BodyLength int64 `json:"body-length"`
+
+	// Time and Expiration are the t= and x= tags, zero if absent.
+	Time       time.Time `json:"time"`
+	Expiration time.Time `json:"expiration"`
+
+	// Testing is set when the key is in testing mode (t=y), in which case
+	// the result should not be relied on.
+	Testing bool `json:"testing"`
+}
+
+// VerifyOptions configures verification.
+type VerifyOptions struct {
+	// Lookup finds the key records, DNSLookup if nil.
+	Lookup KeyLookup
+
+	// Time is when signatures are checked for expiration, now if zero.
+	// Archived messages can be checked at the time they were received.
+	Time time.Time
+}
+
+var (
+	// ErrBodyHash is the error of a body that does not match the body hash.
+	ErrBodyHash = errors.New("dkim: body hash does not match")
+	// ErrSignature is the error of a signature that does not verify.
+	ErrSignature = errors.New("dkim: signature does not verify")
+	// ErrExpired is the error of a signature past its expiration.
+	ErrExpired = errors.New("dkim: signature expired")
+	// ErrBodyUnavailable is the error of a signature verified without the
+	// body, whose header signature is valid.
+	ErrBodyUnavailable = errors.New("dkim: body unavailable, only the header was verified")
+)
+
+// VerifyMessage verifies the DKIM signatures of a parsed message, written
+// back byte for byte by WriteTo.
+func VerifyMessage(m *eml.Message, opts *VerifyOptions) ([]*Verification, error) {
+	data, err := m.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return Verify(data, opts)
+}
+
+// Verify verifies the DKIM signatures of a message, one Verification per
+// DKIM-Signature field, in header order. There are none for an unsigned
+// message.
+func Verify(data []byte, opts *VerifyOptions) ([]*Verification, error) {
+	fields, body := splitHeader(crlf(data))
+	return verifyFields(fields, body, true, opts), nil
+}
+
+// VerifyHeader verifies the DKIM signatures of a header block, such as the
+// transport headers of an MSG file, with the body if it could be
+// reconstructed. Without it, a signature whose header hash is valid has a
+// Neutral result and ErrBodyUnavailable.
+func VerifyHeader(header, body []byte, opts *VerifyOptions) ([]*Verification, error) {
+	block := append(append([]byte(nil), bytes.TrimRight(header, "\r\n")...), "\r\n\r\n"...)
+	fields, _ := splitHeader(crlf(block))
+	return verifyFields(fields, crlf(body), body != nil, opts), nil
+}
+
+// verifyFields ...
+func verifyFields(fields [][]byte, body []byte, hasBody bool, opts *VerifyOptions) []*Verification {
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+	lookup := opts.Lookup
+	if lookup == nil {
+		lookup = DNSLookup{}
+	}
+	now := opts.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	verifications := make([]*Verification, 0)
+	for _, field := range fields {
+		if fieldName(field) != strings.ToLower(SignatureField) {
+			continue
+		}
+		v := &Verification{BodyLength: -1}
+		v.Result, v.Err = verifyField(v, field, fields, body, hasBody, lookup, now)
+		verifications = append(verifications, v)
+	}
+	return verifications
+}
+
+// verifyField verifies a single signature field, filling in v.
+func verifyField(v *Verification, field []byte, fields [][]byte, body []byte, hasBody bool, lookup KeyLookup, now time.Time) (Result, error) {
+	value := field[bytes.IndexByte(field, ':')+1:]
+	tags, err := parseTags(string(value))
+	if err != nil {
+		return PermError, err
+	}
+	for _, name := range []string{"v", "a", "b", "bh", "d", "h", "s"} {
+		if _, ok := tags[name]; !ok {
+			return PermError, fmt.Errorf("dkim: signature missing the %s= tag", name)
+		}
+	}
+
+	v.Domain = strings.ToLower(tags["d"])
+	v.Selector = tags["s"]
+	v.Algorithm = strings.ToLower(tags["a"])
+	v.Identifier = tags["i"]
+	if len(v.Identifier) == 0 {
+		v.Identifier = "@" + v.Domain
+	}
+	for _, name := range strings.Split(tags["h"], ":") {
+		v.Headers = append(v.Headers, strings.ToLower(strings.TrimSpace(name)))
+	}
+	v.HeaderCanonicalization, v.BodyCanonicalization = Simple, Simple
+	if c, ok := tags["c"]; ok {
+		header, body, _ := strings.Cut(strings.ToLower(c), "/")
+		v.HeaderCanonicalization = Canonicalization(header)
+		if len(body) > 0 {
+			v.BodyCanonicalization = Canonicalization(body)
+		}
+	}
+	if t, err := strconv.ParseInt(tags["t"], 10, 64); err == nil {
+		v.Time = time.Unix(t, 0)
+	}
+	if x, err := strconv.ParseInt(tags["x"], 10, 64); err == nil {
+		v.Expiration = time.Unix(x, 0)
+	}
+	if l, ok := tags["l"]; ok {
+		if v.BodyLength, err = strconv.ParseInt(l, 10, 64); err != nil || v.BodyLength < 0 {
+			return PermError, errors.New("dkim: invalid l= tag")
+		}
+	}
+
+	if tags["v"] != "1" {
+		return PermError, errors.New("dkim: unsupported signature version")
+	}
+	var keyType string
+	switch v.Algorithm {
+	case "rsa-sha256":
+		keyType = "rsa"
+	case "ed25519-sha256":
+		keyType = "ed25519"
+	default:
+		return PermError, fmt.Errorf("dkim: unsupported algorithm %q", v.Algorithm)
+	}
+	for _, c := range []Canonicalization{v.HeaderCanonicalization, v.BodyCanonicalization} {
+		if c != Simple && c != Relaxed {
+			return PermError, fmt.Errorf("dkim: unsupported canonicalization %q", c)
+		}
+	}
+	if !hasTagValue(tags["h"], "from") {
+		return PermError, errors.New("dkim: From is not signed")
+	}
+	identityDomain := strings.ToLower(v.Identifier[strings.LastIndexByte(v.Identifier, '@')+1:])
+	if identityDomain != v.Domain && !strings.HasSuffix(identityDomain, "."+v.Domain) {
+		return PermError, errors.New("dkim: i= is not in the d= domain")
+	}
+	if !v.Expiration.IsZero() && v.Expiration.Before(now) {
+		return PermError, ErrExpired
+	}
+	if q, ok := tags["q"]; ok && !hasTagValue(q, "dns/txt") {
+		return PermError, errors.New("dkim: unsupported query method")
+	}
+
+	// the key
+	records, err := lookup.LookupTXT(v.Selector + "._domainkey." + v.Domain)
+	if err == ErrKeyNotFound {
+		return PermError, err
+	} else if err != nil {
+		return TempError, err
+	}
+	var k *key
+	for _, record := range records {
+		if k, err = parseKey(record, keyType); err == nil {
+			break
+		}
+	}
+	if k == nil {
+		if err == nil {
+			err = ErrKeyNotFound
+		}
+		return PermError, err
+	}
+	v.Testing = k.testing
+	if k.strict && identityDomain != v.Domain {
+		return PermError, errors.New("dkim: key requires i= in the d= domain exactly")
+	}
+
+	// the body hash
+	bodyHash, err := base64.StdEncoding.DecodeString(stripSpace(tags["bh"]))
+	if err != nil {
+		return PermError, errors.New("dkim: invalid bh= tag")
+	}
+	if hasBody {
+		canonical := canonicalBody(body, v.BodyCanonicalization)
+		if v.BodyLength >= 0 {
+			if v.BodyLength > int64(len(canonical)) {
+				return PermError, errors.New("dkim: l= is longer than the body")
+			}
+			canonical = canonical[:v.BodyLength]
+		}
+		sum := sha256.Sum256(canonical)
+		v.BodyHashMatch = bytes.Equal(sum[:], bodyHash)
+	}
+
+	// the header hash
+	signature, err := base64.StdEncoding.DecodeString(stripSpace(tags["b"]))
+	if err != nil {
+		return PermError, errors.New("dkim: invalid b= tag")
+	}
+	hash := sha256.New()
+	for _, f := range signedFields(withoutField(fields, field), v.Headers) {
+		hash.Write(canonicalHeader(f, v.HeaderCanonicalization))
+	}
+	unsigned := expSignatureValue.ReplaceAll(field, []byte("${1}"))
+	hash.Write(bytes.TrimSuffix(canonicalHeader(unsigned, v.HeaderCanonicalization), []byte("\r\n")))
+	sum := hash.Sum(nil)
+
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(public, crypto.SHA256, sum, signature)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(public, sum, signature) {
+			err = ErrSignature
+		}
+	}
+	switch {
+	case err != nil:
+		return Fail, ErrSignature
+	case !hasBody:
+		return Neutral, ErrBodyUnavailable
+	case !v.BodyHashMatch:
+		return Fail, ErrBodyHash
+	}
+	return Pass, nil
+}
+
+// expSignatureValue matches the value of the b= tag of a signature field,
+// which is removed to verify it. The first tag follows the field name.
+var expSignatureValue = regexp.MustCompile(`((?:^[^:]*:|;)[ \t\r\n]*b[ \t\r\n]*=)[^;]*`)
+
+// withoutField returns fields without the signature field being verified,
+// which may also be named in h= to sign other signatures.
+func withoutField(fields [][]byte, field []byte) [][]byte {
+	others := make([][]byte, 0, len(fields))
+	for _, f := range fields {
+		if &f[0] != &field[0] {
+			others = append(others, f)
+		}
+	}
+	return others
+}
+
+// parseTags parses a tag list (RFC 6376, section 3.2).
+func parseTags(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, spec := range strings.Split(s, ";") {
+		if len(strings.TrimSpace(spec)) == 0 {
+			continue
+		}
+		name, value, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("dkim: invalid tag %q", strings.TrimSpace(spec))
+		}
+		name = strings.TrimSpace(name)
+		if _, dup := tags[name]; dup {
+			return nil, fmt.Errorf("dkim: duplicate tag %q", name)
+		}
+		tags[name] = strings.Trim(value, " \t\r\n")
+	}
+	return tags, nil
+}
+
+// stripSpace removes the folding white space of a tag value.
+func stripSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, s)
+}
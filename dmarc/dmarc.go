@@ -0,0 +1,372 @@
+// Package dmarc evaluates the DMARC policy (RFC 7489) of the author domain of
+// a message from its SPF and DKIM results, explaining why the identifiers do
+// or do not align with the From domain.
+package dmarc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/mel2oo/mailfile"
+	"github.com/mel2oo/mailfile/dkim"
+	"github.com/mel2oo/mailfile/spf"
+)
+
+// Result is the result of a DMARC evaluation.
+type Result string
+
+const (
+	Pass      Result = "pass"
+	Fail      Result = "fail"
+	None      Result = "none"
+	TempError Result = "temperror"
+	PermError Result = "permerror"
+)
+
+// Policy is what the domain owner asks receivers to do with failing messages.
+type Policy string
+
+const (
+	PolicyNone Policy = "none"
+	Quarantine Policy = "quarantine"
+	Reject     Policy = "reject"
+)
+
+// Alignment is the identifier alignment mode of the adkim= and aspf= tags.
+type Alignment string
+
+const (
+	Relaxed Alignment = "r"
+	Strict  Alignment = "s"
+)
+
+// Resolver looks up the TXT records of DMARC policies. spf.Zone, dkim.Keys
+// and spf.DNSResolver are resolvers.
+type Resolver interface {
+	LookupTXT(name string) ([]string, error)
+}
+
+// Options configures an evaluation.
+type Options struct {
+	// Lookup finds the policy records, DNS if nil.
+	Lookup Resolver
+	// Suffixes finds organizational domains, PublicSuffixes if nil.
+	Suffixes *SuffixList
+}
+
+// Record is a parsed DMARC policy record.
+type Record struct {
+	Policy          Policy    `json:"p"`
+	SubdomainPolicy Policy    `json:"sp"`
+	DKIMAlignment   Alignment `json:"adkim"`
+	SPFAlignment    Alignment `json:"aspf"`
+	Percent         int       `json:"pct"`
+
+	// AggregateReports and FailureReports are the rua= and ruf= URIs.
+	AggregateReports []string `json:"rua"`
+	FailureReports   []string `json:"ruf"`
+	FailureOptions   string   `json:"fo"`
+}
+
+// Evaluation is the result of evaluating the DMARC policy of a message.
+type Evaluation struct {
+	Result Result `json:"result"`
+	// Err tells why the result is TempError or PermError.
+	Err error `json:"-"`
+
+	FromDomain           string `json:"from-domain"`
+	OrganizationalDomain string `json:"organizational-domain"`
+
+	// Record is the policy found at RecordDomain, the From domain or its
+	// organizational domain.
+	Record       *Record `json:"record"`
+	RecordDomain string  `json:"record-domain"`
+
+	// Policy is the policy that applies to the From domain, p= or sp= of
+	// the record.
+	Policy Policy `json:"policy"`
+	// Disposition is the policy applied to the message: Policy if it
+	// fails, PolicyNone otherwise.
+	Disposition Policy `json:"disposition"`
+
+	SPFAligned  bool `json:"spf-aligned"`
+	DKIMAligned bool `json:"dkim-aligned"`
+
+	// Reasons explain the result, one line per identifier checked.
+	Reasons []string `json:"reasons"`
+}
+
+// ErrNoFrom is the error of a message without a single From domain.
+var ErrNoFrom = errors.New("dmarc: no single From domain")
+
+// EvaluateMessage evaluates the DMARC policy of a normalized message from
+// its SPF outcome and DKIM verifications, either may be nil. The result is
+// appended to msg.Auth.
+func EvaluateMessage(msg *mailfile.Message, spfOutcome *spf.Outcome, verifications []*dkim.Verification, opts *Options) *Evaluation {
+	var from string
+	for _, addr := range msg.From {
+		domain := normalizeDomain(addr.Address[strings.LastIndexByte(addr.Address, '@')+1:])
+		if len(from) > 0 && domain != from {
+			from = ""
+			break
+		}
+		from = domain
+	}
+
+	var e *Evaluation
+	if len(from) == 0 {
+		e = &Evaluation{Result: PermError, Err: ErrNoFrom}
+	} else {
+		e = Evaluate(from, spfOutcome, verifications, opts)
+	}
+
+	reason := strings.Join(e.Reasons, "; ")
+	if e.Err != nil {
+		reason = e.Err.Error()
+	}
+	msg.Auth = append(msg.Auth, mailfile.AuthResult{
+		Method: "dmarc",
+		Result: string(e.Result),
+		Reason: reason,
+		Properties: map[string]string{
+			"header.from":  e.FromDomain,
+			"policy.dmarc": string(e.Policy),
+		},
+	})
+	return e
+}
+
+// Evaluate evaluates the DMARC policy of the From domain, or of the domain of
+// a From address, from the SPF outcome and DKIM verifications of a message.
+func Evaluate(from string, spfOutcome *spf.Outcome, verifications []*dkim.Verification, opts *Options) *Evaluation {
+	if opts == nil {
+		opts = &Options{}
+	}
+	lookup := opts.Lookup
+	if lookup == nil {
+		lookup = spf.DNSResolver{}
+	}
+	suffixes := opts.Suffixes
+	if suffixes == nil {
+		suffixes = PublicSuffixes
+	}
+
+	from = normalizeDomain(from[strings.LastIndexByte(from, '@')+1:])
+	e := &Evaluation{
+		FromDomain:           from,
+		OrganizationalDomain: suffixes.OrganizationalDomain(from),
+		Policy:               PolicyNone,
+		Disposition:          PolicyNone,
+		Reasons:              make([]string, 0),
+	}
+	if len(from) == 0 {
+		e.Result, e.Err = PermError, ErrNoFrom
+		return e
+	}
+
+	// the policy, at the From domain or else at its organizational domain
+	record, err := lookupRecord(lookup, from)
+	e.RecordDomain = from
+	if record == nil && err == nil && len(e.OrganizationalDomain) > 0 && e.OrganizationalDomain != from {
+		record, err = lookupRecord(lookup, e.OrganizationalDomain)
+		e.RecordDomain = e.OrganizationalDomain
+	}
+	switch {
+	case err == errTemporary:
+		e.Result, e.Err = TempError, fmt.Errorf("dmarc: looking up the policy of %s failed", e.RecordDomain)
+		return e
+	case err != nil:
+		e.Result, e.Err = PermError, err
+		return e
+	case record == nil:
+		e.Result, e.RecordDomain = None, ""
+		e.Reasons = append(e.Reasons, fmt.Sprintf("no DMARC record at %s or its organizational domain", from))
+		return e
+	}
+	e.Record = record
+	e.Policy = record.Policy
+	if e.RecordDomain != from && len(record.SubdomainPolicy) > 0 {
+		e.Policy = record.SubdomainPolicy
+	}
+
+	// SPF
+	switch {
+	case spfOutcome == nil:
+		e.Reasons = append(e.Reasons, "no SPF result")
+	case spfOutcome.Result != spf.Pass:
+		e.Reasons = append(e.Reasons, fmt.Sprintf("SPF is %s for %s, it cannot align", spfOutcome.Result, spfOutcome.Sender))
+	default:
+		domain := normalizeDomain(spfOutcome.Sender[strings.LastIndexByte(spfOutcome.Sender, '@')+1:])
+		e.SPFAligned = aligned(suffixes, domain, from, record.SPFAlignment)
+		e.Reasons = append(e.Reasons, alignmentReason("SPF pass for "+domain, domain, from, record.SPFAlignment, e.SPFAligned))
+	}
+
+	// DKIM
+	signed := false
+	for _, v := range verifications {
+		if v == nil {
+			continue
+		}
+		signed = true
+		if v.Result != dkim.Pass {
+			e.Reasons = append(e.Reasons, fmt.Sprintf("DKIM signature d=%s is %s, it cannot align", v.Domain, v.Result))
+			continue
+		}
+		ok := aligned(suffixes, v.Domain, from, record.DKIMAlignment)
+		e.DKIMAligned = e.DKIMAligned || ok
+		e.Reasons = append(e.Reasons, alignmentReason("DKIM signature d="+v.Domain, v.Domain, from, record.DKIMAlignment, ok))
+	}
+	if !signed {
+		e.Reasons = append(e.Reasons, "no DKIM signature")
+	}
+
+	if e.SPFAligned || e.DKIMAligned {
+		e.Result = Pass
+		return e
+	}
+	e.Result, e.Disposition = Fail, e.Policy
+	if record.Percent < 100 {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("policy %s applies to %d%% of failing messages", e.Policy, record.Percent))
+	}
+	return e
+}
+
+// aligned reports whether an authenticated domain aligns with the From
+// domain (RFC 7489, section 3.1).
+func aligned(suffixes *SuffixList, domain, from string, mode Alignment) bool {
+	domain = normalizeDomain(domain)
+	if mode == Strict {
+		return domain == from
+	}
+	org := suffixes.OrganizationalDomain(domain)
+	return len(org) > 0 && org == suffixes.OrganizationalDomain(from)
+}
+
+// alignmentReason explains the alignment of a domain.
+func alignmentReason(subject, domain, from string, mode Alignment, ok bool) string {
+	modeName := "relaxed"
+	if mode == Strict {
+		modeName = "strict"
+	}
+	if ok {
+		return fmt.Sprintf("%s is aligned with From domain %s (%s)", subject, from, modeName)
+	}
+	if mode == Strict && !strings.EqualFold(domain, from) {
+		return fmt.Sprintf("%s is not aligned with From domain %s (strict, the domains differ)", subject, from)
+	}
+	return fmt.Sprintf("%s is not aligned with From domain %s (%s, the organizational domains differ)", subject, from, modeName)
+}
+
+// errTemporary is the error of a policy lookup that may succeed later.
+var errTemporary = errors.New("dmarc: temporary lookup failure")
+
+// lookupRecord returns the policy record of a domain, nil if there is none or
+// more than one.
+func lookupRecord(lookup Resolver, domain string) (*Record, error) {
+	txts, err := lookup.LookupTXT("_dmarc." + domain)
+	if err != nil {
+		if notFound(err) {
+			return nil, nil
+		}
+		return nil, errTemporary
+	}
+	var records []string
+	for _, txt := range txts {
+		if version, _, _ := strings.Cut(txt, ";"); strings.EqualFold(stripSpace(version), "v=DMARC1") {
+			records = append(records, txt)
+		}
+	}
+	if len(records) != 1 {
+		return nil, nil
+	}
+	return ParseRecord(records[0])
+}
+
+// notFound reports whether a resolver error means the name has no record.
+func notFound(err error) bool {
+	if dnsErr, ok := err.(*net.DNSError); ok {
+		return dnsErr.IsNotFound
+	}
+	return err == spf.ErrNotFound || err == dkim.ErrKeyNotFound
+}
+
+// ParseRecord parses a DMARC policy record (RFC 7489, section 6.3).
+func ParseRecord(txt string) (*Record, error) {
+	r := &Record{DKIMAlignment: Relaxed, SPFAlignment: Relaxed, Percent: 100, FailureOptions: "0"}
+	var hasPolicy bool
+	for i, spec := range strings.Split(txt, ";") {
+		spec = strings.TrimSpace(spec)
+		if len(spec) == 0 {
+			continue
+		}
+		name, value, ok := strings.Cut(spec, "=")
+		name, value = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(value)
+		if !ok {
+			return nil, fmt.Errorf("dmarc: invalid tag %q", spec)
+		}
+		if i == 0 {
+			if name != "v" || value != "DMARC1" {
+				return nil, errors.New("dmarc: record does not start with v=DMARC1")
+			}
+			continue
+		}
+		switch name {
+		case "p", "sp":
+			policy := Policy(strings.ToLower(value))
+			if policy != PolicyNone && policy != Quarantine && policy != Reject {
+				return nil, fmt.Errorf("dmarc: invalid %s= policy %q", name, value)
+			}
+			if name == "p" {
+				r.Policy, hasPolicy = policy, true
+			} else {
+				r.SubdomainPolicy = policy
+			}
+		case "adkim", "aspf":
+			mode := Alignment(strings.ToLower(value))
+			if mode != Relaxed && mode != Strict {
+				return nil, fmt.Errorf("dmarc: invalid %s= mode %q", name, value)
+			}
+			if name == "adkim" {
+				r.DKIMAlignment = mode
+			} else {
+				r.SPFAlignment = mode
+			}
+		case "pct":
+			pct, err := strconv.Atoi(value)
+			if err != nil || pct < 0 || pct > 100 {
+				return nil, fmt.Errorf("dmarc: invalid pct= %q", value)
+			}
+			r.Percent = pct
+		case "rua", "ruf":
+			var uris []string
+			for _, uri := range strings.Split(value, ",") {
+				if uri = strings.TrimSpace(uri); len(uri) > 0 {
+					uris = append(uris, uri)
+				}
+			}
+			if name == "rua" {
+				r.AggregateReports = uris
+			} else {
+				r.FailureReports = uris
+			}
+		case "fo":
+			r.FailureOptions = value
+		}
+	}
+	if !hasPolicy {
+		// a record with reporting URIs but no policy is read as p=none
+		if len(r.AggregateReports) == 0 {
+			return nil, errors.New("dmarc: record has no p= policy")
+		}
+		r.Policy = PolicyNone
+	}
+	return r, nil
+}
+
+// stripSpace ...
+func stripSpace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
@@ -0,0 +1,89 @@
+package dmarc
+
+import (
+	"bufio"
+	_ "embed"
+	"io"
+	"strings"
+)
+
+//go:embed public_suffix_list.dat
+var publicSuffixList string
+
+// SuffixList is a list of public suffixes in the format of the Public Suffix
+// List, used to find organizational domains.
+type SuffixList struct {
+	rules      map[string]bool // the suffixes, with wildcards as "*.name"
+	exceptions map[string]bool // the "!name" exceptions to wildcards
+}
+
+// PublicSuffixes is the list embedded in the package, a copy of the Public
+// Suffix List with its ICANN and private domains. A newer copy can be loaded
+// with ParseSuffixList.
+var PublicSuffixes = mustParseSuffixList(publicSuffixList)
+
+// ParseSuffixList reads a list in the format of the Public Suffix List: one
+// rule per line, with comments starting with "//".
+func ParseSuffixList(r io.Reader) (*SuffixList, error) {
+	l := &SuffixList{rules: make(map[string]bool), exceptions: make(map[string]bool)}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+		rule := strings.ToLower(fields[0])
+		if strings.HasPrefix(rule, "!") {
+			l.exceptions[rule[1:]] = true
+		} else {
+			l.rules[rule] = true
+		}
+	}
+	return l, scanner.Err()
+}
+
+// mustParseSuffixList ...
+func mustParseSuffixList(s string) *SuffixList {
+	l, err := ParseSuffixList(strings.NewReader(s))
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// PublicSuffix returns the public suffix of a domain, by the longest matching
+// rule, or its last label if no rule matches.
+func (l *SuffixList) PublicSuffix(domain string) string {
+	labels := strings.Split(normalizeDomain(domain), ".")
+	for i := range labels {
+		name := strings.Join(labels[i:], ".")
+		if l.exceptions[name] {
+			return strings.Join(labels[i+1:], ".")
+		}
+		if l.rules[name] {
+			return name
+		}
+		if i+1 < len(labels) && l.rules["*."+strings.Join(labels[i+1:], ".")] {
+			return name
+		}
+	}
+	return labels[len(labels)-1]
+}
+
+// OrganizationalDomain returns the organizational domain of a domain: its
+// public suffix and one more label (RFC 7489, section 3.2). It is empty for a
+// domain that is itself a public suffix.
+func (l *SuffixList) OrganizationalDomain(domain string) string {
+	domain = normalizeDomain(domain)
+	suffix := l.PublicSuffix(domain)
+	if domain == suffix || !strings.HasSuffix(domain, "."+suffix) {
+		return ""
+	}
+	rest := domain[:len(domain)-len(suffix)-1]
+	return rest[strings.LastIndexByte(rest, '.')+1:] + "." + suffix
+}
+
+// normalizeDomain ...
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.Trim(strings.TrimSpace(domain), "."))
+}
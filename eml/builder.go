@@ -0,0 +1,237 @@
+package eml
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Builder composes a Message: a text and an HTML body, inline images
+// referenced from the HTML, attachments and forwarded messages are laid out
+// in the multipart/alternative, multipart/related and multipart/mixed parts
+// they belong in.
+//
+//	m, err := eml.NewBuilder().
+//		From("alice@example.com").
+//		To("bob@example.com").
+//		Subject("hello").
+//		Text([]byte("hello")).
+//		Build()
+type Builder struct {
+	header      Header
+	date        time.Time
+	text        []byte
+	html        []byte
+	inlines     []*Message
+	attachments []*Message
+	err         error
+}
+
+// NewBuilder returns an empty Builder.
+func NewBuilder() *Builder {
+	return &Builder{header: Header{}}
+}
+
+// From sets the From address.
+func (b *Builder) From(address string) *Builder {
+	b.header.SetFrom(address)
+	return b
+}
+
+// To sets the To addresses.
+func (b *Builder) To(addresses ...string) *Builder {
+	b.header.SetTo(addresses...)
+	return b
+}
+
+// Cc sets the Cc addresses.
+func (b *Builder) Cc(addresses ...string) *Builder {
+	b.header.SetCc(addresses...)
+	return b
+}
+
+// Bcc sets the Bcc addresses, which are not written out.
+func (b *Builder) Bcc(addresses ...string) *Builder {
+	b.header.SetBcc(addresses...)
+	return b
+}
+
+// ReplyTo sets the Reply-To addresses.
+func (b *Builder) ReplyTo(addresses ...string) *Builder {
+	b.header.Set("Reply-To", strings.Join(addresses, ", "))
+	return b
+}
+
+// Subject sets the Subject.
+func (b *Builder) Subject(subject string) *Builder {
+	b.header.SetSubject(subject)
+	return b
+}
+
+// Date sets the Date, which is the time of Build by default.
+func (b *Builder) Date(date time.Time) *Builder {
+	b.date = date
+	return b
+}
+
+// AddHeader adds a header field, such as "X-Mailer" or "In-Reply-To".
+func (b *Builder) AddHeader(key, value string) *Builder {
+	b.header.Add(key, value)
+	return b
+}
+
+// Text sets the text/plain body.
+func (b *Builder) Text(body []byte) *Builder {
+	b.text = body
+	return b
+}
+
+// HTML sets the text/html body. Together with a text body, it makes a
+// multipart/alternative message.
+func (b *Builder) HTML(body []byte) *Builder {
+	b.html = body
+	return b
+}
+
+// Inline adds an image, or any other content, displayed by the HTML body,
+// and returns the Content-ID to reference it with, as in
+// <img src="cid:{{id}}">. The content type is guessed from the filename if
+// it is empty.
+func (b *Builder) Inline(filename, contentType string, data []byte) string {
+	id, err := GenContentID(contentIDName(filename))
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+	part := newFilePart("inline", filename, contentType, data)
+	part.Header.Set("Content-Id", "<"+id+">")
+	b.inlines = append(b.inlines, part)
+	return id
+}
+
+// Attach adds an attachment. The content type is guessed from the filename
+// if it is empty.
+func (b *Builder) Attach(filename, contentType string, data []byte) *Builder {
+	b.attachments = append(b.attachments, newFilePart("attachment", filename, contentType, data))
+	return b
+}
+
+// Forward attaches a message as message/rfc822.
+func (b *Builder) Forward(m *Message) *Builder {
+	part := &Message{Header: Header{}, SubMessage: m}
+	part.Header.Set("Content-Type", "message/rfc822")
+	if subject := m.Header.Subject(); len(subject) > 0 {
+		part.Header.Set("Content-Description", subject)
+	}
+	b.attachments = append(b.attachments, part)
+	return b
+}
+
+// Build returns the composed message, with its Message-Id, Date and
+// MIME-Version set by Save, once validated.
+func (b *Builder) Build() (*Message, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	var body *Message
+	switch {
+	case len(b.html) > 0:
+		body = newTextPart("text/html", b.html)
+		if len(b.inlines) > 0 {
+			body = b.newMultipart("multipart/related", append([]*Message{body}, b.inlines...))
+		}
+		if len(b.text) > 0 {
+			body = b.newMultipart("multipart/alternative", []*Message{newTextPart("text/plain", b.text), body})
+		}
+	default:
+		body = newTextPart("text/plain", b.text)
+		if len(b.inlines) > 0 {
+			body = b.newMultipart("multipart/related", append([]*Message{body}, b.inlines...))
+		}
+	}
+	if len(b.attachments) > 0 {
+		body = b.newMultipart("multipart/mixed", append([]*Message{body}, b.attachments...))
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	// the body part becomes the message, under the header built
+	for key, values := range b.header {
+		body.Header[key] = append([]string(nil), values...)
+	}
+	date := b.date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	body.Header.Set("Date", date.Format(time.RFC1123Z))
+	if err := body.Save(); err != nil {
+		return nil, err
+	}
+	if err := body.Validate(); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// newTextPart returns a UTF-8 text part.
+func newTextPart(mediaType string, body []byte) *Message {
+	part := &Message{Header: Header{}, Body: body}
+	part.Header.Set("Content-Type", mime.FormatMediaType(mediaType, map[string]string{"charset": "utf-8"}))
+	return part
+}
+
+// newFilePart returns a part holding a file. The filename is RFC 2231
+// encoded if it is not ASCII.
+func newFilePart(disposition, filename, contentType string, data []byte) *Message {
+	if len(contentType) == 0 {
+		contentType = mime.TypeByExtension(filepath.Ext(filename))
+	}
+	if len(contentType) == 0 {
+		contentType = "application/octet-stream"
+	}
+	part := &Message{Header: Header{}, Body: data}
+	part.Header.Set("Content-Type", contentType)
+	if len(filename) > 0 {
+		part.Header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+	} else {
+		part.Header.Set("Content-Disposition", disposition)
+	}
+	return part
+}
+
+// newMultipart returns a multipart part, with a new boundary. An error
+// generating it is kept to be returned by Build.
+func (b *Builder) newMultipart(mediaType string, parts []*Message) *Message {
+	part := &Message{Header: Header{}, Parts: parts}
+	boundary, err := genBoundary()
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+	part.Header.Set("Content-Type", mime.FormatMediaType(mediaType, map[string]string{"boundary": boundary}))
+	return part
+}
+
+// genBoundary returns a random multipart boundary.
+func genBoundary() (string, error) {
+	var buf [24]byte
+	if _, err := io.ReadFull(rand.Reader, buf[:]); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", buf[:]), nil
+}
+
+// contentIDName returns the characters of a filename allowed in a Content-ID.
+func contentIDName(filename string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return -1
+	}, filename)
+}
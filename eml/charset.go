@@ -0,0 +1,157 @@
+package eml
+
+import (
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/mel2oo/mailfile"
+	"github.com/mel2oo/mailfile/charset"
+)
+
+// metaCharsetLimit is how far into an HTML body a <meta> charset is searched for.
+const metaCharsetLimit = 4096
+
+// expMetaCharset matches both <meta charset="x"> and
+// <meta http-equiv="Content-Type" content="text/html; charset=x">.
+var expMetaCharset = regexp.MustCompile(`(?i)<meta[^>]*?charset\s*=\s*["']?\s*([a-z0-9_.:-]+)`)
+
+// decodeText converts the body of a text part to UTF-8. The charset parameter
+// of the Content-Type is tried first, then for HTML a <meta> charset, and only
+// if those are missing or do not decode the body is the charset detected.
+// It returns the converted text and the charset that was used.
+func decodeText(body []byte, params map[string]string, isHTML bool) ([]byte, string) {
+	candidates := make([]string, 0, 2)
+	if declared := mailfile.NormalizeCharset(params["charset"]); len(declared) > 0 {
+		candidates = append(candidates, declared)
+	}
+	if isHTML {
+		if meta := metaCharset(body); len(meta) > 0 {
+			candidates = append(candidates, meta)
+		}
+	}
+
+	// 8-bit text that is valid UTF-8 is almost never in another charset,
+	// so such a body is taken as mislabelled UTF-8
+	if !isASCII(body) && utf8.Valid(body) {
+		return body, "utf-8"
+	}
+
+	var (
+		fallback     []byte
+		fallbackName string
+	)
+	for _, name := range candidates {
+		text, ok := convertText(body, name)
+		if !ok {
+			continue
+		}
+		if plausible(body, name) {
+			return text, name
+		}
+		if fallback == nil {
+			fallback, fallbackName = text, name
+		}
+	}
+
+	// the declared charset is missing or wrong
+	for _, guess := range charset.Detect(body) {
+		if text, ok := convertText(body, guess.Charset); ok {
+			return text, guess.Charset
+		}
+	}
+	if fallback != nil {
+		return fallback, fallbackName
+	}
+	if len(candidates) > 0 {
+		return body, candidates[0]
+	}
+	return body, ""
+}
+
+// plausible reports whether body may be in the declared charset name. Single
+// byte charsets decode any body, so a declaration is only refused when the
+// detector is confident of another charset.
+func plausible(body []byte, name string) bool {
+	confidence, known := charset.Confidence(body, name)
+	if !known {
+		return true
+	}
+	guesses := charset.Detect(body)
+	if len(guesses) == 0 || guesses[0].Confidence < 0.5 {
+		return true
+	}
+	return confidence*2 >= guesses[0].Confidence
+}
+
+// convertText converts body from charset, reporting false if the charset is
+// unknown or the body is not valid in it.
+func convertText(body []byte, name string) ([]byte, bool) {
+	switch name {
+	case "utf-8":
+		return body, utf8.Valid(body)
+	case "us-ascii":
+		return body, isASCII(body)
+	}
+
+	text, err := mailfile.ConvertData(body, name)
+	if err != nil || !utf8.ValidString(text) {
+		return nil, false
+	}
+	return []byte(text), true
+}
+
+// metaCharset returns the normalized charset declared by an HTML <meta> tag.
+func metaCharset(body []byte) string {
+	if len(body) > metaCharsetLimit {
+		body = body[:metaCharsetLimit]
+	}
+	match := expMetaCharset.FindSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	return mailfile.NormalizeCharset(string(match[1]))
+}
+
+// isASCII ...
+func isASCII(data []byte) bool {
+	for _, c := range data {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeRawHeader converts header values holding raw 8-bit text to UTF-8. The
+// charset is detected once over all such values of the header, as a single
+// value is often too short to tell.
+func decodeRawHeader(header Header) {
+	var raw []byte
+	for _, values := range header {
+		for _, val := range values {
+			if !utf8.ValidString(val) {
+				raw = append(append(raw, val...), '\n')
+			}
+		}
+	}
+	if len(raw) == 0 {
+		return
+	}
+
+	for _, guess := range charset.Detect(raw) {
+		if _, ok := convertText(raw, guess.Charset); !ok {
+			continue
+		}
+		for _, values := range header {
+			for idx, val := range values {
+				if utf8.ValidString(val) {
+					continue
+				}
+				if text, ok := convertText([]byte(val), guess.Charset); ok {
+					values[idx] = string(text)
+				}
+			}
+		}
+		return
+	}
+}
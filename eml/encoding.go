@@ -15,13 +15,14 @@ func IsGBK(data []byte) bool {
 
 	var i int
 	for i < len(data) {
-		if data[i] <= 0xff {
+		if data[i] <= 0x7f {
 			// 编码小于等于127,只有一个字节的编码，兼容ASCII
 			i++
 			continue
 		} else {
 			// 大于127的使用双字节编码
-			if data[i] >= 0x81 &&
+			if i+1 < len(data) &&
+				data[i] >= 0x81 &&
 				data[i] <= 0xfe &&
 				data[i+1] >= 0x40 &&
 				data[i+1] <= 0xfe &&
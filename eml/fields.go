@@ -0,0 +1,219 @@
+package eml
+
+import (
+	"bytes"
+	"io"
+	"net/textproto"
+	"strings"
+)
+
+// Field is a single header field, as it appears in the message.
+type Field struct {
+	// Name is the field name as written, such as "Content-type".
+	Name string
+
+	// Raw is the field exactly as read, from the name to the line break
+	// ending it, folding included. It is nil for fields set after parsing.
+	Raw []byte
+
+	// Value is the unfolded value, decoded the same way as in Header.
+	Value string
+}
+
+// Key returns the canonical form of the field name, as used by Header.
+func (f *Field) Key() string {
+	return textproto.CanonicalMIMEHeaderKey(f.Name)
+}
+
+// Fields is the header of a message as an ordered list of fields. Unlike
+// Header, it keeps the order the fields appear in, which matters for
+// Received chains and DKIM signatures, and the raw bytes of each field, so
+// that a parsed header can be written back byte for byte.
+type Fields []*Field
+
+// Get gets the first value associated with the given key.
+// If there are no values associated with the key, Get returns "".
+func (fs Fields) Get(key string) string {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	for _, f := range fs {
+		if f.Key() == key {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Values returns all values associated with the given key, in header order.
+func (fs Fields) Values(key string) []string {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	values := make([]string, 0)
+	for _, f := range fs {
+		if f.Key() == key {
+			values = append(values, f.Value)
+		}
+	}
+	return values
+}
+
+// IsSet tests if a key is present in the Fields.
+func (fs Fields) IsSet(key string) bool {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	for _, f := range fs {
+		if f.Key() == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Names returns the field names as written, in header order.
+func (fs Fields) Names() []string {
+	names := make([]string, 0, len(fs))
+	for _, f := range fs {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// Add adds the key, value pair after the last field.
+func (fs *Fields) Add(key, value string) {
+	*fs = append(*fs, &Field{Name: textproto.CanonicalMIMEHeaderKey(key), Value: value})
+}
+
+// Set replaces the first field associated with key by the single value,
+// keeping its position, and deletes the other fields with that key.
+// The field is added after the last one if the key is not present.
+func (fs *Fields) Set(key, value string) {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	set := false
+	fields := (*fs)[:0]
+	for _, f := range *fs {
+		if f.Key() != key {
+			fields = append(fields, f)
+		} else if !set {
+			fields = append(fields, &Field{Name: key, Value: value})
+			set = true
+		}
+	}
+	*fs = fields
+	if !set {
+		fs.Add(key, value)
+	}
+}
+
+// Del deletes the fields associated with key.
+func (fs *Fields) Del(key string) {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	fields := (*fs)[:0]
+	for _, f := range *fs {
+		if f.Key() != key {
+			fields = append(fields, f)
+		}
+	}
+	*fs = fields
+}
+
+// Header returns the fields as a Header map.
+func (fs Fields) Header() Header {
+	h := Header{}
+	for _, f := range fs {
+		h[f.Key()] = append(h[f.Key()], f.Value)
+	}
+	return h
+}
+
+// setValues sets the value of each field to the matching value of h, which
+// holds the same fields, in the same order for a given key.
+func (fs Fields) setValues(h Header) {
+	seen := make(map[string]int)
+	for _, f := range fs {
+		key := f.Key()
+		if values := h[key]; seen[key] < len(values) {
+			f.Value = values[seen[key]]
+		}
+		seen[key]++
+	}
+}
+
+// Bytes returns the bytes representing these fields.  It is a convenience
+// method that calls WriteTo on a buffer, returning its bytes.
+func (fs Fields) Bytes() ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	_, err := fs.WriteTo(buffer)
+	return buffer.Bytes(), err
+}
+
+// WriteTo writes the fields out in order, parsed fields with their raw
+// bytes and the others encoded like Header.WriteTo does. The blank line
+// ending the header is not written.
+func (fs Fields) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, f := range fs {
+		var written int64
+		var err error
+		if f.Raw != nil {
+			var n int
+			n, err = w.Write(f.Raw)
+			written = int64(n)
+		} else {
+			written, err = writeField(w, f.Name, f.Value)
+		}
+		total += written
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// splitFields splits a raw header block into its fields. A line starting
+// with a space or a tab continues the previous field, any other line starts
+// a new one. The blank line ending the block is not part of any field.
+func splitFields(block []byte) Fields {
+	fields := make(Fields, 0)
+	for len(block) > 0 {
+		end := bytes.IndexByte(block, '\n') + 1
+		if end == 0 {
+			end = len(block)
+		}
+		line := block[:end]
+		block = block[end:]
+
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			break
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			last := fields[len(fields)-1]
+			last.Raw = append(last.Raw, line...)
+			continue
+		}
+
+		name := line
+		if idx := bytes.IndexByte(line, ':'); idx >= 0 {
+			name = line[:idx]
+		}
+		fields = append(fields, &Field{
+			Name: strings.TrimSpace(string(name)),
+			Raw:  append([]byte(nil), line...),
+		})
+	}
+
+	for _, f := range fields {
+		value := f.Raw
+		if idx := bytes.IndexByte(value, ':'); idx >= 0 {
+			value = value[idx+1:]
+		}
+		f.Value = textproto.TrimString(unfoldValue(string(value)))
+	}
+	return fields
+}
+
+// unfoldValue joins folded lines with a single space, the way
+// textproto.Reader.ReadMIMEHeader does.
+func unfoldValue(s string) string {
+	lines := strings.Split(strings.TrimRight(s, "\r\n"), "\n")
+	for i := range lines {
+		lines[i] = textproto.TrimString(lines[i])
+	}
+	return strings.Join(lines, " ")
+}
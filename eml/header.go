@@ -2,6 +2,7 @@ package eml
 
 import (
 	"bytes"
+	"encoding/base64"
 	"errors"
 	"io"
 	"mime"
@@ -90,8 +91,23 @@ func (h Header) Date() (time.Time, error) {
 }
 
 // AddressList parses the named header field as a list of addresses.
+// Every value of the field is parsed leniently with mailfile.ParseAddressList,
+// an error is returned only if the field is missing or holds no address.
 func (h Header) AddressList(key string) ([]*mail.Address, error) {
-	return mail.Header(h).AddressList(key)
+	values := h[textproto.CanonicalMIMEHeaderKey(key)]
+	if len(values) == 0 {
+		return nil, mail.ErrHeaderNotPresent
+	}
+
+	var list []*mail.Address
+	for _, value := range values {
+		addrs, _ := mailfile.ParseAddressList(value)
+		list = append(list, addrs...)
+	}
+	if len(list) == 0 {
+		return nil, ErrHeadersMissingAddress
+	}
+	return list, nil
 }
 
 // Methods required for sending a message:
@@ -123,28 +139,252 @@ func (h Header) Bytes() ([]byte, error) {
 
 // WriteTo writes this header out, including every field except for Bcc.
 func (h Header) WriteTo(w io.Writer) (int64, error) {
-	// TODO: Change how headerWriter decides where to wrap, then switch to MaxHeaderLineLength
-	writer := &headerWriter{w: w, maxLineLen: MaxHeaderTotalLength}
 	var total int64
 	for _, field := range sortedHeaderFields(h) {
 		if field == "Bcc" {
 			continue // skip writing out Bcc
 		}
 		for _, val := range h[field] {
-			val = textproto.TrimString(val)
-			writer.curLineLen = 0 // Reset for next header
-			for _, s := range []string{field, ": ", mime.QEncoding.Encode("UTF-8", val), "\r\n"} {
-				written, err := io.WriteString(writer, s)
-				if err != nil {
-					return total, err
-				}
-				total += int64(written)
+			written, err := writeField(w, field, val)
+			total += written
+			if err != nil {
+				return total, err
 			}
 		}
 	}
 	return total, nil
 }
 
+// writeField writes out a single header field, folded at white space to
+// lines of MaxHeaderLineLength where possible. Only the display names of
+// address fields and unstructured fields are encoded, structured fields are
+// written as they are.
+func writeField(w io.Writer, field, val string) (int64, error) {
+	// line breaks in a value would start a new field
+	val = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(val)
+	val = textproto.TrimString(val)
+
+	key := textproto.CanonicalMIMEHeaderKey(field)
+	switch {
+	case addressFields[key]:
+		val = encodeAddressList(val)
+	case !structuredFields[key]:
+		val = encodeText(val)
+	}
+	written, err := io.WriteString(w, foldField(field+": "+val, MaxHeaderLineLength)+"\r\n")
+	return int64(written), err
+}
+
+// structuredFields are never encoded: their syntax has no room for
+// encoded-words, or they must be kept as is to be verified.
+var structuredFields = map[string]bool{
+	"Message-Id":                 true,
+	"In-Reply-To":                true,
+	"References":                 true,
+	"Resent-Message-Id":          true,
+	"Date":                       true,
+	"Resent-Date":                true,
+	"Received":                   true,
+	"Return-Path":                true,
+	"Mime-Version":               true,
+	"Content-Type":               true,
+	"Content-Disposition":        true,
+	"Content-Transfer-Encoding":  true,
+	"Content-Id":                 true,
+	"Dkim-Signature":             true,
+	"Arc-Seal":                   true,
+	"Arc-Message-Signature":      true,
+	"Arc-Authentication-Results": true,
+	"Authentication-Results":     true,
+	"Received-Spf":               true,
+}
+
+// encodeAddressList encodes the display names of an address list, and the
+// names of its groups. A list that does not parse as a whole is left as it is.
+func encodeAddressList(list string) string {
+	if isPrintable(list) {
+		return list
+	}
+
+	var (
+		formatted = make([]string, 0)
+		entry     = 0  // start of the current entry
+		group     = -1 // start of the members of the open group
+		name      string
+		quoted    bool
+		depth     int // comment nesting
+		bracket   bool
+	)
+	add := func(s string) bool {
+		addrs, ok := encodeAddresses(s)
+		if ok && len(addrs) > 0 {
+			formatted = append(formatted, addrs)
+		}
+		return ok
+	}
+	for i := 0; i < len(list); i++ {
+		c := list[i]
+		switch {
+		case c == '\\' && (quoted || depth > 0):
+			i++
+		case quoted:
+			quoted = c != '"'
+		case c == '"':
+			quoted = true
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case depth > 0:
+		case c == '<' || c == '[':
+			bracket = true
+		case c == '>' || c == ']':
+			bracket = false
+		case bracket:
+		case c == ':' && group < 0:
+			name, group = strings.TrimSpace(list[entry:i]), i+1
+		case c == ';' && group >= 0:
+			members, ok := encodeAddresses(list[group:i])
+			if !ok || len(name) == 0 {
+				return list
+			}
+			if !isPrintable(name) {
+				if len(name) > 1 && name[0] == '"' && name[len(name)-1] == '"' {
+					name = strings.ReplaceAll(name[1:len(name)-1], `\"`, `"`)
+				}
+				name = encodeWords(name)
+			}
+			formatted = append(formatted, strings.TrimSpace(name+": "+members)+";")
+			entry, group = i+1, -1
+		case c == ',' && group < 0:
+			if !add(list[entry:i]) {
+				return list
+			}
+			entry = i + 1
+		}
+	}
+	if group >= 0 || !add(list[entry:]) || len(formatted) == 0 {
+		return list
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// encodeAddresses encodes the display names of the addresses of a list
+// without groups, reporting whether it parses as a whole.
+func encodeAddresses(list string) (string, bool) {
+	if len(strings.TrimSpace(list)) == 0 {
+		return "", true
+	}
+	addrs, rest := mailfile.ParseAddressList(list)
+	if len(addrs) == 0 || len(rest) > 0 {
+		return "", false
+	}
+	formatted := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if isPrintable(addr.Name) {
+			formatted = append(formatted, addr.String())
+		} else {
+			formatted = append(formatted, encodeWords(addr.Name)+" <"+addr.Address+">")
+		}
+	}
+	return strings.Join(formatted, ", "), true
+}
+
+// encodeText encodes the words of unstructured text that are not plain
+// ASCII, along with the spaces between them, keeping the other words as they
+// are. A plain word that looks like an encoded-word is encoded as well, so
+// that it is not decoded by the reader.
+func encodeText(text string) string {
+	words := strings.Split(text, " ")
+	encoded := make([]string, 0, len(words))
+	for i := 0; i < len(words); {
+		if !needsEncoding(words[i]) {
+			encoded = append(encoded, words[i])
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(words) && needsEncoding(words[j]) {
+			j++
+		}
+		encoded = append(encoded, encodeWords(strings.Join(words[i:j], " ")))
+		i = j
+	}
+	return strings.Join(encoded, " ")
+}
+
+// needsEncoding reports whether a word of unstructured text must be encoded.
+func needsEncoding(word string) bool {
+	return !isPrintable(word) || strings.Contains(word, "=?")
+}
+
+// encodeWords encodes s as UTF-8 encoded-words, Q or B encoded, whichever is
+// shorter. Long text is split into several words.
+func encodeWords(s string) string {
+	if isPrintable(s) {
+		// mime leaves plain text as it is, it is encoded here only for
+		// looking like encoded-words
+		words := make([]string, 0, len(s)/45+1)
+		for len(s) > 0 {
+			n := len(s)
+			if n > 45 {
+				n = 45
+			}
+			words = append(words, "=?UTF-8?b?"+base64.StdEncoding.EncodeToString([]byte(s[:n]))+"?=")
+			s = s[n:]
+		}
+		return strings.Join(words, " ")
+	}
+
+	special := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x7f || s[i] < ' ' || strings.IndexByte("=?_()\"", s[i]) >= 0 {
+			special++
+		}
+	}
+	if len(s)+2*special > (len(s)+2)/3*4 {
+		return mime.BEncoding.Encode("UTF-8", s)
+	}
+	return mime.QEncoding.Encode("UTF-8", s)
+}
+
+// isPrintable reports whether s holds only printable ASCII and tabs.
+func isPrintable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x7f || s[i] < ' ' && s[i] != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// foldField folds a field at the white space closest to limit columns,
+// without breaking a word: a word longer than a line is left whole.
+func foldField(field string, limit int) string {
+	var b strings.Builder
+	lineLen := 0
+	for len(field) > 0 {
+		// a token is leading white space and the word following it
+		end := 0
+		for end < len(field) && (field[end] == ' ' || field[end] == '\t') {
+			end++
+		}
+		for end < len(field) && field[end] != ' ' && field[end] != '\t' {
+			end++
+		}
+		token := field[:end]
+		field = field[end:]
+
+		if lineLen > 0 && lineLen+len(token) > limit && strings.TrimLeft(token, " \t") != token {
+			b.WriteString("\r\n")
+			lineLen = 0
+		}
+		b.WriteString(token)
+		lineLen += len(token)
+	}
+	return b.String()
+}
+
 // Convenience Methods:
 
 // ContentType parses and returns the content media type, any parameters on it,
@@ -162,8 +402,7 @@ func (h Header) ContentDisposition() (string, map[string]string, error) {
 // parseMediaType ...
 func (h Header) parseMediaType(typeField string) (string, map[string]string, error) {
 	if content := h.Get(typeField); len(content) > 0 {
-		content = mailfile.ParseContext(content)
-		mediaType, mediaTypeParams, err := mime.ParseMediaType(content)
+		mediaType, mediaTypeParams, err := mailfile.ParseMediaType(content)
 		if err != nil {
 			return "", map[string]string{}, err
 		}
@@ -175,6 +414,9 @@ func (h Header) parseMediaType(typeField string) (string, map[string]string, err
 // ErrHeadersMissingField ...
 var ErrHeadersMissingField = errors.New("Message missing header field")
 
+// ErrHeadersMissingAddress ...
+var ErrHeadersMissingAddress = errors.New("Message header field has no address")
+
 // From ...
 func (h Header) From() string {
 	return h.Get("From")
@@ -187,11 +429,7 @@ func (h Header) SetFrom(email string) {
 
 // To ...
 func (h Header) To() []string {
-	to := h.Get("To")
-	if to == "" {
-		return []string{}
-	}
-	return strings.Split(to, ", ")
+	return h.addresses("To")
 }
 
 // SetTo ...
@@ -201,11 +439,7 @@ func (h Header) SetTo(emails ...string) {
 
 // Cc ...
 func (h Header) Cc() []string {
-	cc := h.Get("Cc")
-	if cc == "" {
-		return []string{}
-	}
-	return strings.Split(cc, ", ")
+	return h.addresses("Cc")
 }
 
 // SetCc ...
@@ -215,11 +449,7 @@ func (h Header) SetCc(emails ...string) {
 
 // Bcc ...
 func (h Header) Bcc() []string {
-	bcc := h.Get("Bcc")
-	if bcc == "" {
-		return []string{}
-	}
-	return strings.Split(bcc, ", ")
+	return h.addresses("Bcc")
 }
 
 // SetBcc ...
@@ -227,6 +457,16 @@ func (h Header) SetBcc(emails ...string) {
 	h.Set("Bcc", strings.Join(emails, ", "))
 }
 
+// addresses returns the addresses of an address field, formatted per RFC 5322.
+func (h Header) addresses(key string) []string {
+	list, _ := h.AddressList(key)
+	addrs := make([]string, 0, len(list))
+	for _, addr := range list {
+		addrs = append(addrs, addr.String())
+	}
+	return addrs
+}
+
 // Subject ...
 func (h Header) Subject() string {
 	return h.Get("Subject")
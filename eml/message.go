@@ -3,6 +3,7 @@ package eml
 import (
 	"bytes"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"mime/quotedprintable"
@@ -27,6 +28,10 @@ type Message struct {
 	// Header is this message's key-value MIME-style pairs in its header.
 	Header Header
 
+	// Fields is the header as read, in order and with the raw bytes of each
+	// field. It is empty for messages built in code.
+	Fields Fields
+
 	// Preamble is any text that appears before the first mime multipart,
 	// and may only be full in the case where this Message has a Content-Type of "multipart".
 	Preamble []byte
@@ -51,6 +56,10 @@ type Message struct {
 	// quoted-printable or base64, and will be re-encoded when written out
 	// based on the Content-Type.
 	Body []byte
+
+	// source is the text this message was parsed from, nil for messages
+	// built in code.
+	source *source
 }
 
 // Payload will return the payload of the message, which can only be one the
@@ -180,6 +189,69 @@ func (m *Message) Save() error {
 	return m.Header.Save()
 }
 
+// Validate checks that the message is well formed to be sent: it has a From
+// address and a Date, and each part has the payload its Content-Type calls for,
+// with multipart boundaries that do not clash with the enclosing ones.
+func (m *Message) Validate() error {
+	if _, err := m.Header.AddressList("From"); err != nil {
+		return fmt.Errorf("From: %w", err)
+	}
+	if _, err := m.Header.Date(); err != nil {
+		return fmt.Errorf("Date: %w", err)
+	}
+	return m.validate(nil)
+}
+
+// validate checks the payload of m, under the enclosing boundaries.
+func (m *Message) validate(boundaries []string) error {
+	if m.source != nil && !m.edited() {
+		return nil // written back as it was read
+	}
+
+	mediaType, params, err := m.Header.ContentType()
+	if err != nil && err != ErrHeadersMissingField {
+		return err
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart"):
+		boundary := params["boundary"]
+		if len(boundary) == 0 || len(boundary) > 70 {
+			return ErrMessageBoundary
+		}
+		for _, enclosing := range boundaries {
+			if strings.HasPrefix(boundary, enclosing) || strings.HasPrefix(enclosing, boundary) {
+				return ErrMessageBoundary
+			}
+		}
+		if len(m.Parts) == 0 || m.SubMessage != nil || len(m.Body) > 0 {
+			return ErrMessagePayload
+		}
+		boundaries = append(boundaries, boundary)
+		for _, part := range m.Parts {
+			if err := part.validate(boundaries); err != nil {
+				return err
+			}
+		}
+	case strings.HasPrefix(mediaType, "message"):
+		if m.SubMessage == nil || len(m.Parts) > 0 || len(m.Body) > 0 {
+			return ErrMessagePayload
+		}
+		return m.SubMessage.validate(nil)
+	default:
+		if len(m.Parts) > 0 || m.SubMessage != nil {
+			return ErrMessagePayload
+		}
+	}
+	return nil
+}
+
+// ErrMessageBoundary ...
+var ErrMessageBoundary = errors.New("Multipart boundary missing, too long or clashing with an enclosing one")
+
+// ErrMessagePayload ...
+var ErrMessagePayload = errors.New("Message payload does not match its content type")
+
 // Bytes returns the bytes representing this message.  It is a convenience
 // method that calls WriteTo on a buffer, returning its bytes.
 func (m *Message) Bytes() ([]byte, error) {
@@ -189,9 +261,20 @@ func (m *Message) Bytes() ([]byte, error) {
 }
 
 // WriteTo writes out this Message and its payloads, recursively.
-// Any text bodies will be quoted-printable encoded,
+// A parsed message is written back byte for byte as it was read, except for
+// the header fields, parts and bodies edited since, which are written again.
+// Otherwise, any text bodies will be quoted-printable encoded,
 // and all other bodies will be base64 encoded.
 func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	if m.source != nil {
+		return m.writeSource(w)
+	}
+	return m.writeEncoded(w)
+}
+
+// writeEncoded writes out this Message from its Header and payloads,
+// encoding the bodies.
+func (m *Message) writeEncoded(w io.Writer) (int64, error) {
 
 	total, err := m.Header.WriteTo(w)
 	if err != nil {
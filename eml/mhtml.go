@@ -0,0 +1,231 @@
+package eml
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/mel2oo/mailfile"
+)
+
+// ErrNoRootDocument is returned when an MHTML archive has no document to render.
+var ErrNoRootDocument = errors.New("MHTML root document not found")
+
+// MHTML is a web archive (RFC 2557) read from a multipart/related message:
+// a root document plus the resources it references by Content-Location or Content-ID.
+type MHTML struct {
+	// Message is the parsed archive.
+	Message *Message
+
+	// Root is the part holding the main document.
+	Root *Message
+
+	// Html is the decoded body of the root document.
+	Html []byte
+
+	// Base is the absolute location of the root document, if it has one.
+	Base string
+
+	// Resources are all parts other than the root, in archive order.
+	Resources []*Resource
+
+	locations map[string]*Resource
+	cids      map[string]*Resource
+}
+
+// Resource is a part of an MHTML archive referenced by the root document.
+type Resource struct {
+	// Location is the Content-Location, resolved against the archive base.
+	Location    string
+	ContentID   string
+	ContentType string
+	Part        *Message
+}
+
+// Data returns the decoded body of the resource.
+func (r *Resource) Data() []byte {
+	return r.Part.Body
+}
+
+// NewMHTML reads an .mht / .mhtml file.
+func NewMHTML(file string) (*MHTML, error) {
+	fi, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+
+	return ParseMHTML(fi)
+}
+
+// ParseMHTML parses an MHTML archive from an io.Reader.
+func ParseMHTML(r io.Reader) (*MHTML, error) {
+	m, err := ParseMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	return m.MHTML()
+}
+
+// MHTML interprets this message as a web archive. The first multipart/related
+// message found is used; the root document is the part named by its "start"
+// parameter, or else the first part of its "type" parameter, or else its first part.
+func (m *Message) MHTML() (*MHTML, error) {
+	archive := &MHTML{
+		Message:   m,
+		locations: make(map[string]*Resource),
+		cids:      make(map[string]*Resource),
+	}
+
+	var related *Message
+	if list := m.MessagesContentTypePrefix("multipart/related"); len(list) > 0 {
+		related = list[0]
+	}
+
+	if related == nil {
+		// a single document without resources is still a valid archive
+		if !m.HasBody() {
+			return nil, ErrNoRootDocument
+		}
+		archive.Root = m
+	} else {
+		archive.Root = findRoot(related)
+	}
+	if archive.Root == nil {
+		return nil, ErrNoRootDocument
+	}
+
+	archive.Html = archive.Root.Body
+	if mediaType, params, err := archive.Root.Header.ContentType(); err == nil && strings.HasPrefix(mediaType, "text/") {
+		archive.Html, _ = decodeText(archive.Root.Body, params, mediaType == "text/html")
+	}
+	archive.Base = resolveLocation(contentBase(related, archive.Root), archive.Root.Header.Get("Content-Location"))
+
+	if related == nil {
+		return archive, nil
+	}
+
+	for _, part := range related.MessagesAll()[1:] {
+		if part == archive.Root || !part.HasBody() {
+			continue
+		}
+		mediaType, _, _ := part.Header.ContentType()
+		res := &Resource{
+			Location:    resolveLocation(contentBase(related, part), part.Header.Get("Content-Location")),
+			ContentID:   trimAngle(part.Header.Get("Content-Id")),
+			ContentType: mediaType,
+			Part:        part,
+		}
+		archive.Resources = append(archive.Resources, res)
+		if len(res.Location) > 0 {
+			if _, ok := archive.locations[res.Location]; !ok {
+				archive.locations[res.Location] = res
+			}
+		}
+		if len(res.ContentID) > 0 {
+			archive.cids[res.ContentID] = res
+		}
+	}
+	return archive, nil
+}
+
+// findRoot ...
+func findRoot(related *Message) *Message {
+	_, params, _ := related.Header.ContentType()
+	if start := trimAngle(params["start"]); len(start) > 0 {
+		for _, part := range related.Parts {
+			if trimAngle(part.Header.Get("Content-Id")) == start {
+				return part
+			}
+		}
+	}
+	if rootType := params["type"]; len(rootType) > 0 {
+		for _, part := range related.Parts {
+			if mediaType, _, _ := part.Header.ContentType(); strings.EqualFold(mediaType, rootType) {
+				return part
+			}
+		}
+	}
+	if len(related.Parts) > 0 {
+		return related.Parts[0]
+	}
+	return nil
+}
+
+// contentBase returns the Content-Base that applies to part,
+// falling back to the related message's own base.
+func contentBase(related, part *Message) string {
+	if part != nil {
+		if base := part.Header.Get("Content-Base"); len(base) > 0 {
+			return strings.TrimSpace(base)
+		}
+	}
+	if related != nil {
+		if base := related.Header.Get("Content-Base"); len(base) > 0 {
+			return strings.TrimSpace(base)
+		}
+	}
+	return ""
+}
+
+// resolveLocation resolves a possibly relative Content-Location against base.
+func resolveLocation(base, location string) string {
+	location = strings.TrimSpace(location)
+	if len(location) == 0 {
+		return ""
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	if len(base) == 0 || ref.IsAbs() {
+		return ref.String()
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref.String()
+	}
+	return baseURL.ResolveReference(ref).String()
+}
+
+// trimAngle ...
+func trimAngle(s string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s), "<"), ">")
+}
+
+// Resolve returns the resource a reference in the root document points to.
+// ref may be a "cid:" URL, an absolute URL, or a URL relative to the root document.
+func (a *MHTML) Resolve(ref string) *Resource {
+	ref = strings.TrimSpace(ref)
+	if len(ref) > 4 && strings.EqualFold(ref[:4], "cid:") {
+		cid, err := url.PathUnescape(ref[4:])
+		if err != nil {
+			cid = ref[4:]
+		}
+		return a.cids[trimAngle(cid)]
+	}
+	if res, ok := a.locations[resolveLocation(a.Base, ref)]; ok {
+		return res
+	}
+	return a.locations[ref]
+}
+
+// Format returns the normalized message with the root document as Html and
+// every resource as an Embedded entry.
+func (a *MHTML) Format() *mailfile.Message {
+	msg := a.Message.Format()
+	msg.Html = bytes.NewBuffer(a.Html)
+	msg.Embeddeds = make([]mailfile.Embedded, 0, len(a.Resources))
+	for _, res := range a.Resources {
+		msg.Embeddeds = append(msg.Embeddeds, mailfile.Embedded{
+			CID:         res.ContentID,
+			Location:    res.Location,
+			ContentType: res.Part.Header.Get("Content-Type"),
+			Data:        bytes.NewBuffer(res.Data()),
+		})
+	}
+	return msg
+}
@@ -6,10 +6,9 @@ import (
 	"encoding/base64"
 	"html"
 	"io"
-	"mime"
-	"mime/multipart"
 	"mime/quotedprintable"
 	"net/mail"
+	"net/textproto"
 	"os"
 	"strings"
 
@@ -21,6 +20,7 @@ func New(file string) (*Message, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer fi.Close()
 
 	return ParseMessage(fi)
 }
@@ -31,39 +31,103 @@ func New(file string) (*Message, error) {
 // or bytes.NewReader() to create a reader.)
 // Any "quoted-printable" or "base64" encoded bodies will be decoded.
 func ParseMessage(r io.Reader) (*Message, error) {
-	msg, err := mail.ReadMessage(&leftTrimReader{r: bufioReader(r)})
+	data, err := io.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
-	// decode any Q-encoded values
-	for _, values := range msg.Header {
+	// skip any white space before the header, keeping it to write back
+	start := 0
+	for start < len(data) && isASCIISpace(data[start]) {
+		start++
+	}
+	prefix, data := data[:start], data[start:]
+
+	headers, fields, body, err := readHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	// decode any raw 8-bit values, then any Q-encoded values
+	decodeRawHeader(headers)
+	for key, values := range headers {
+		if addressFields[key] {
+			continue
+		}
 		for idx, val := range values {
 			values[idx] = decodeRFC2047(val)
 		}
 	}
-	return parseMessageWithHeader(Header(msg.Header), msg.Body)
+	fields.setValues(headers)
+	m, err := parseMessageWithHeader(headers, fields, data, body)
+	if err != nil {
+		return nil, err
+	}
+	m.source.prefix = prefix
+	return m, nil
+}
+
+// readHeader splits the raw text of a message or a part into its header,
+// parsed both as a Header and as Fields, and its body.
+func readHeader(data []byte) (Header, Fields, []byte, error) {
+	end := headerEnd(data)
+	block, body := data[:end], data[end:]
+
+	// the header may end at the end of data, without a blank line
+	reader := io.MultiReader(bytes.NewReader(block), strings.NewReader("\r\n\r\n"))
+	mimeHeader, err := textproto.NewReader(bufio.NewReader(reader)).ReadMIMEHeader()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	fields := splitFields(block)
+	headers := Header(mimeHeader)
+	fields.setValues(headers)
+	return headers, fields, body, nil
+}
+
+// headerEnd returns the offset of the body, just after the blank line ending
+// the header, or the length of data if there is no blank line.
+func headerEnd(data []byte) int {
+	for pos := 0; pos < len(data); {
+		end := bytes.IndexByte(data[pos:], '\n')
+		if end < 0 {
+			break
+		}
+		end += pos + 1
+		if end-pos == 1 || end-pos == 2 && data[pos] == '\r' {
+			return end
+		}
+		pos = end
+	}
+	return len(data)
 }
 
 // parseMessageWithHeader parses and returns a Message from an already filled
-// Header, and an io.Reader containing the raw text of the body/payload.
-// (If the raw body is a string or []byte, use strings.NewReader()
-// or bytes.NewReader() to create a reader.)
+// Header and Fields, the raw text they were read from, and the raw text of the
+// body/payload, the end of raw.
 // Any "quoted-printable" or "base64" encoded bodies will be decoded.
-func parseMessageWithHeader(headers Header, bodyReader io.Reader) (*Message, error) {
+func parseMessageWithHeader(headers Header, fields Fields, raw, rawBody []byte) (*Message, error) {
 
-	bufferedReader := contentReader(headers, bodyReader)
+	content, err := io.ReadAll(contentReader(headers, bytes.NewReader(rawBody)))
+	if err != nil {
+		return nil, err
+	}
+	// contentReader removes the encodings it decoded
+	transfer := ""
+	if !headers.IsSet("Content-Transfer-Encoding") {
+		transfer = fields.Get("Content-Transfer-Encoding")
+	}
 
-	var err error
 	var mediaType string
 	var mediaTypeParams map[string]string
 	var preamble []byte
 	var epilogue []byte
 	var body []byte
 	var parts []*Message
+	var seps [][]byte
 	var subMessage *Message
 
 	if contentType := headers.Get("Content-Type"); len(contentType) > 0 {
-		mediaType, mediaTypeParams, err = mime.ParseMediaType(contentType)
+		mediaType, mediaTypeParams, err = mailfile.ParseMediaType(contentType)
 		if err != nil {
 			return nil, err
 		}
@@ -71,184 +135,185 @@ func parseMessageWithHeader(headers Header, bodyReader io.Reader) (*Message, err
 
 	// Can only have one of the following: Parts, SubMessage, or Body
 	if strings.HasPrefix(mediaType, "multipart") {
-		boundary := mediaTypeParams["boundary"]
-		preamble, err = readPreamble(bufferedReader, boundary)
-		if err == nil {
-			parts, err = readParts(bufferedReader, boundary)
-			if err == nil {
-				epilogue, err = readEpilogue(bufferedReader)
-			}
-		}
+		preamble, parts, epilogue, seps, err = readParts(content, mediaTypeParams["boundary"])
 
 	} else if strings.HasPrefix(mediaType, "message") {
-		subMessage, err = ParseMessage(bufferedReader)
+		subMessage, err = ParseMessage(bytes.NewReader(content))
 
 	} else {
-		body, err = io.ReadAll(bufferedReader)
+		body = content
 	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &Message{
+	m := &Message{
 		Header:     headers,
+		Fields:     fields,
 		Preamble:   preamble,
 		Epilogue:   epilogue,
 		Body:       body,
 		SubMessage: subMessage,
 		Parts:      parts,
-	}, nil
+	}
+	m.source = newSource(m, raw, rawBody, transfer)
+	m.source.seps = seps
+	return m, nil
 }
 
-// readParts parses out the parts of a multipart body, including the preamble and epilogue.
-func readParts(bodyReader io.Reader, boundary string) ([]*Message, error) {
-
-	parts := make([]*Message, 0, 1)
-	multipartReader := multipart.NewReader(bodyReader, boundary)
+// delimiter is a boundary delimiter line of a multipart body.
+type delimiter struct {
+	start, end int // offsets of the line, end includes the line break
+	close      bool
+}
 
-	for part, partErr := multipartReader.NextPart(); partErr != io.EOF; part, partErr = multipartReader.NextPart() {
-		if partErr != nil && partErr != io.EOF {
-			return []*Message{}, partErr
+// findDelimiters returns the delimiter lines of a multipart body, up to and
+// including the close delimiter. Like mime/multipart, a delimiter line is
+// "--" boundary, followed by "--" for the close delimiter, and by nothing
+// but white space.
+func findDelimiters(body []byte, boundary string) []delimiter {
+	dash := []byte("--" + boundary)
+	delims := make([]delimiter, 0)
+	for pos := 0; pos < len(body); {
+		end := bytes.IndexByte(body[pos:], '\n') + pos + 1
+		if end == pos {
+			end = len(body)
 		}
-		newEmailPart, msgErr := parseMessageWithHeader(Header(part.Header), part)
-		part.Close()
-		if msgErr != nil {
-			return []*Message{}, msgErr
+		if line := body[pos:end]; bytes.HasPrefix(line, dash) {
+			switch rest := bytes.TrimRight(line[len(dash):], " \t\r\n"); string(rest) {
+			case "":
+				delims = append(delims, delimiter{start: pos, end: end})
+			case "--":
+				return append(delims, delimiter{start: pos, end: end, close: true})
+			}
 		}
-		parts = append(parts, newEmailPart)
+		pos = end
 	}
-	return parts, nil
+	return delims
 }
 
-// readEpilogue ...
-func readEpilogue(r io.Reader) ([]byte, error) {
-	epilogue, err := io.ReadAll(r)
-	for len(epilogue) > 0 && isASCIISpace(epilogue[len(epilogue)-1]) {
-		epilogue = epilogue[:len(epilogue)-1]
-	}
-	if len(epilogue) > 0 {
-		return epilogue, err
-	}
-	return nil, err
-}
-
-// readPreamble ...
-func readPreamble(r *bufio.Reader, boundary string) ([]byte, error) {
-	preamble, err := io.ReadAll(&preambleReader{r: r, boundary: []byte("--" + boundary)})
-	if len(preamble) > 0 {
-		return preamble, err
+// readParts parses out the parts of a multipart body, including the preamble and epilogue.
+// A body missing the close delimiter ends with its last part.
+// It also returns the text around the parts, one more than the parts: the
+// first from the start of the body to the first delimiter line included, the
+// last from the end of the last part to the end of the body.
+func readParts(body []byte, boundary string) ([]byte, []*Message, []byte, [][]byte, error) {
+	delims := findDelimiters(body, boundary)
+	if len(delims) == 0 {
+		return trimSpaceRight(body), []*Message{}, nil, [][]byte{body}, nil
 	}
-	return nil, err
-}
 
-// preambleReader ...
-type preambleReader struct {
-	r        *bufio.Reader
-	boundary []byte
-}
-
-// Read ...
-func (r *preambleReader) Read(p []byte) (int, error) {
-	if len(p) == 0 {
-		return 0, nil
-	}
-	// Peek and read up to the --boundary, then EOF
-	peek, err := r.r.Peek(len(p))
-	if err != nil && err != io.EOF {
-		return 0, err
-	}
+	preamble := trimSpaceRight(body[:delims[0].start])
+	parts := make([]*Message, 0, len(delims))
+	seps := make([][]byte, 0, len(delims)+1)
+	var epilogue []byte
+	sep := 0
+	for i, delim := range delims {
+		if delim.close {
+			epilogue = trimSpaceRight(body[delim.end:])
+			break
+		}
 
-	idx := bytes.Index(peek, r.boundary)
+		// the line break before the next delimiter belongs to the delimiter
+		end := len(body)
+		if i+1 < len(delims) {
+			end = trimLineBreak(body[:delims[i+1].start], delim.end)
+		}
 
-	if idx < 0 {
-		// Couldn't find the boundary, so read all the bytes we can,
-		// but leave room for a new-line + boundary that got cut in half by the buffer,
-		// that way it can be matched against on the next read
-		return r.r.Read(p[:max(1, len(peek)-(len(r.boundary)+2))])
+		headers, fields, rawBody, err := readHeader(body[delim.end:end])
+		if err != nil {
+			return nil, []*Message{}, nil, nil, err
+		}
+		part, err := parseMessageWithHeader(headers, fields, body[delim.end:end], rawBody)
+		if err != nil {
+			return nil, []*Message{}, nil, nil, err
+		}
+		parts = append(parts, part)
+		seps = append(seps, body[sep:delim.end])
+		sep = end
 	}
+	seps = append(seps, body[sep:])
+	return preamble, parts, epilogue, seps, nil
+}
 
-	// Account for possible new-line / whitespace at start of the boundary, which shouldn't be removed
-	for idx > 0 && isASCIISpace(peek[idx-1]) {
-		idx--
+// trimLineBreak returns the length of data without its final line break,
+// never less than min.
+func trimLineBreak(data []byte, min int) int {
+	end := len(data)
+	if end > min && data[end-1] == '\n' {
+		end--
+		if end > min && data[end-1] == '\r' {
+			end--
+		}
 	}
+	return end
+}
 
-	if idx == 0 {
-		// The boundary (or new-line + boundary) is at the start of the reader, so there is no preamble
-		return 0, io.EOF
+// trimSpaceRight removes trailing white space, returning nil if nothing is left.
+func trimSpaceRight(data []byte) []byte {
+	for len(data) > 0 && isASCIISpace(data[len(data)-1]) {
+		data = data[:len(data)-1]
 	}
-
-	n, err := r.r.Read(p[:idx])
-	if err != nil && err != io.EOF {
-		return n, err
+	if len(data) > 0 {
+		return data
 	}
-	return n, io.EOF
+	return nil
 }
 
 // contentReader ...
 func contentReader(headers Header, bodyReader io.Reader) *bufio.Reader {
-	if headers.Get("Content-Transfer-Encoding") == "quoted-printable" {
+	switch strings.ToLower(strings.TrimSpace(headers.Get("Content-Transfer-Encoding"))) {
+	case "quoted-printable":
 		headers.Del("Content-Transfer-Encoding")
 		return bufioReader(quotedprintable.NewReader(bodyReader))
-	}
-	if headers.Get("Content-Transfer-Encoding") == "base64" {
+	case "base64":
 		headers.Del("Content-Transfer-Encoding")
 		return bufioReader(base64.NewDecoder(base64.StdEncoding, bodyReader))
 	}
 	return bufioReader(bodyReader)
 }
 
+// addressFields are left encoded when the header is read: their display names
+// are decoded one address at a time, so that a decoded comma or quote does not
+// break the list.
+var addressFields = map[string]bool{
+	"From":          true,
+	"Sender":        true,
+	"Reply-To":      true,
+	"To":            true,
+	"Cc":            true,
+	"Bcc":           true,
+	"Resent-From":   true,
+	"Resent-Sender": true,
+	"Resent-To":     true,
+	"Resent-Cc":     true,
+	"Resent-Bcc":    true,
+}
+
 // decodeRFC2047 ...
 func decodeRFC2047(s string) string {
-	// GO 1.5 does not decode headers, but this may change in future releases...
-	decoded, err := (&mime.WordDecoder{}).DecodeHeader(s)
-	if err != nil || len(decoded) == 0 {
-		return s
-	}
-	return decoded
+	return mailfile.DecodeText(s)
 }
 
 func (m *Message) Format() *mailfile.Message {
 	var msg mailfile.Message
 	msg.Headers = mail.Header(m.Header)
+	msg.HeaderOrder = m.Fields.Names()
 	msg.MessageID = m.Header.Get("Message-Id")
 	msg.Date = m.Header.Get("Date")
-	msg.Subject = mailfile.ParseTitle(m.Header.Subject())
+	msg.Subject = m.Header.Subject()
 	msg.ContentType = m.Header.Get("Content-Type")
 
 	msg.SenderAddress, _ = mailfile.GetSenderIP(msg.Headers)
-	msg.Sender, _ = mail.ParseAddress(m.Header.Get("Sender"))
-	msg.From, _ = mailfile.ParseFrom(m.Header.From())
-	msg.ReplyTo, _ = mail.ParseAddressList(m.Header.Get("Reply-To"))
-
-	// parse msg name
-	addrs := make([]*mail.Address, 0)
-	addrs = append(append(append(addrs, msg.Sender), msg.From...), msg.ReplyTo...)
-	for i := range addrs {
-		if addrs[i] != nil && addrs[i].Name != "" {
-			addrs[i].Name, _ = DecodeBase64GBK(addrs[i].Name)
-		}
-	}
-
-	for _, tstr := range m.Header.To() {
-		to, err := mail.ParseAddress(tstr)
-		if err == nil {
-			msg.To = append(msg.To, to)
-		}
-	}
-
-	for _, cstr := range m.Header.Cc() {
-		cc, err := mail.ParseAddress(cstr)
-		if err == nil {
-			msg.Cc = append(msg.Cc, cc)
-		}
-	}
-
-	for _, cstr := range m.Header.Bcc() {
-		bcc, err := mail.ParseAddress(cstr)
-		if err == nil {
-			msg.Bcc = append(msg.Bcc, bcc)
-		}
+	if sender, err := m.Header.AddressList("Sender"); err == nil {
+		msg.Sender = sender[0]
 	}
+	msg.From, _ = m.Header.AddressList("From")
+	msg.ReplyTo, _ = m.Header.AddressList("Reply-To")
+	msg.To, _ = m.Header.AddressList("To")
+	msg.Cc, _ = m.Header.AddressList("Cc")
+	msg.Bcc, _ = m.Header.AddressList("Bcc")
+	msg.Resent = mailfile.ParseResent(msg.Headers)
 
 	ParseParts(m, &msg)
 
@@ -292,30 +357,26 @@ func ParsePart(m *Message, msg *mailfile.Message) {
 	if !m.HasParts() && m.HasBody() {
 		desc, maps, err := m.Header.ContentDisposition()
 		if err != nil {
-			mime, _, err := m.Header.ContentType()
+			mime, params, err := m.Header.ContentType()
 			if err == nil {
 				switch mime {
 				case "text/plain":
-					if len(m.Body) > 0 && IsGBK(m.Body) {
-						if body, err := GbkToUtf8(m.Body); err == nil {
-							m.Body = body
-						}
-					}
-					msg.Body = bytes.NewBuffer(m.Body)
+					body, charset := decodeText(m.Body, params, false)
+					msg.Body = bytes.NewBuffer(body)
+					msg.Charset = charset
 				case "text/html":
-					if len(m.Body) > 0 && IsGBK(m.Body) {
-						if body, err := GbkToUtf8(m.Body); err == nil {
-							m.Body = body
-						}
+					body, charset := decodeText(m.Body, params, true)
+					msg.Html = bytes.NewBuffer(body)
+					if len(msg.Charset) == 0 {
+						msg.Charset = charset
 					}
-					msg.Html = bytes.NewBuffer(m.Body)
 				}
 			}
 		}
 
 		if desc == "inline" {
 			msg.Embeddeds = append(msg.Embeddeds, mailfile.Embedded{
-				CID:         mailfile.ParseContext(m.Header.Get("Content-Id")),
+				CID:         m.Header.Get("Content-Id"),
 				ContentType: m.Header.Get("Content-Type"),
 				Data:        bytes.NewBuffer(m.Body),
 			})
@@ -323,7 +384,7 @@ func ParsePart(m *Message, msg *mailfile.Message) {
 
 		if desc == "attachment" {
 			msg.Attachments = append(msg.Attachments, mailfile.Attachment{
-				Filename:    mailfile.ParseContext(maps["filename"]),
+				Filename:    maps["filename"],
 				ContentType: m.Header.Get("Content-Type"),
 				Data:        bytes.NewBuffer(m.Body),
 			})
@@ -0,0 +1,291 @@
+package eml
+
+import (
+	"bytes"
+	"io"
+	"net/textproto"
+)
+
+// source is the text a parsed message was read from. It is kept to write the
+// message back as it was read, and to tell what was edited since.
+type source struct {
+	prefix []byte // white space before the header of a message
+	header []byte // the header block, blank line included
+	body   []byte // the body as read, before transfer decoding
+
+	// transfer is the Content-Transfer-Encoding the body was decoded from,
+	// empty if it was not decoded.
+	transfer string
+
+	// the message as parsed
+	values    Header
+	fields    Fields
+	multipart bool
+	message   bool
+	preamble  []byte
+	epilogue  []byte
+	parts     []*Message
+	seps      [][]byte // the text around the parts, delimiter lines included
+	sub       *Message
+}
+
+// newSource records the parsed state of m, read from raw.
+func newSource(m *Message, raw, rawBody []byte, transfer string) *source {
+	src := &source{
+		header:    raw[:len(raw)-len(rawBody)],
+		body:      rawBody,
+		transfer:  transfer,
+		values:    make(Header, len(m.Header)),
+		fields:    make(Fields, 0, len(m.Fields)),
+		multipart: m.Parts != nil,
+		message:   m.SubMessage != nil,
+		preamble:  append([]byte(nil), m.Preamble...),
+		epilogue:  append([]byte(nil), m.Epilogue...),
+		parts:     append([]*Message(nil), m.Parts...),
+		sub:       m.SubMessage,
+	}
+	for key, values := range m.Header {
+		src.values[key] = append([]string(nil), values...)
+	}
+	for _, f := range m.Fields {
+		field := *f
+		src.fields = append(src.fields, &field)
+	}
+	return src
+}
+
+// edited reports whether m was changed since it was parsed. Messages built in
+// code are always edited.
+func (m *Message) edited() bool {
+	src := m.source
+	switch {
+	case src == nil:
+		return true
+	case m.headerEdited():
+		return true
+	case src.multipart:
+		if m.partsEdited() {
+			return true
+		}
+		for _, part := range m.Parts {
+			if part.edited() {
+				return true
+			}
+		}
+		return false
+	case src.message:
+		return m.SubMessage != src.sub || m.SubMessage.edited()
+	}
+	return m.bodyEdited()
+}
+
+// headerEdited reports whether Header or Fields were changed.
+func (m *Message) headerEdited() bool {
+	return !equalHeader(m.Header, m.source.values) || !equalFields(m.Fields, m.source.fields)
+}
+
+// typeEdited reports whether the content type or the transfer encoding were
+// changed, in which case the body is written out again as a whole.
+func (m *Message) typeEdited() bool {
+	for _, key := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+		if m.Header.Get(key) != m.source.values.Get(key) || m.Fields.Get(key) != m.source.fields.Get(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// partsEdited reports whether parts were added, removed or replaced, or the
+// preamble or the epilogue changed.
+func (m *Message) partsEdited() bool {
+	src := m.source
+	if len(m.Parts) != len(src.parts) || !bytes.Equal(m.Preamble, src.preamble) || !bytes.Equal(m.Epilogue, src.epilogue) {
+		return true
+	}
+	for i, part := range m.Parts {
+		if part != src.parts[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyEdited reports whether Body differs from the decoded body as read.
+func (m *Message) bodyEdited() bool {
+	src := m.source
+	if len(src.transfer) == 0 {
+		return !bytes.Equal(m.Body, src.body)
+	}
+	headers := Header{"Content-Transfer-Encoding": {src.transfer}}
+	content, err := io.ReadAll(contentReader(headers, bytes.NewReader(src.body)))
+	return err != nil || !bytes.Equal(m.Body, content)
+}
+
+// writeSource writes out a parsed message: unchanged as read if it was not
+// edited, otherwise with the edited header fields and parts written again.
+func (m *Message) writeSource(w io.Writer) (int64, error) {
+	src := m.source
+	cw := &countWriter{w: w}
+
+	if !m.edited() {
+		for _, data := range [][]byte{src.prefix, src.header, src.body} {
+			if _, err := cw.Write(data); err != nil {
+				return cw.n, err
+			}
+		}
+		return cw.n, nil
+	}
+	if m.typeEdited() || len(src.transfer) > 0 && (src.multipart || src.message) {
+		// the payload can not be kept as read
+		return m.writeEncoded(w)
+	}
+
+	if _, err := cw.Write(src.prefix); err != nil {
+		return cw.n, err
+	}
+
+	bodyEdited := !src.multipart && !src.message && m.bodyEdited()
+	if err := m.writeSourceHeader(cw, bodyEdited); err != nil {
+		return cw.n, err
+	}
+
+	var err error
+	switch {
+	case bodyEdited:
+		_, err = m.writeBody(cw, 0)
+	case src.multipart && m.partsEdited():
+		_, params, _ := m.Header.ContentType()
+		_, err = m.writeParts(cw, params["boundary"], 0)
+	case src.multipart:
+		for i, part := range m.Parts {
+			if _, err = cw.Write(src.seps[i]); err != nil {
+				return cw.n, err
+			}
+			if _, err = part.WriteTo(cw); err != nil {
+				return cw.n, err
+			}
+		}
+		_, err = cw.Write(src.seps[len(src.seps)-1])
+	case src.message:
+		if m.SubMessage != nil {
+			_, err = m.SubMessage.WriteTo(cw)
+		}
+	default:
+		_, err = cw.Write(src.body)
+	}
+	return cw.n, err
+}
+
+// writeSourceHeader writes the header of a parsed message, as read if it was
+// not edited. A body to be encoded again is written with its own
+// Content-Transfer-Encoding and blank line, by writeBody.
+func (m *Message) writeSourceHeader(w io.Writer, bodyEdited bool) error {
+	src := m.source
+	if !bodyEdited && !m.headerEdited() {
+		_, err := w.Write(src.header)
+		return err
+	}
+
+	fields := m.Fields
+	if m.headerEdited() {
+		fields = m.mergedFields()
+	}
+	if bodyEdited && !m.Header.IsSet("Content-Transfer-Encoding") {
+		fields = append(Fields(nil), fields...)
+		fields.Del("Content-Transfer-Encoding")
+	}
+	if _, err := fields.WriteTo(w); err != nil {
+		return err
+	}
+	if bodyEdited {
+		return nil
+	}
+	_, err := io.WriteString(w, blankLine(src.header))
+	return err
+}
+
+// mergedFields returns Fields updated with the edits made to Header since the
+// message was parsed: the fields of an edited key take the new values in
+// place, values beyond the fields are added after the last field.
+func (m *Message) mergedFields() Fields {
+	fields := append(Fields(nil), m.Fields...)
+	keys := sortedHeaderFields(m.Header)
+	for _, key := range sortedHeaderFields(m.source.values) {
+		if _, ok := m.Header[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		if !equalValues(m.Header[key], m.source.values[key]) {
+			fields.replace(key, m.Header[key])
+		}
+	}
+	return fields
+}
+
+// replace sets the values of the fields associated with key in place, deleting
+// the fields left over, and adding the values left over after the last field.
+func (fs *Fields) replace(key string, values []string) {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	fields := make(Fields, 0, len(*fs)+len(values))
+	i := 0
+	for _, f := range *fs {
+		if f.Key() != key {
+			fields = append(fields, f)
+		} else if i < len(values) {
+			fields = append(fields, &Field{Name: f.Name, Value: values[i]})
+			i++
+		}
+	}
+	for ; i < len(values); i++ {
+		fields = append(fields, &Field{Name: key, Value: values[i]})
+	}
+	*fs = fields
+}
+
+// blankLine returns the line break ending a header block.
+func blankLine(header []byte) string {
+	if bytes.HasSuffix(header, []byte("\r\n")) || !bytes.HasSuffix(header, []byte("\n")) {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// equalHeader ...
+func equalHeader(a, b Header) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, values := range a {
+		if other, ok := b[key]; !ok || !equalValues(values, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalValues ...
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// equalFields ...
+func equalFields(a, b Fields) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Value != b[i].Value || !bytes.Equal(a[i].Raw, b[i].Raw) {
+			return false
+		}
+	}
+	return true
+}
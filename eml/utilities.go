@@ -2,7 +2,6 @@ package eml
 
 import (
 	"bufio"
-	"bytes"
 	"crypto/rand"
 	"fmt"
 	"io"
@@ -45,14 +44,6 @@ func generateID(appendWith string) (string, error) {
 	return fmt.Sprintf("%d.%d.%d.%s@%s", nanoTime, pid, random, appendWith, hostname), nil
 }
 
-// max ...
-func max(x, y int) int {
-	if x > y {
-		return x
-	}
-	return y
-}
-
 // sortedHeaderFields ...
 func sortedHeaderFields(stringMap map[string][]string) []string {
 	keyCount := 0
@@ -73,43 +64,6 @@ func bufioReader(r io.Reader) *bufio.Reader {
 	return bufio.NewReader(r)
 }
 
-// headerWriter ...
-type headerWriter struct {
-	w          io.Writer
-	curLineLen int
-	maxLineLen int
-}
-
-// Write ...
-func (w *headerWriter) Write(p []byte) (int, error) {
-	// TODO: logic for wrapping headers is actually pretty complex for some header types, like received headers
-	var total int
-	for len(p)+w.curLineLen > w.maxLineLen {
-		toWrite := w.maxLineLen - w.curLineLen
-		// Wrap at last space, if any
-		lastSpace := bytes.LastIndexByte(p[:toWrite], byte(' '))
-		if lastSpace > 0 {
-			toWrite = lastSpace
-		}
-		written, err := w.w.Write(p[:toWrite])
-		total += written
-		if err != nil {
-			return total, err
-		}
-		written, err = w.w.Write([]byte("\r\n "))
-		total += written
-		if err != nil {
-			return total, err
-		}
-		p = p[toWrite:]
-		w.curLineLen = 1 // Continuation lines are indented
-	}
-	written, err := w.w.Write(p)
-	total += written
-	w.curLineLen += written
-	return total, err
-}
-
 // base64Writer ...
 type base64Writer struct {
 	w          io.Writer
@@ -141,39 +95,17 @@ func (w *base64Writer) Write(p []byte) (int, error) {
 	return total, err
 }
 
-// leftTrimReader ...
-type leftTrimReader struct {
-	r    *bufio.Reader
-	done bool
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
 }
 
-// Read ...
-func (r *leftTrimReader) Read(p []byte) (n3 int, err3 error) {
-	if r.done {
-		// Delegate
-		return r.r.Read(p)
-	}
-	// Peek and discard any whitespace, until we hit the first non-whitespace byte, then delegate
-	r.r.Peek(1) // force a buffer load if empty
-	maxBuffered := r.r.Buffered()
-	if maxBuffered == 0 {
-		r.done = true
-		return r.r.Read(p)
-	}
-	peek, _ := r.r.Peek(maxBuffered)
-	maxBuffered = len(peek)
-	whiteSpaceCount := 0
-	for whiteSpaceCount < maxBuffered && isASCIISpace(peek[whiteSpaceCount]) {
-		whiteSpaceCount++
-	}
-	if whiteSpaceCount > 0 {
-		discarded, err := r.r.Discard(whiteSpaceCount)
-		if err == nil && discarded == whiteSpaceCount && whiteSpaceCount == maxBuffered {
-			return r.Read(p)
-		}
-	}
-	r.done = true
-	return r.r.Read(p)
+// Write ...
+func (w *countWriter) Write(p []byte) (int, error) {
+	written, err := w.w.Write(p)
+	w.n += int64(written)
+	return written, err
 }
 
 // isASCIISpace ...
@@ -0,0 +1,272 @@
+package emlx
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mel2oo/mailfile"
+	"github.com/mel2oo/mailfile/eml"
+)
+
+// ErrInvalidLength is returned when the leading byte count line is missing or malformed.
+var ErrInvalidLength = errors.New("invalid emlx byte count")
+
+// partialSuffix is the extension of messages whose attachments are stored outside the file.
+const partialSuffix = ".partial.emlx"
+
+// Message is an Apple Mail message: the RFC 5322 message and its property list metadata.
+type Message struct {
+	*eml.Message
+
+	// Metadata is the decoded trailing property list.
+	Metadata Metadata
+
+	// Partial is true if the message was read from a .partial.emlx file.
+	Partial bool
+}
+
+// Metadata holds the well known keys of the emlx property list.
+type Metadata struct {
+	Flags           uint64
+	DateReceived    time.Time
+	DateSent        time.Time
+	DateLastViewed  time.Time
+	RemoteID        string
+	OriginalMailbox string
+	ConversationID  int64
+	Subject         string
+	Sender          string
+	To              string
+
+	// Plist is the full decoded property list.
+	Plist map[string]interface{}
+}
+
+// Flag bits of the "flags" property.
+const (
+	FlagRead       = 1 << 0
+	FlagDeleted    = 1 << 1
+	FlagAnswered   = 1 << 2
+	FlagEncrypted  = 1 << 3
+	FlagFlagged    = 1 << 4
+	FlagRecent     = 1 << 5
+	FlagDraft      = 1 << 6
+	FlagInitial    = 1 << 7
+	FlagForwarded  = 1 << 8
+	FlagRedirected = 1 << 9
+	FlagSigned     = 1 << 23
+	FlagJunk       = 1 << 24
+	FlagNotJunk    = 1 << 25
+)
+
+// New reads an .emlx or .partial.emlx file. For partial messages, attachments
+// stored in the sibling "Attachments" directory are put back into their parts.
+func New(file string) (*Message, error) {
+	fi, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+
+	m, err := Parse(fi)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasSuffix(file, partialSuffix) {
+		m.Partial = true
+		id := strings.TrimSuffix(filepath.Base(file), partialSuffix)
+		// .../Messages/123.partial.emlx -> .../Attachments/123/
+		dir := filepath.Join(filepath.Dir(filepath.Dir(file)), "Attachments", id)
+		if err := m.Reattach(dir); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Parse parses an emlx stream: a byte count line, the message, and a property list.
+func Parse(r io.Reader) (*Message, error) {
+	reader := bufio.NewReader(r)
+
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || length < 0 {
+		return nil, ErrInvalidLength
+	}
+
+	// the count is not trusted to size a buffer
+	data, err := io.ReadAll(io.LimitReader(reader, int64(length)))
+	if err != nil {
+		return nil, fmt.Errorf("read emlx message: %w", err)
+	}
+	if len(data) < length {
+		return nil, fmt.Errorf("read emlx message: %w", io.ErrUnexpectedEOF)
+	}
+
+	msg, err := eml.ParseMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Message{Message: msg}
+	if plist, err := decodePlist(reader); err == nil {
+		if dict, ok := plist.(map[string]interface{}); ok {
+			m.Metadata = newMetadata(dict)
+		}
+	}
+	return m, nil
+}
+
+// newMetadata ...
+func newMetadata(dict map[string]interface{}) Metadata {
+	md := Metadata{Plist: dict}
+	if v, ok := dict["flags"].(int64); ok {
+		md.Flags = uint64(v)
+	}
+	md.DateReceived = plistTime(dict["date-received"])
+	md.DateSent = plistTime(dict["date-sent"])
+	md.DateLastViewed = plistTime(dict["date-last-viewed"])
+	md.RemoteID = plistString(dict["remote-id"])
+	md.OriginalMailbox = plistString(dict["original-mailbox"])
+	md.Subject = plistString(dict["subject"])
+	md.Sender = plistString(dict["sender"])
+	md.To = plistString(dict["to"])
+	if v, ok := dict["conversation-id"].(int64); ok {
+		md.ConversationID = v
+	}
+	return md
+}
+
+// plistTime converts the seconds since 1970 stored by Apple Mail.
+func plistTime(v interface{}) time.Time {
+	switch t := v.(type) {
+	case int64:
+		return time.Unix(t, 0).UTC()
+	case float64:
+		return time.Unix(0, int64(t*float64(time.Second))).UTC()
+	case time.Time:
+		return t
+	}
+	return time.Time{}
+}
+
+// plistString ...
+func plistString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case int64:
+		return strconv.FormatInt(s, 10)
+	}
+	return ""
+}
+
+// AttachmentCount returns the number of attachments recorded in the flags.
+func (md Metadata) AttachmentCount() int {
+	return int(md.Flags>>10) & 0x3f
+}
+
+// FlagList converts the flags property to mailfile.Flag* values.
+func (md Metadata) FlagList() []string {
+	flags := make([]string, 0)
+	if md.Flags&FlagRead != 0 {
+		flags = append(flags, mailfile.FlagSeen)
+	}
+	if md.Flags&FlagAnswered != 0 {
+		flags = append(flags, mailfile.FlagReplied)
+	}
+	if md.Flags&FlagFlagged != 0 {
+		flags = append(flags, mailfile.FlagFlagged)
+	}
+	if md.Flags&FlagDeleted != 0 {
+		flags = append(flags, mailfile.FlagTrashed)
+	}
+	if md.Flags&FlagDraft != 0 {
+		flags = append(flags, mailfile.FlagDraft)
+	}
+	if md.Flags&(FlagForwarded|FlagRedirected) != 0 {
+		flags = append(flags, mailfile.FlagPassed)
+	}
+	if md.Flags&FlagRecent != 0 {
+		flags = append(flags, mailfile.FlagRecent)
+	}
+	return flags
+}
+
+// Reattach fills the bodies of parts that Apple Mail stored outside of a
+// .partial.emlx file. dir is the message's attachment directory, which holds one
+// sub directory per MIME part number ("2", "1.3", ...) containing the part's file.
+func (m *Message) Reattach(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return reattach(m.Message, dir, "")
+}
+
+// reattach walks the parts of msg using IMAP part numbering.
+func reattach(msg *eml.Message, dir, number string) error {
+	if msg.HasParts() {
+		for i, part := range msg.Parts {
+			partNumber := strconv.Itoa(i + 1)
+			if number != "" {
+				partNumber = number + "." + partNumber
+			}
+			if err := reattach(part, dir, partNumber); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !msg.Header.IsSet("X-Apple-Content-Length") || len(bytes.TrimSpace(msg.Body)) > 0 {
+		return nil
+	}
+	if number == "" {
+		number = "1"
+	}
+
+	files, err := os.ReadDir(filepath.Join(dir, number))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, number, f.Name()))
+		if err != nil {
+			return err
+		}
+		msg.Body = data
+		break
+	}
+	return nil
+}
+
+// Format returns the normalized message with the property list flags attached.
+func (m *Message) Format() *mailfile.Message {
+	msg := m.Message.Format()
+	msg.Flags = m.Metadata.FlagList()
+	if len(msg.Date) == 0 && !m.Metadata.DateSent.IsZero() {
+		msg.Date = m.Metadata.DateSent.Format(time.RFC1123Z)
+	}
+	return msg
+}
@@ -3,8 +3,6 @@ module github.com/mel2oo/mailfile
 go 1.18
 
 require (
-	github.com/axgle/mahonia v0.0.0-20180208002826-3358181d7394
-	github.com/djimenez/iconv-go v0.0.0-20160305225143-8960e66bd3da
 	github.com/richardlehane/mscfb v1.0.4
 	github.com/stretchr/testify v1.8.1
 	golang.org/x/text v0.4.0
@@ -0,0 +1,249 @@
+package maildir
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mel2oo/mailfile"
+	"github.com/mel2oo/mailfile/eml"
+)
+
+// Entry describes a single message file found while walking a mail folder tree.
+type Entry struct {
+	// Path is the location of the message file on disk.
+	Path string
+	// Folder is the mailbox the message belongs to, "INBOX" for the root folder.
+	// Nested folders are separated by "/".
+	Folder string
+	// Subdir is the Maildir sub directory ("cur", "new" or "tmp"),
+	// and is empty for MH folders.
+	Subdir string
+	// Flags are the message flags, see the mailfile.Flag* constants.
+	Flags []string
+	// Delivered is the delivery time encoded in a Maildir filename,
+	// and is zero if the filename does not carry one.
+	Delivered time.Time
+	// Size is the "S=" size hint of a Maildir filename, or 0 if absent.
+	Size int64
+}
+
+// WalkFunc is called for every message found by Walk. If the message could not
+// be read or parsed, msg is nil and err describes the failure. Returning a non-nil
+// error stops the walk, and Walk returns that error.
+type WalkFunc func(entry *Entry, msg *mailfile.Message, err error) error
+
+// RootFolder is the folder name given to messages in the top level mailbox.
+const RootFolder = "INBOX"
+
+// Walk walks the Maildir (including Maildir++ sub folders) or MH folder tree
+// rooted at root, parsing every message with eml.ParseMessage and calling fn
+// with the normalized message, which has its Folder and Flags filled in.
+func Walk(root string, fn WalkFunc) error {
+	if IsMaildir(root) {
+		return walkMaildir(root, fn)
+	}
+	return walkMH(root, RootFolder, fn)
+}
+
+// IsMaildir reports whether dir contains the cur, new and tmp sub directories.
+func IsMaildir(dir string) bool {
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		fi, err := os.Stat(filepath.Join(dir, sub))
+		if err != nil || !fi.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+// walkMaildir ...
+func walkMaildir(root string, fn WalkFunc) error {
+	if err := walkMaildirFolder(root, RootFolder, fn); err != nil {
+		return err
+	}
+
+	// Maildir++ sub folders live next to cur/new/tmp as ".Name" or ".Parent.Child"
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		name := d.Name()
+		if !d.IsDir() || len(name) < 2 || name[0] != '.' || name == ".." {
+			continue
+		}
+		dir := filepath.Join(root, name)
+		if !IsMaildir(dir) {
+			continue
+		}
+		folder := strings.ReplaceAll(strings.TrimPrefix(name, "."), ".", "/")
+		if err := walkMaildirFolder(dir, folder, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkMaildirFolder ...
+func walkMaildirFolder(dir, folder string, fn WalkFunc) error {
+	for _, sub := range []string{"new", "cur", "tmp"} {
+		files, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+				continue
+			}
+			entry := &Entry{
+				Path:   filepath.Join(dir, sub, f.Name()),
+				Folder: folder,
+				Subdir: sub,
+			}
+			entry.Delivered, entry.Size, entry.Flags = ParseFilename(f.Name())
+			if sub == "new" {
+				entry.Flags = append(entry.Flags, mailfile.FlagRecent)
+			}
+			if err := visit(entry, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// walkMH ...
+func walkMH(dir, folder string, fn WalkFunc) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	seqs, _ := ReadSequences(filepath.Join(dir, ".mh_sequences"))
+
+	var numbers []int
+	var subdirs []string
+	for _, f := range files {
+		if f.IsDir() {
+			if !strings.HasPrefix(f.Name(), ".") {
+				subdirs = append(subdirs, f.Name())
+			}
+			continue
+		}
+		// MH messages are named by their number, anything else is folder metadata
+		if n, err := strconv.Atoi(f.Name()); err == nil && n > 0 {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+
+	for _, n := range numbers {
+		entry := &Entry{
+			Path:   filepath.Join(dir, strconv.Itoa(n)),
+			Folder: folder,
+			Flags:  seqs.Flags(n),
+		}
+		if err := visit(entry, fn); err != nil {
+			return err
+		}
+	}
+
+	for _, sub := range subdirs {
+		child := sub
+		if folder != RootFolder {
+			child = folder + "/" + sub
+		}
+		if err := walkMH(filepath.Join(dir, sub), child, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// visit parses the message of entry and hands it to fn.
+func visit(entry *Entry, fn WalkFunc) error {
+	m, err := eml.New(entry.Path)
+	if err != nil {
+		return fn(entry, nil, err)
+	}
+
+	msg := m.Format()
+	msg.Folder = entry.Folder
+	msg.Flags = entry.Flags
+	return fn(entry, msg, nil)
+}
+
+// ParseFilename parses a Maildir filename of the form
+// "1204680122.M20191P13011.host,S=1234:2,RS", returning the delivery time,
+// the size hint, and the flags from the info suffix.
+func ParseFilename(name string) (delivered time.Time, size int64, flags []string) {
+	unique, info := name, ""
+	// ':' is the standard info separator, '!' and ';' are used where ':' is not allowed
+	if idx := strings.LastIndexAny(name, ":!;"); idx >= 0 {
+		unique, info = name[:idx], name[idx+1:]
+	}
+
+	for _, field := range strings.Split(unique, ",")[1:] {
+		if strings.HasPrefix(field, "S=") {
+			size, _ = strconv.ParseInt(field[2:], 10, 64)
+		}
+	}
+
+	delivered = parseDeliveryTime(strings.SplitN(unique, ",", 2)[0])
+	flags = ParseInfo(info)
+	return
+}
+
+// parseDeliveryTime parses the "seconds[.M<microseconds>...]" prefix of a unique name.
+func parseDeliveryTime(unique string) time.Time {
+	parts := strings.SplitN(unique, ".", 3)
+	secs, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || secs <= 0 {
+		return time.Time{}
+	}
+
+	var usec int64
+	if len(parts) > 1 {
+		// the middle part is a sequence of letter+number pairs, e.g. "M20191P13011"
+		if idx := strings.IndexByte(parts[1], 'M'); idx >= 0 {
+			digits := parts[1][idx+1:]
+			end := 0
+			for end < len(digits) && digits[end] >= '0' && digits[end] <= '9' {
+				end++
+			}
+			usec, _ = strconv.ParseInt(digits[:end], 10, 64)
+		}
+	}
+	return time.Unix(secs, usec*int64(time.Microsecond)).UTC()
+}
+
+// ParseInfo parses the Maildir info part "2,FLAGS" that follows the ':' separator.
+// Experimental "1," infos carry no flags.
+func ParseInfo(info string) []string {
+	if !strings.HasPrefix(info, "2,") {
+		return nil
+	}
+
+	flags := make([]string, 0)
+	for _, c := range info[2:] {
+		switch c {
+		case 'P':
+			flags = append(flags, mailfile.FlagPassed)
+		case 'R':
+			flags = append(flags, mailfile.FlagReplied)
+		case 'S':
+			flags = append(flags, mailfile.FlagSeen)
+		case 'T':
+			flags = append(flags, mailfile.FlagTrashed)
+		case 'D':
+			flags = append(flags, mailfile.FlagDraft)
+		case 'F':
+			flags = append(flags, mailfile.FlagFlagged)
+		}
+	}
+	return flags
+}
@@ -0,0 +1,89 @@
+package maildir
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mel2oo/mailfile"
+)
+
+// Sequences holds the named message sequences of an MH folder,
+// as stored in its ".mh_sequences" file.
+type Sequences map[string][]Range
+
+// Range is an inclusive range of message numbers.
+type Range struct {
+	First, Last int
+}
+
+// Contains reports whether message number n is in the named sequence.
+func (s Sequences) Contains(name string, n int) bool {
+	for _, r := range s[name] {
+		if n >= r.First && n <= r.Last {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadSequences reads and parses an MH ".mh_sequences" file, which has lines like
+// "unseen: 1-3 7 12".
+func ReadSequences(file string) (Sequences, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Sequences{}, err
+	}
+	defer f.Close()
+
+	seqs := make(Sequences)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, list, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		for _, item := range strings.Fields(list) {
+			first, last, isRange := strings.Cut(item, "-")
+			lo, err := strconv.Atoi(first)
+			if err != nil {
+				continue
+			}
+			hi := lo
+			if isRange {
+				if hi, err = strconv.Atoi(last); err != nil {
+					continue
+				}
+			}
+			seqs[name] = append(seqs[name], Range{First: lo, Last: hi})
+		}
+	}
+	return seqs, scanner.Err()
+}
+
+// Flags returns the flags of message number n.
+// A message is seen unless it belongs to the "unseen" sequence.
+func (s Sequences) Flags(n int) []string {
+	flags := make([]string, 0)
+	if !s.Contains("unseen", n) {
+		flags = append(flags, mailfile.FlagSeen)
+	}
+	if s.Contains("replied", n) {
+		flags = append(flags, mailfile.FlagReplied)
+	}
+	if s.Contains("flagged", n) {
+		flags = append(flags, mailfile.FlagFlagged)
+	}
+	if s.Contains("forwarded", n) {
+		flags = append(flags, mailfile.FlagPassed)
+	}
+	if s.Contains("deleted", n) {
+		flags = append(flags, mailfile.FlagTrashed)
+	}
+	if s.Contains("draft", n) {
+		flags = append(flags, mailfile.FlagDraft)
+	}
+	return flags
+}
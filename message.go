@@ -7,13 +7,14 @@ import (
 	"fmt"
 	"io"
 	"net/mail"
-	"regexp"
 )
 
 type Message struct {
 	// 邮件头
 	// Received段：路由信息，记录了邮件传递过程。
 	Headers mail.Header `json:"-"`
+	// 邮件头字段名，按出现顺序排列，保留原始大小写，用于识别发信客户端。
+	HeaderOrder []string `json:"-"`
 
 	MessageID string `json:"message-id"`
 
@@ -41,9 +42,13 @@ type Message struct {
 	Cc []*mail.Address `json:"cc"`
 	// 表示密送的邮件地址。
 	Bcc []*mail.Address `json:"bcc"`
+	// 重发 (Resent-*) 信息，邮件被转发给新的收件人时添加，最近一次在前。
+	Resent []Resent `json:"resent"`
 
 	// 标识了邮件内容的格式
 	ContentType string `json:"content-type"`
+	// 邮件正文实际使用的字符集（已转换为 UTF-8）
+	Charset string `json:"charset"`
 
 	// 邮件正文内容
 	Body io.Reader `json:"-"`
@@ -57,6 +62,50 @@ type Message struct {
 	Attachments []Attachment `json:"attachment"`
 	// 邮件附件，子邮件类型
 	SubMessage []*Message `json:"sub-message"`
+
+	// 邮件所在的文件夹路径，来自邮箱归档（Maildir/MH 等）。
+	Folder string `json:"folder"`
+	// 邮件状态标记（已读、已回复、旗标等），来自邮箱归档的元数据。
+	Flags []string `json:"flags"`
+	// 邮件分类标签（Outlook categories 等）
+	Categories []string `json:"categories"`
+
+	// 分析时得出的认证结果（SPF、DKIM、DMARC 等），按检查顺序排列。
+	Auth []AuthResult `json:"auth"`
+}
+
+// 邮件状态标记
+const (
+	FlagSeen    = "seen"
+	FlagReplied = "replied"
+	FlagFlagged = "flagged"
+	FlagTrashed = "trashed"
+	FlagDraft   = "draft"
+	FlagPassed  = "passed"
+	FlagRecent  = "recent"
+)
+
+// Resent 是一组重发字段
+type Resent struct {
+	Date      string          `json:"date"`
+	MessageID string          `json:"message-id"`
+	Sender    *mail.Address   `json:"sender"`
+	From      []*mail.Address `json:"from"`
+	To        []*mail.Address `json:"to"`
+	Cc        []*mail.Address `json:"cc"`
+	Bcc       []*mail.Address `json:"bcc"`
+}
+
+// AuthResult 是一项认证检查的结果，字段与 Authentication-Results (RFC 8601) 对应
+type AuthResult struct {
+	// 检查方法，如 "spf"、"dkim"、"dmarc"
+	Method string `json:"method"`
+	// 检查结果，如 "pass"、"fail"、"softfail"、"none"
+	Result string `json:"result"`
+	// 结果的说明
+	Reason string `json:"reason"`
+	// 检查涉及的属性，如 "smtp.mailfrom"、"header.d"、"header.from"
+	Properties map[string]string `json:"properties"`
 }
 
 type Attachment struct {
@@ -69,33 +118,20 @@ type Embedded struct {
 	CID         string    `json:"cid"`
 	ContentType string    `json:"content-type"`
 	Data        io.Reader `json:"-"`
+	// MHTML 资源的 Content-Location
+	Location string `json:"location"`
 }
 
-var ipRegex = regexp.MustCompile(`(?:\d{1,3}\.){3}\d{1,3}`)
-
+// GetSenderIP 返回邮件最初发出的公网地址，见 ParseTrace
 func GetSenderIP(headers mail.Header) (ip string, err error) {
-	list, ok := headers["Received"]
-	if !ok || len(list) == 0 {
+	if len(headers["Received"]) == 0 {
 		return ip, errors.New("received not found")
 	}
-	// var iplist []string
-	// for index := len(list) - 1; index >= 0; index-- {
-	// 	value := list[len(list)-1]
-	// 	left := strings.Index(value, "[")
-	// 	right := strings.Index(value, "]")
-	// 	if right-left < 7 {
-	// 		continue
-	// 	}
-	// 	iplist = append(iplist, value[left+1:right])
-	// }
-
-	value := list[len(list)-1]
-	IpList := ipRegex.FindAllString(value, -1)
-
-	if len(IpList) == 0 {
+	trace := ParseTrace(headers)
+	if len(trace.OriginatingIP) == 0 {
 		return ip, errors.New("address not found")
 	}
-	return IpList[0], nil
+	return trace.OriginatingIP, nil
 }
 
 func (m *Message) Output() {
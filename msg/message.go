@@ -14,6 +14,7 @@ func ParseProps(msg *mailfile.Message, m MetaData) {
 
 	if header, ok := m["TransportMessageHeaders"].(string); ok {
 		msg.Headers = Headers(header)
+		msg.HeaderOrder = HeaderOrder(header)
 		msg.SenderAddress, _ = mailfile.GetSenderIP(msg.Headers)
 	}
 
@@ -33,22 +34,17 @@ func ParseProps(msg *mailfile.Message, m MetaData) {
 
 	_, ok = msg.Headers["From"]
 	if ok {
-		for _, str1 := range msg.Headers["From"] {
-			addrs, err := mail.ParseAddressList(str1)
-			if err == nil {
-				msg.From = append(msg.From, addrs...)
-			}
-		}
+		msg.From = addressList(msg.Headers["From"])
 	} else {
 		fromlist, ok := m["SenderRepresentingSmtpAddress"].(string)
 		if ok {
-			msg.From, _ = mail.ParseAddressList(fromlist)
+			msg.From, _ = mailfile.ParseAddressList(fromlist)
 		}
 	}
 
 	_, ok = msg.Headers["Sender"]
 	if ok {
-		msg.Sender, _ = mail.ParseAddress(msg.Headers["Sender"][0])
+		msg.Sender, _ = mailfile.ParseAddress(msg.Headers["Sender"][0])
 	} else {
 		if len(msg.From) > 0 {
 			msg.Sender = msg.From[0]
@@ -57,54 +53,35 @@ func ParseProps(msg *mailfile.Message, m MetaData) {
 
 	_, ok = msg.Headers["Reply-To"]
 	if ok {
-		for _, str1 := range msg.Headers["Reply-To"] {
-			addrs, err := mail.ParseAddressList(str1)
-			if err == nil {
-				msg.ReplyTo = append(msg.ReplyTo, addrs...)
-			}
-		}
+		msg.ReplyTo = addressList(msg.Headers["Reply-To"])
 	} else {
 		replytolist, ok := m["ReplyRecipientNames"].(string)
 		if ok {
-			msg.ReplyTo, _ = mail.ParseAddressList(replytolist)
+			msg.ReplyTo, _ = mailfile.ParseAddressList(replytolist)
 		}
 	}
 
 	to1, ok1 := msg.Headers["To"]
 	to2, ok2 := msg.Headers["DisplayTo"]
 	if ok1 || ok2 {
-		for _, str1 := range append(to1, to2...) {
-			addrs, err := mail.ParseAddressList(str1)
-			if err == nil {
-				msg.To = append(msg.To, addrs...)
-			}
-		}
+		msg.To = addressList(append(to1, to2...))
 	} else {
 		tolist, ok := m["ReceivedRepresentingSmtpAddress"].(string)
 		if ok {
-			msg.To, _ = mail.ParseAddressList(tolist)
+			msg.To, _ = mailfile.ParseAddressList(tolist)
 		}
 	}
 
 	_, ok = msg.Headers["CC"]
 	if ok {
-		for _, str1 := range msg.Headers["CC"] {
-			addrs, err := mail.ParseAddressList(str1)
-			if err == nil {
-				msg.Cc = append(msg.Cc, addrs...)
-			}
-		}
+		msg.Cc = addressList(msg.Headers["CC"])
 	}
 
 	_, ok = msg.Headers["BCC"]
 	if ok {
-		for _, str1 := range msg.Headers["BCC"] {
-			addrs, err := mail.ParseAddressList(str1)
-			if err == nil {
-				msg.Bcc = append(msg.Bcc, addrs...)
-			}
-		}
+		msg.Bcc = addressList(msg.Headers["BCC"])
 	}
+	msg.Resent = mailfile.ParseResent(msg.Headers)
 
 	body, ok := m["Body"].(string)
 	if ok {
@@ -122,6 +99,17 @@ func ParseProps(msg *mailfile.Message, m MetaData) {
 	}
 }
 
+// addressList parses every value of an address field, skipping what is not
+// an address.
+func addressList(values []string) []*mail.Address {
+	var list []*mail.Address
+	for _, value := range values {
+		addrs, _ := mailfile.ParseAddressList(value)
+		list = append(list, addrs...)
+	}
+	return list
+}
+
 func ParseAttachment(msg *mailfile.Message, datas []UnpackData) {
 	var has bool
 	for _, data := range datas {
@@ -205,3 +193,15 @@ func Headers(hstr string) mail.Header {
 
 	return headers
 }
+
+// HeaderOrder returns the field names of a transport header, in order, as
+// Headers splits them.
+func HeaderOrder(hstr string) []string {
+	names := make([]string, 0)
+	for _, s := range strings.Split(strings.ReplaceAll(hstr, "\r\n", "\n"), "\n") {
+		if index := strings.Index(s, ": "); index >= 0 {
+			names = append(names, s[:index])
+		}
+	}
+	return names
+}
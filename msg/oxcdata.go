@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"io"
 	"math"
+	"unicode/utf8"
 
+	"github.com/mel2oo/mailfile"
+	"github.com/mel2oo/mailfile/charset"
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/transform"
 )
@@ -172,8 +175,16 @@ func PtypInteger64(data []byte) uint64 {
 
 // variable size;
 // a string of multibyte characters in externally specified encoding with terminating null character (single 0 byte).
+// The encoding is not known here, so it is detected, falling back to GB18030.
 func PtypString8(data []byte) string {
 	if len(data) > 0 {
+		if text := Trim(data); utf8.Valid(text) {
+			return string(text)
+		} else if name := charset.Best(text); len(name) > 0 {
+			if str, err := mailfile.ConvertData(text, name); err == nil {
+				return str
+			}
+		}
 
 		reader := transform.NewReader(bytes.NewReader(data), simplifiedchinese.GB18030.NewDecoder())
 
@@ -26,6 +26,18 @@ func New(file string) (*Stream, error) {
 	return NewStream(doc)
 }
 
+// Props returns the decoded properties of the top level message.
+func (s *Stream) Props() MetaData {
+	return s.UnpackData.props
+}
+
+// TransportHeaders returns the internet header of the top level message as
+// it was received, empty for messages that were never sent.
+func (s *Stream) TransportHeaders() string {
+	header, _ := s.UnpackData.props["TransportMessageHeaders"].(string)
+	return header
+}
+
 func (s *Stream) Format() *mailfile.Message {
 	msg := &mailfile.Message{}
 
@@ -581,3 +581,20 @@ var PROPS_ID_MAP = map[string]map[string]string{
 	"0xFFFC": {"data_type": "0x0102", "name": "AddressBookParentEntryId"},
 	"0xFFFD": {"data_type": "0x0003", "name": "AddressBookContainerId"},
 }
+
+// PROPS_TAG_MAP names properties whose meaning depends on the property type,
+// keyed by the full property tag.
+var PROPS_TAG_MAP = map[string]string{
+	"0x68020102": "RwRulesStream",
+}
+
+// RAW_PROPS lists the binary properties that are kept byte for byte,
+// instead of having their null bytes trimmed.
+var RAW_PROPS = map[string]bool{
+	"AttachDataObject":             true,
+	"ExtendedRuleMessageActions":   true,
+	"ExtendedRuleMessageCondition": true,
+	"RuleCondition":                true,
+	"RuleActions":                  true,
+	"RwRulesStream":                true,
+}
@@ -1,6 +1,8 @@
 package msg
 
 import (
+	"encoding/binary"
+	"fmt"
 	"io"
 	"strings"
 
@@ -17,6 +19,7 @@ type Stream struct {
 func NewStream(doc *mscfb.Reader) (*Stream, error) {
 	stream := &Stream{
 		origin: msoxstream{
+			header:  topLevelHeader,
 			props:   make([]*mscfb.File, 0),
 			subtag:  make(map[string]*msoxstream),
 			recips:  make(map[string]*msoxstream),
@@ -25,7 +28,7 @@ func NewStream(doc *mscfb.Reader) (*Stream, error) {
 	}
 
 	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
-		if strings.Contains(entry.Name, "__substg1.0_") {
+		if strings.Contains(entry.Name, "__substg1.0_") || entry.Name == propertiesStream {
 			stream.origin.setEntry(entry.Path, entry)
 		}
 	}
@@ -35,7 +38,19 @@ func NewStream(doc *mscfb.Reader) (*Stream, error) {
 	return stream, nil
 }
 
+// propertiesStream holds the fixed length properties of a message, recipient
+// or attachment, after a header whose size depends on the object
+// (MS-OXMSG 2.4).
+const (
+	propertiesStream = "__properties_version1.0"
+
+	topLevelHeader = 32
+	embeddedHeader = 24
+	objectHeader   = 8
+)
+
 type msoxstream struct {
+	header  int
 	props   []*mscfb.File
 	subtag  map[string]*msoxstream
 	recips  map[string]*msoxstream
@@ -50,6 +65,7 @@ func (s *msoxstream) setEntry(keys []string, entry *mscfb.File) {
 		if strings.Contains(keys[0], "__substg1.0_") {
 			if s.subtag[keys[0]] == nil {
 				s.subtag[keys[0]] = &msoxstream{
+					header:  embeddedHeader,
 					props:   make([]*mscfb.File, 0),
 					subtag:  make(map[string]*msoxstream),
 					recips:  make(map[string]*msoxstream),
@@ -62,6 +78,7 @@ func (s *msoxstream) setEntry(keys []string, entry *mscfb.File) {
 		if strings.Contains(keys[0], "__attach_") {
 			if s.attachs[keys[0]] == nil {
 				s.attachs[keys[0]] = &msoxstream{
+					header:  objectHeader,
 					props:   make([]*mscfb.File, 0),
 					subtag:  make(map[string]*msoxstream),
 					recips:  make(map[string]*msoxstream),
@@ -74,6 +91,7 @@ func (s *msoxstream) setEntry(keys []string, entry *mscfb.File) {
 		if strings.Contains(keys[0], "__recip_") {
 			if s.recips[keys[0]] == nil {
 				s.recips[keys[0]] = &msoxstream{
+					header:  objectHeader,
 					props:   make([]*mscfb.File, 0),
 					subtag:  make(map[string]*msoxstream),
 					recips:  make(map[string]*msoxstream),
@@ -128,6 +146,11 @@ func (m *msoxstream) unpack() MetaData {
 			continue
 		}
 
+		if entry.Name == propertiesStream {
+			m.unpackFixed(entry, metadata)
+			continue
+		}
+
 		if !strings.Contains(entry.Name, directory_name_filter) {
 			continue
 		}
@@ -142,7 +165,7 @@ func (m *msoxstream) unpack() MetaData {
 			continue
 		}
 
-		if property_name == "AttachDataObject" {
+		if RAW_PROPS[property_name] {
 			metadata[property_name] = data
 		} else {
 			metadata[property_name] = GetDataValue(property_type, data)
@@ -152,11 +175,50 @@ func (m *msoxstream) unpack() MetaData {
 	return metadata
 }
 
+// fixedSizes are the sizes of the property types whose values are stored in
+// the properties stream itself.
+var fixedSizes = map[uint16]int{
+	0x0002: 2, 0x0003: 4, 0x0004: 4, 0x0005: 8, 0x0006: 8,
+	0x0007: 8, 0x000A: 4, 0x000B: 1, 0x0014: 8, 0x0040: 8,
+}
+
+// unpackFixed reads the fixed length properties of the properties stream,
+// 16 bytes each: tag, flags and value. Values of the other types are in
+// their own streams.
+func (m *msoxstream) unpackFixed(entry *mscfb.File, metadata MetaData) {
+	data, err := io.ReadAll(entry)
+	if err != nil || len(data) < m.header {
+		return
+	}
+
+	for pos := m.header; pos+16 <= len(data); pos += 16 {
+		tag := binary.LittleEndian.Uint32(data[pos:])
+		size, ok := fixedSizes[uint16(tag)]
+		if !ok {
+			continue
+		}
+
+		namid := fmt.Sprintf("0x%04X", tag>>16)
+		property_type := fmt.Sprintf("0x%04X", tag&0xFFFF)
+		property_name, ok := PROPS_TAG_MAP[namid+property_type[2:]]
+		if !ok {
+			property_name = PROPS_ID_MAP[namid]["name"]
+		}
+		if _, ok := metadata[property_name]; ok || len(property_name) == 0 {
+			continue
+		}
+		metadata[property_name] = GetDataValue(property_type, data[pos+8:pos+8+size])
+	}
+}
+
 func (m *msoxstream) PropsNameType(entry *mscfb.File) (property_name, property_type string) {
 	if strings.Contains(entry.Name, "__substg1.0_") {
 		namid := "0x" + strings.ReplaceAll(entry.Name, "__substg1.0_", "")[0:4]
 		property_type = "0x" + strings.ReplaceAll(entry.Name, "__substg1.0_", "")[4:8]
 		props := PROPS_ID_MAP[namid]
+		if name, ok := PROPS_TAG_MAP[namid+property_type[2:]]; ok {
+			return name, property_type
+		}
 		if property_type != "0x0000" {
 			return props["name"], property_type
 		}
@@ -0,0 +1,109 @@
+package olm
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/mel2oo/mailfile/charset"
+	"golang.org/x/text/transform"
+)
+
+// node is a generic XML element, used because the OLM message schema varies
+// between Outlook for Mac versions.
+type node struct {
+	Name     string
+	Attrs    map[string]string
+	Text     string
+	Children []*node
+
+	// text collects the character data, split by entities into many tokens
+	buf strings.Builder
+}
+
+// parseNodes reads every top level element of an XML document.
+func parseNodes(r io.Reader) (*node, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.CharsetReader = func(name string, input io.Reader) (io.Reader, error) {
+		enc, err := charset.Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		return transform.NewReader(input, enc.NewDecoder()), nil
+	}
+
+	root := &node{}
+	stack := []*node{root}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			// elements left open keep the text read so far
+			for _, n := range stack {
+				n.Text = n.buf.String()
+			}
+			if err == io.EOF {
+				return root, nil
+			}
+			return root, err
+		}
+
+		current := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			n := &node{Name: t.Name.Local, Attrs: make(map[string]string)}
+			for _, attr := range t.Attr {
+				n.Attrs[attr.Name.Local] = attr.Value
+			}
+			current.Children = append(current.Children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				current.Text = current.buf.String()
+				current.buf.Reset()
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			current.buf.Write(t)
+		}
+	}
+}
+
+// child returns the first direct child with one of the given names.
+func (n *node) child(names ...string) *node {
+	if n == nil {
+		return nil
+	}
+	for _, c := range n.Children {
+		for _, name := range names {
+			if c.Name == name {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// text returns the trimmed text of the first child with one of the given names.
+func (n *node) text(names ...string) string {
+	c := n.child(names...)
+	if c == nil {
+		return ""
+	}
+	return strings.TrimSpace(c.Text)
+}
+
+// all returns every descendant named name, in document order.
+func (n *node) all(name string) []*node {
+	if n == nil {
+		return nil
+	}
+	var list []*node
+	for _, c := range n.Children {
+		if c.Name == name {
+			list = append(list, c)
+		}
+		list = append(list, c.all(name)...)
+	}
+	return list
+}
@@ -0,0 +1,317 @@
+package olm
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/mail"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mel2oo/mailfile"
+)
+
+// messagesDir is the path element under which every mail folder is stored.
+const messagesDir = "com.microsoft.__Messages"
+
+// attachmentsDir is the folder holding the attachment files of a mail folder.
+const attachmentsDir = "com.microsoft.__Attachments"
+
+// Archive is an Outlook for Mac .olm export, which is a zip archive of
+// per-message XML files and attachment files.
+type Archive struct {
+	reader *zip.Reader
+	closer io.Closer
+	files  map[string]*zip.File
+}
+
+// Entry describes a message XML file in the archive.
+type Entry struct {
+	// Path is the location of the XML file inside the archive.
+	Path string
+	// Account is the account the message belongs to, or "Local" for "On My Computer".
+	Account string
+	// Folder is the mail folder path, e.g. "Inbox/Projects".
+	Folder string
+}
+
+// WalkFunc is called for every message found by Walk. If the message could not
+// be read or parsed, msg is nil and err describes the failure. Returning a non-nil
+// error stops the walk, and Walk returns that error.
+type WalkFunc func(entry *Entry, msg *mailfile.Message, err error) error
+
+// New opens an .olm file.
+func New(file string) (*Archive, error) {
+	rc, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	a := NewArchive(&rc.Reader)
+	a.closer = rc
+	return a, nil
+}
+
+// NewReader reads an .olm archive of the given size from r.
+func NewReader(r io.ReaderAt, size int64) (*Archive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return NewArchive(zr), nil
+}
+
+// NewArchive wraps an already opened zip archive.
+func NewArchive(zr *zip.Reader) *Archive {
+	a := &Archive{reader: zr, files: make(map[string]*zip.File)}
+	for _, f := range zr.File {
+		a.files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+	return a
+}
+
+// Close closes the archive file, if it was opened by New.
+func (a *Archive) Close() error {
+	if a.closer != nil {
+		return a.closer.Close()
+	}
+	return nil
+}
+
+// Walk parses every message XML file in the archive, in path order.
+func (a *Archive) Walk(fn WalkFunc) error {
+	names := make([]string, 0)
+	for name := range a.files {
+		if isMessageFile(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		entry := newEntry(name)
+		msgs, err := a.readMessages(name)
+		if err != nil {
+			if err := fn(entry, nil, err); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, msg := range msgs {
+			msg.Folder = entry.Folder
+			if err := fn(entry, msg, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isMessageFile ...
+func isMessageFile(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".xml") &&
+		strings.Contains(name, messagesDir+"/") &&
+		!strings.Contains(name, attachmentsDir+"/")
+}
+
+// newEntry splits "Accounts/<account>/com.microsoft.__Messages/<folder...>/message.xml".
+func newEntry(name string) *Entry {
+	entry := &Entry{Path: name}
+	idx := strings.Index(name, messagesDir+"/")
+	prefix := strings.Trim(name[:idx], "/")
+	entry.Folder = path.Dir(name[idx+len(messagesDir)+1:])
+	if entry.Folder == "." {
+		entry.Folder = ""
+	}
+
+	elems := strings.Split(prefix, "/")
+	switch {
+	case len(elems) >= 2 && elems[0] == "Accounts":
+		entry.Account = elems[1]
+	case len(prefix) > 0:
+		entry.Account = elems[len(elems)-1]
+	}
+	return entry
+}
+
+// readMessages ...
+func (a *Archive) readMessages(name string) ([]*mailfile.Message, error) {
+	rc, err := a.files[name].Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	root, err := parseNodes(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]*mailfile.Message, 0, 1)
+	for _, email := range root.all("email") {
+		msgs = append(msgs, a.parseEmail(email, path.Dir(name)))
+	}
+	return msgs, nil
+}
+
+// parseEmail converts an <email> element into a normalized message.
+func (a *Archive) parseEmail(email *node, dir string) *mailfile.Message {
+	msg := &mailfile.Message{Headers: make(mail.Header)}
+
+	if raw := email.text("OPFMessageCopyInternetHeaders", "OPFMessageCopyHeaders"); len(raw) > 0 {
+		if m, err := mail.ReadMessage(strings.NewReader(strings.TrimSpace(raw) + "\r\n\r\n")); err == nil {
+			msg.Headers = m.Header
+			msg.SenderAddress, _ = mailfile.GetSenderIP(msg.Headers)
+			msg.ContentType = msg.Headers.Get("Content-Type")
+		}
+	}
+
+	msg.MessageID = email.text("OPFMessageCopyMessageID")
+	msg.Subject = email.text("OPFMessageCopySubject")
+	msg.Date = formatTime(email.text("OPFMessageCopySentTime", "OPFMessageCopyReceivedTime"))
+
+	msg.From = addresses(email.child("OPFMessageCopyFromAddresses"))
+	if sender := addresses(email.child("OPFMessageCopySenderAddress")); len(sender) > 0 {
+		msg.Sender = sender[0]
+	} else if len(msg.From) > 0 {
+		msg.Sender = msg.From[0]
+	}
+	msg.ReplyTo = addresses(email.child("OPFMessageCopyReplyToAddresses"))
+	msg.To = addresses(email.child("OPFMessageCopyToAddresses"))
+	msg.Cc = addresses(email.child("OPFMessageCopyCCAddresses"))
+	msg.Bcc = addresses(email.child("OPFMessageCopyBCCAddresses"))
+
+	for _, category := range email.all("category") {
+		if name := category.Attrs["OPFCategoryCopyName"]; len(name) > 0 {
+			msg.Categories = append(msg.Categories, name)
+		}
+	}
+
+	msg.Flags = flags(email)
+
+	var hdata, tdata []byte
+	hdata = []byte(email.text("OPFMessageCopyHTMLBody"))
+	body := email.text("OPFMessageCopyBody")
+	if len(hdata) == 0 && looksLikeHTML(body) {
+		hdata = []byte(body)
+	} else {
+		tdata = []byte(body)
+	}
+	if len(hdata) > 0 {
+		msg.Html = bytes.NewBuffer(hdata)
+	}
+	if len(tdata) > 0 {
+		msg.Body = bytes.NewBuffer(tdata)
+	} else if len(hdata) > 0 {
+		msg.Body = bytes.NewBuffer(hdata)
+	}
+	msg.Pwd = mailfile.ParsePasswd(hdata, tdata)
+
+	for _, att := range email.all("messageAttachment") {
+		a.parseAttachment(msg, att, dir)
+	}
+	return msg
+}
+
+// parseAttachment resolves an attachment's file inside the archive.
+func (a *Archive) parseAttachment(msg *mailfile.Message, att *node, dir string) {
+	name := att.Attrs["OPFAttachmentName"]
+	ctype := att.Attrs["OPFAttachmentContentType"]
+	cid := strings.Trim(att.Attrs["OPFAttachmentContentID"], "<>")
+
+	var data []byte
+	if url := strings.TrimPrefix(att.Attrs["OPFAttachmentURL"], "/"); len(url) > 0 {
+		f, ok := a.files[url]
+		if !ok {
+			f, ok = a.files[path.Join(dir, url)]
+		}
+		if ok {
+			if rc, err := f.Open(); err == nil {
+				data, _ = io.ReadAll(rc)
+				rc.Close()
+			}
+		}
+	}
+
+	if len(cid) > 0 && len(name) == 0 {
+		msg.Embeddeds = append(msg.Embeddeds, mailfile.Embedded{
+			CID:         cid,
+			ContentType: ctype,
+			Data:        bytes.NewBuffer(data),
+		})
+		return
+	}
+	msg.Attachments = append(msg.Attachments, mailfile.Attachment{
+		Filename:    name,
+		ContentType: ctype,
+		Data:        bytes.NewBuffer(data),
+	})
+}
+
+// addresses reads the <emailAddress> children of an address list element.
+func addresses(list *node) []*mail.Address {
+	if list == nil {
+		return nil
+	}
+	addrs := make([]*mail.Address, 0)
+	for _, addr := range list.all("emailAddress") {
+		address := addr.Attrs["OPFContactEmailAddressAddress"]
+		name := addr.Attrs["OPFContactEmailAddressName"]
+		if len(address) == 0 && len(name) == 0 {
+			continue
+		}
+		if name == address {
+			name = ""
+		}
+		addrs = append(addrs, &mail.Address{Name: name, Address: address})
+	}
+	return addrs
+}
+
+// flags maps the message state elements to mailfile.Flag* values.
+func flags(email *node) []string {
+	list := make([]string, 0)
+	for _, f := range []struct {
+		names []string
+		flag  string
+	}{
+		{[]string{"OPFMessageGetIsRead", "OPFMessageIsRead"}, mailfile.FlagSeen},
+		{[]string{"OPFMessageGetWasRepliedTo", "OPFMessageGetHasReplied"}, mailfile.FlagReplied},
+		{[]string{"OPFMessageGetWasForwarded", "OPFMessageGetHasForwarded"}, mailfile.FlagPassed},
+		{[]string{"OPFMessageGetIsFlagged", "OPFMessageIsFlagged"}, mailfile.FlagFlagged},
+		{[]string{"OPFMessageGetIsDraft", "OPFMessageIsDraft"}, mailfile.FlagDraft},
+	} {
+		switch strings.ToLower(email.text(f.names...)) {
+		case "1", "true", "yes":
+			list = append(list, f.flag)
+		}
+	}
+	return list
+}
+
+// looksLikeHTML ...
+func looksLikeHTML(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.HasPrefix(s, "<") && (strings.Contains(s, "<html") || strings.Contains(s, "<body") ||
+		strings.Contains(s, "<div") || strings.Contains(s, "<p"))
+}
+
+// timeLayouts are the date formats found in OLM message files.
+var timeLayouts = []string{
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+	"2006-01-02T15:04:05.000",
+	"2006-01-02 15:04:05",
+}
+
+// formatTime converts an OLM timestamp to the RFC 5322 date format used by
+// the other readers, keeping the original text if it can not be parsed.
+func formatTime(s string) string {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.RFC1123Z)
+		}
+	}
+	return s
+}
@@ -0,0 +1,320 @@
+package mailfile
+
+import (
+	"net"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Hop 是一个 Received 字段记录的一次投递
+type Hop struct {
+	// Received 字段原值
+	Raw string `json:"-"`
+
+	// 客户端在 HELO/EHLO 中声明的名字
+	Helo string `json:"helo"`
+	// 接收方反查到的客户端主机名
+	FromHost string `json:"from-host"`
+	// 客户端的 IPv4/IPv6 地址
+	FromIP string `json:"from-ip"`
+	// 接收方主机名
+	By string `json:"by"`
+	// 投递协议，如 "ESMTP"、"ESMTPS"、"HTTPS"
+	With string `json:"with"`
+	// TLS 版本、加密套件等信息
+	TLS string `json:"tls"`
+	ID  string `json:"id"`
+	// 收件人
+	For string `json:"for"`
+
+	// 接收时间，无法解析时为零值
+	Date time.Time `json:"date"`
+	// 与上一跳接收时间的间隔，时间未知时为 0
+	Delay time.Duration `json:"delay"`
+}
+
+// Trace 是邮件的 Received 链
+type Trace struct {
+	// 各跳按投递顺序排列，最早的一跳在前
+	Hops []*Hop `json:"hops"`
+
+	// 邮件最初发出的公网地址
+	OriginatingIP string `json:"originating-ip"`
+	// 得出 OriginatingIP 的字段，"Received" 或 "X-Originating-IP" 等
+	OriginatingField string `json:"originating-field"`
+	// Received 链中客户端为公网地址的最早一跳（可信范围内），
+	// 即 OriginatingIP 来自其他字段时，这一跳的客户端也是 SPF 等检查的对象
+	Origin *Hop `json:"-"`
+}
+
+// 客户端地址的字段，由 webmail 等添加
+var originatingFields = []string{"X-Originating-IP", "X-Sender-IP", "X-Source-IP"}
+
+// ParseTrace 解析全部 Received 字段，计算每跳的延时，并找出邮件最初发出的公网地址。
+//
+// trustedRelays 是内部中继的 IP 地址或网段（如 "10.0.0.0/8"、"203.0.113.25"）。
+// 从最新的一跳往前，第一跳由非内部中继投递的 Received 之前的字段可能是伪造的，不予采信，
+// 发出地址即这一跳的客户端；只有邮件由内部中继接收提交、没有这样的一跳时，
+// 才采信 X-Originating-IP 等字段中的公网地址。私有、回环等地址不会作为发出地址。
+//
+// 不指定 trustedRelays 时采信全部字段：X-Originating-IP 等字段优先，其次是最早一跳的公网客户端，
+// 发件人可在邮件中预先加入这些字段伪造发出地址，分析外部来信时应指定 trustedRelays。
+func ParseTrace(headers mail.Header, trustedRelays ...string) *Trace {
+	received := headers["Received"]
+	t := &Trace{Hops: make([]*Hop, 0, len(received))}
+	for i := len(received) - 1; i >= 0; i-- {
+		hop := ParseReceived(received[i])
+		if n := len(t.Hops); n > 0 && !hop.Date.IsZero() && !t.Hops[n-1].Date.IsZero() {
+			hop.Delay = hop.Date.Sub(t.Hops[n-1].Date)
+		}
+		t.Hops = append(t.Hops, hop)
+	}
+
+	// 可信的各跳：从最新的一跳往前，到第一跳由外部客户端投递的为止
+	trusted := parseNetworks(trustedRelays)
+	first := 0
+	if len(trusted) > 0 {
+		for i := len(t.Hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(t.Hops[i].FromIP)
+			if isPublicIP(ip) && !inNetworks(ip, trusted) {
+				first = i
+				break
+			}
+		}
+	}
+	for _, hop := range t.Hops[first:] {
+		ip := net.ParseIP(hop.FromIP)
+		if isPublicIP(ip) && !inNetworks(ip, trusted) {
+			t.OriginatingIP, t.OriginatingField, t.Origin = ip.String(), "Received", hop
+			break
+		}
+	}
+
+	// 有外部客户端投递的一跳时，X-Originating-IP 等字段由外部添加
+	if len(trusted) > 0 && t.Origin != nil {
+		return t
+	}
+	for _, field := range originatingFields {
+		for _, value := range headers[field] {
+			ip := net.ParseIP(strings.Trim(strings.TrimSpace(value), "[]"))
+			if isPublicIP(ip) && !inNetworks(ip, trusted) {
+				t.OriginatingIP, t.OriginatingField = ip.String(), field
+				return t
+			}
+		}
+	}
+	return t
+}
+
+var (
+	// 方括号中的地址，如 [192.0.2.1]、[IPv6:2001:db8::1]
+	bracketIPRegex = regexp.MustCompile(`\[(?i:IPv6:)?([0-9A-Fa-f:.]+)\]`)
+	// 注释中声明的 HELO，如 (HELO mail.example.com)、(helo=mail.example.com)、(HELO [0.0.0.0])
+	heloRegex = regexp.MustCompile(`(?i)\b(?:HELO|EHLO)(?:\s+|=)(\[[^\]]*\]|[^\s()\[\]]+)`)
+)
+
+// ParseReceived 解析一个 Received 字段，格式见 RFC 5321 4.4，
+// 并兼容 Postfix、Exim、Exchange、IronPort 等的注释
+func ParseReceived(value string) *Hop {
+	hop := &Hop{Raw: value}
+	value = strings.Join(strings.Fields(value), " ")
+
+	// 分号后是接收时间
+	if i := lastIndexOutside(value, ';'); i >= 0 {
+		if date, err := mail.ParseDate(strings.TrimSpace(value[i+1:])); err == nil {
+			hop.Date = date
+		}
+		value = value[:i]
+	}
+
+	var clause, prev, helo string
+	for _, item := range splitReceived(value) {
+		if strings.HasPrefix(item, "(") {
+			text := strings.TrimSpace(item[1 : len(item)-1])
+			if len(hop.TLS) == 0 && strings.Contains(strings.ToUpper(text), "TLS") {
+				hop.TLS = text
+			}
+			if clause == "from" {
+				if match := heloRegex.FindStringSubmatch(text); match != nil {
+					// 声明的地址字面量不是客户端地址
+					helo, text = match[1], strings.Replace(text, match[0], "", 1)
+				} else if word := strings.Fields(text); len(hop.FromHost) == 0 && len(word) > 0 && isHostName(word[0]) {
+					hop.FromHost = word[0]
+				}
+				if len(hop.FromIP) == 0 {
+					hop.FromIP = findIP(text)
+				}
+			}
+			continue
+		}
+
+		switch keyword := strings.ToLower(item); keyword {
+		case "from", "by", "via", "with", "id", "for":
+			clause, prev = keyword, ""
+			continue
+		}
+		switch clause {
+		case "from":
+			if len(hop.Helo) == 0 {
+				hop.Helo = item
+			}
+		case "by":
+			if len(hop.By) == 0 {
+				hop.By = item
+			}
+		case "with":
+			if len(hop.With) == 0 {
+				// IronPort: ESMTP/TLS/ECDHE-RSA-AES128-GCM-SHA256
+				proto, tls, _ := strings.Cut(item, "/")
+				hop.With = proto
+				if len(tls) > 0 && len(hop.TLS) == 0 {
+					hop.TLS = tls
+				}
+			} else if strings.EqualFold(prev, "tls") {
+				// Exim: with esmtps (TLS1.2) tls TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384
+				hop.TLS = strings.TrimSpace(hop.TLS + " " + item)
+			}
+		case "id":
+			if len(hop.ID) == 0 {
+				hop.ID = item
+			}
+		case "for":
+			if len(hop.For) == 0 {
+				hop.For = strings.Trim(item, "<>")
+			}
+		}
+		prev = item
+	}
+
+	// from 后面是地址字面量时，以注释中的地址为准
+	if strings.HasPrefix(hop.Helo, "[") && len(hop.FromIP) == 0 {
+		hop.FromIP = findIP(hop.Helo)
+	}
+	// IronPort: from 反查主机名 (HELO 声明名字) ([地址])；Exim: from 反查主机名 (helo=声明名字)
+	if len(helo) > 0 {
+		if len(hop.FromHost) == 0 && isHostName(hop.Helo) {
+			hop.FromHost = hop.Helo
+		}
+		hop.Helo = helo
+	}
+	return hop
+}
+
+// splitReceived 将 Received 字段拆分为单词和括号注释
+func splitReceived(value string) []string {
+	items := make([]string, 0)
+	for i := 0; i < len(value); {
+		switch value[i] {
+		case ' ':
+			i++
+		case '(':
+			depth, start := 0, i
+			for ; i < len(value); i++ {
+				if value[i] == '(' {
+					depth++
+				} else if value[i] == ')' {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+			if i == len(value) {
+				items = append(items, value[start:]+")")
+				break
+			}
+			i++
+			items = append(items, value[start:i])
+		default:
+			start := i
+			for i < len(value) && value[i] != ' ' && value[i] != '(' {
+				i++
+			}
+			items = append(items, value[start:i])
+		}
+	}
+	return items
+}
+
+// lastIndexOutside 返回括号外最后一个 c 的位置
+func lastIndexOutside(s string, c byte) int {
+	depth, index := 0, -1
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case c:
+			if depth == 0 {
+				index = i
+			}
+		}
+	}
+	return index
+}
+
+// findIP 返回文本中方括号内的地址，或单独成词的地址
+func findIP(text string) string {
+	for _, match := range bracketIPRegex.FindAllStringSubmatch(text, -1) {
+		if ip := net.ParseIP(match[1]); ip != nil {
+			return ip.String()
+		}
+	}
+	for _, word := range strings.Fields(text) {
+		if ip := net.ParseIP(strings.Trim(word, "[]")); ip != nil {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// isHostName 判断是否像主机名
+func isHostName(s string) bool {
+	if net.ParseIP(strings.Trim(s, "[]")) != nil || strings.ContainsAny(s, "=[]@:") {
+		return false
+	}
+	return strings.Contains(s, ".") || strings.EqualFold(s, "localhost")
+}
+
+// isPublicIP 判断是否为公网地址
+func isPublicIP(ip net.IP) bool {
+	return ip != nil && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsMulticast()
+}
+
+// parseNetworks 解析地址或网段，忽略无效的
+func parseNetworks(list []string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				continue
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if _, network, err := net.ParseCIDR(s); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
+
+// inNetworks ...
+func inNetworks(ip net.IP, networks []*net.IPNet) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
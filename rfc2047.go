@@ -0,0 +1,360 @@
+package mailfile
+
+import (
+	"encoding/base64"
+	"io"
+	"mime"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mel2oo/mailfile/charset"
+	"golang.org/x/text/transform"
+)
+
+// Decoded 是解码后的头部值或参数值，同时保留原始值。
+type Decoded struct {
+	// 原始值
+	Raw string `json:"raw"`
+	// 解码后的值
+	Value string `json:"value"`
+	// encoded-word 或 RFC 2231 声明的字符集，取第一个
+	Charset string `json:"charset"`
+	// RFC 2231 语言标记，如 =?utf-8*en?Q?...?= 或 filename*=utf-8'en'...
+	Language string `json:"language"`
+}
+
+// encoded-word: =?charset?encoding?text?=，结尾的 ?= 缺失时（被截断）也接受
+var expEncodedWord = regexp.MustCompile(`=\?([^?\s]+)\?([bBqQ])\?([^?]*)(?:\?=|$)`)
+
+// DecodeHeader 按 RFC 2047 解码头部值：
+//   - 相邻 encoded-word 之间的空白被忽略，encoded-word 与普通文本之间的空白保留；
+//   - 相邻且字符集相同的 encoded-word 先拼接字节再转换，支持多字节字符被拆分到两个 encoded-word；
+//   - 兼容常见的不规范写法：encoded-word 紧贴文本、出现在引号内、base64 缺少填充、
+//     Q 编码中含空格、字符集未知或错误（按内容检测）。
+//
+// 无法解码的 encoded-word 原样保留。
+func DecodeHeader(raw string) Decoded {
+	res := Decoded{Raw: raw}
+	value := unfold(raw)
+
+	matches := expEncodedWord.FindAllStringSubmatchIndex(value, -1)
+	if len(matches) == 0 {
+		res.Value = value
+		return res
+	}
+
+	var (
+		b        strings.Builder
+		pending  []byte // 待转换的相邻 encoded-word 字节
+		pendCs   string
+		last     int
+		prevWord bool
+	)
+	flush := func() {
+		if len(pending) > 0 {
+			b.WriteString(decodeBytes(pending, pendCs))
+			pending = pending[:0]
+		}
+	}
+
+	for _, m := range matches {
+		between := value[last:m[0]]
+		cs, lang := splitLanguage(value[m[2]:m[3]])
+		data, ok := decodeWord(value[m[4]:m[5]], value[m[6]:m[7]])
+		if !ok {
+			flush()
+			b.WriteString(value[last:m[1]])
+			last, prevWord = m[1], false
+			continue
+		}
+
+		if !prevWord || strings.TrimSpace(between) != "" {
+			flush()
+			b.WriteString(between)
+		}
+		if !strings.EqualFold(cs, pendCs) {
+			flush()
+		}
+		if len(res.Charset) == 0 {
+			res.Charset, res.Language = charset.Normalize(cs), lang
+		}
+		pending = append(pending, data...)
+		pendCs = cs
+		last, prevWord = m[1], true
+	}
+	flush()
+	b.WriteString(value[last:])
+
+	res.Value = b.String()
+	return res
+}
+
+// DecodeText 返回 DecodeHeader 解码后的值。
+func DecodeText(raw string) string {
+	return DecodeHeader(raw).Value
+}
+
+// unfold 去除头部折行 (RFC 5322 2.2.3)
+func unfold(s string) string {
+	if !strings.ContainsAny(s, "\r\n") {
+		return s
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\n ", " ")
+	s = strings.ReplaceAll(s, "\n\t", "\t")
+	return strings.ReplaceAll(s, "\n", "")
+}
+
+// splitLanguage 拆分 RFC 2231 第 5 节的 charset*language
+func splitLanguage(cs string) (string, string) {
+	if idx := strings.IndexByte(cs, '*'); idx >= 0 {
+		return cs[:idx], cs[idx+1:]
+	}
+	return cs, ""
+}
+
+// decodeWord 解码 encoded-word 的 B 或 Q 编码文本
+func decodeWord(encoding, text string) ([]byte, bool) {
+	switch encoding {
+	case "b", "B":
+		return decodeBase64(text)
+	default:
+		return decodeQ(text), true
+	}
+}
+
+// decodeBase64 宽松解码 base64：忽略空白和填充，遇到非法字符时保留之前的内容
+func decodeBase64(text string) ([]byte, bool) {
+	text = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, text)
+	text = strings.TrimRight(text, "=")
+
+	data, err := base64.RawStdEncoding.DecodeString(text)
+	if err == nil {
+		return data, true
+	}
+	if pos, ok := err.(base64.CorruptInputError); ok && pos >= 4 {
+		data, err = base64.RawStdEncoding.DecodeString(text[:pos-pos%4])
+		return data, err == nil
+	}
+	return nil, false
+}
+
+// decodeQ 解码 Q 编码，不合法的 = 原样保留
+func decodeQ(text string) []byte {
+	data := make([]byte, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '_':
+			data = append(data, ' ')
+		case c == '=' && i+2 < len(text) && isHex(text[i+1]) && isHex(text[i+2]):
+			v, _ := strconv.ParseUint(text[i+1:i+3], 16, 8)
+			data = append(data, byte(v))
+			i += 2
+		default:
+			data = append(data, c)
+		}
+	}
+	return data
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// decodeBytes 按字符集转换为 UTF-8，字符集缺失或不支持时检测
+func decodeBytes(data []byte, cs string) string {
+	if len(cs) > 0 {
+		if text, err := charset.Convert(data, cs); err == nil {
+			return text
+		}
+	}
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	if name := charset.Best(data); len(name) > 0 {
+		if text, err := charset.Convert(data, name); err == nil {
+			return text
+		}
+	}
+	return string(data)
+}
+
+// wordDecoder 用于 net/mail 解析地址时解码显示名
+var wordDecoder = &mime.WordDecoder{
+	CharsetReader: func(cs string, input io.Reader) (io.Reader, error) {
+		enc, err := charset.Lookup(cs)
+		if err != nil {
+			return nil, err
+		}
+		return transform.NewReader(input, enc.NewDecoder()), nil
+	},
+}
+
+// ParseParams 宽松解析 Content-Type、Content-Disposition 等带参数的头部值，
+// 返回小写的媒体类型和以小写参数名为键的参数。支持：
+//   - RFC 2231 续行 (name*0、name*1)、百分号编码 (name*=utf-8'zh'%E4%BD%A0) 和语言标记；
+//   - 参数值中的 RFC 2047 encoded-word，如 filename="=?gb2312?B?...?="；
+//   - 缺少引号、引号未闭合、含空格的参数值。
+func ParseParams(value string) (string, map[string]Decoded) {
+	value = unfold(value)
+	if strings.HasPrefix(strings.TrimSpace(value), "=?") {
+		// 整个头部值被编码为 encoded-word 的不规范写法
+		value = DecodeHeader(value).Value
+	}
+	mediatype, rest, _ := strings.Cut(value, ";")
+	mediatype = strings.ToLower(strings.TrimSpace(mediatype))
+
+	type section struct {
+		raw      string
+		extended bool
+	}
+	var (
+		params   = make(map[string]Decoded)
+		sections = make(map[string]map[int]section)
+	)
+
+	for len(rest) > 0 {
+		var key, val string
+		key, val, rest = nextParam(rest)
+		if len(key) == 0 {
+			continue
+		}
+
+		name, extended := key, strings.HasSuffix(key, "*")
+		if extended {
+			name = name[:len(name)-1]
+		}
+		index := -1
+		if idx := strings.IndexByte(name, '*'); idx >= 0 {
+			n, err := strconv.Atoi(name[idx+1:])
+			if err != nil || n < 0 {
+				continue
+			}
+			name, index = name[:idx], n
+		}
+
+		if index < 0 && !extended {
+			if _, has := params[name]; !has {
+				params[name] = DecodeHeader(val)
+			}
+			continue
+		}
+		if index < 0 {
+			index = 0
+		}
+		if sections[name] == nil {
+			sections[name] = make(map[int]section)
+		}
+		sections[name][index] = section{raw: val, extended: extended}
+	}
+
+	// RFC 2231 参数优先于同名的普通参数
+	for name, parts := range sections {
+		indexes := make([]int, 0, len(parts))
+		for index := range parts {
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes)
+
+		var (
+			raw  strings.Builder
+			data []byte
+			res  Decoded
+		)
+		for i, index := range indexes {
+			part := parts[index]
+			raw.WriteString(part.raw)
+			if !part.extended {
+				data = append(data, part.raw...)
+				continue
+			}
+			text := part.raw
+			if i == 0 {
+				if fields := strings.SplitN(text, "'", 3); len(fields) == 3 {
+					res.Charset, res.Language, text = charset.Normalize(fields[0]), fields[1], fields[2]
+				}
+			}
+			data = append(data, percentDecode(text)...)
+		}
+		res.Raw = raw.String()
+		res.Value = decodeBytes(data, res.Charset)
+		params[name] = res
+	}
+
+	return mediatype, params
+}
+
+// ParseMediaType 同 mime.ParseMediaType，但按 ParseParams 宽松解析并解码参数值，
+// 仅在缺少媒体类型时返回错误。
+func ParseMediaType(value string) (string, map[string]string, error) {
+	mediatype, params := ParseParams(value)
+	values := make(map[string]string, len(params))
+	for name, param := range params {
+		values[name] = param.Value
+	}
+	if len(mediatype) == 0 {
+		return "", values, mime.ErrInvalidMediaParameter
+	}
+	return mediatype, values, nil
+}
+
+// nextParam 读取下一个 key=value 参数，返回小写的参数名、去除引号后的值和剩余部分
+func nextParam(s string) (string, string, string) {
+	s = strings.TrimLeft(s, "; \t")
+	eq := strings.IndexAny(s, "=;")
+	if eq < 0 || s[eq] == ';' {
+		if eq < 0 {
+			return "", "", ""
+		}
+		return "", "", s[eq+1:]
+	}
+
+	key := strings.ToLower(strings.TrimSpace(s[:eq]))
+	s = strings.TrimLeft(s[eq+1:], " \t")
+
+	if !strings.HasPrefix(s, `"`) {
+		val, rest, _ := strings.Cut(s, ";")
+		return key, strings.TrimSpace(val), rest
+	}
+
+	var val strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				val.WriteByte(s[i])
+			}
+		case '"':
+			_, rest, _ := strings.Cut(s[i+1:], ";")
+			return key, val.String(), rest
+		default:
+			val.WriteByte(s[i])
+		}
+	}
+	// 引号未闭合，取到结尾
+	return key, val.String(), ""
+}
+
+// percentDecode 解码 RFC 2231 的百分号编码，不合法的 % 原样保留
+func percentDecode(s string) []byte {
+	data := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			v, _ := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			data = append(data, byte(v))
+			i += 2
+			continue
+		}
+		data = append(data, s[i])
+	}
+	return data
+}
@@ -0,0 +1,199 @@
+package rules
+
+import (
+	"fmt"
+	"net/mail"
+)
+
+// Action types, MS-OXORULE 2.2.5.1.
+const (
+	OP_MOVE         = 0x01
+	OP_COPY         = 0x02
+	OP_REPLY        = 0x03
+	OP_OOF_REPLY    = 0x04
+	OP_DEFER_ACTION = 0x05
+	OP_BOUNCE       = 0x06
+	OP_FORWARD      = 0x07
+	OP_DELEGATE     = 0x08
+	OP_TAG          = 0x09
+	OP_DELETE       = 0x0A
+	OP_MARK_AS_READ = 0x0B
+)
+
+// Forward action flavors.
+const (
+	FWD_PRESERVE     = 0x00000001
+	FWD_DO_NOT_MUNGE = 0x00000002
+	FWD_AS_ATTACH    = 0x00000004
+)
+
+// Action kinds reported in Action.Type.
+const (
+	ActionMove             = "move"
+	ActionCopy             = "copy"
+	ActionReply            = "reply"
+	ActionOOFReply         = "oof-reply"
+	ActionDefer            = "defer"
+	ActionBounce           = "bounce"
+	ActionForward          = "forward"
+	ActionRedirect         = "redirect"
+	ActionForwardAttach    = "forward-as-attachment"
+	ActionDelegate         = "delegate"
+	ActionTag              = "tag"
+	ActionDelete           = "delete"
+	ActionMarkAsRead       = "mark-as-read"
+	ActionRunScript        = "run-script"
+	ActionStartApplication = "start-application"
+	ActionUnknown          = "unknown"
+)
+
+// Action is a decoded rule action.
+type Action struct {
+	Type   string `json:"type"`
+	Flavor uint32 `json:"flavor,omitempty"`
+	Flags  uint32 `json:"flags,omitempty"`
+
+	// Recipients are the targets of forward, redirect and delegate actions.
+	Recipients []*mail.Address `json:"recipients,omitempty"`
+
+	// Candidate is set on forward actions inferred from the addresses an
+	// unclassified client side rule element carries: the element may also be
+	// a condition on the sender or the recipients.
+	Candidate bool `json:"candidate,omitempty"`
+
+	// Folder is the target folder of move and copy actions. Server side rules
+	// only store the folder entry id, which is given in hex.
+	Folder string `json:"folder,omitempty"`
+
+	// Script is the VBA procedure of a "run a script" action, or the program
+	// of a "start application" action.
+	Script string `json:"script,omitempty"`
+
+	// Value holds other action arguments: the bounce code, or the tagged property.
+	Value interface{} `json:"value,omitempty"`
+
+	// Data is the undecoded action data.
+	Data []byte `json:"-"`
+}
+
+// Suspicious reports whether the action sends mail out of the mailbox, destroys
+// it, or runs code, which are the actions used by malicious inbox rules.
+func (a *Action) Suspicious() bool {
+	switch a.Type {
+	case ActionForward, ActionRedirect, ActionForwardAttach, ActionDelegate,
+		ActionDelete, ActionRunScript, ActionStartApplication:
+		return true
+	}
+	return false
+}
+
+// ParseActions parses a RuleAction structure. countSize is 2 for standard rules
+// (PidTagRuleActions) and 4 for extended rules.
+func ParseActions(data []byte, countSize int) ([]*Action, error) {
+	b := &buffer{data: data}
+	n := b.count(countSize)
+	actions := make([]*Action, 0)
+	for i := 0; i < n && b.err == nil; i++ {
+		size := b.count(countSize)
+		block := b.next(size)
+		if b.err != nil {
+			break
+		}
+		action, err := parseActionBlock(block, countSize)
+		if action != nil {
+			actions = append(actions, action)
+		}
+		if err != nil {
+			return actions, err
+		}
+	}
+	return actions, b.err
+}
+
+// parseActionBlock parses the body of an ActionBlock, after its ActionLength.
+func parseActionBlock(block []byte, countSize int) (*Action, error) {
+	b := &buffer{data: block}
+	actionType := b.uint8()
+	action := &Action{Flavor: b.uint32(), Flags: b.uint32()}
+	action.Data = block[b.pos:]
+
+	switch actionType {
+	case OP_MOVE, OP_COPY:
+		action.Type = ActionMove
+		if actionType == OP_COPY {
+			action.Type = ActionCopy
+		}
+		if countSize == 2 {
+			b.uint8() // FolderInThisStore
+		}
+		b.next(b.count(countSize)) // StoreEID
+		action.Folder = fmt.Sprintf("%X", b.next(b.count(countSize)))
+	case OP_REPLY, OP_OOF_REPLY:
+		action.Type = ActionReply
+		if actionType == OP_OOF_REPLY {
+			action.Type = ActionOOFReply
+		}
+	case OP_DEFER_ACTION:
+		action.Type = ActionDefer
+	case OP_BOUNCE:
+		action.Type = ActionBounce
+		action.Value = b.uint32()
+	case OP_FORWARD, OP_DELEGATE:
+		action.Type = forwardType(actionType, action.Flavor)
+		action.Recipients = readRecipients(b, countSize)
+	case OP_TAG:
+		action.Type = ActionTag
+		tag, value := readTaggedValue(b, countSize)
+		action.Value = map[string]interface{}{propertyName(tag): value}
+	case OP_DELETE:
+		action.Type = ActionDelete
+	case OP_MARK_AS_READ:
+		action.Type = ActionMarkAsRead
+	default:
+		action.Type = ActionUnknown
+		return action, fmt.Errorf("unknown action type 0x%02X", actionType)
+	}
+	return action, b.err
+}
+
+// forwardType distinguishes forward, redirect and forward as attachment by flavor.
+func forwardType(actionType uint8, flavor uint32) string {
+	switch {
+	case actionType == OP_DELEGATE:
+		return ActionDelegate
+	case flavor&FWD_AS_ATTACH != 0:
+		return ActionForwardAttach
+	case flavor&(FWD_PRESERVE|FWD_DO_NOT_MUNGE) == FWD_PRESERVE|FWD_DO_NOT_MUNGE:
+		return ActionRedirect
+	default:
+		return ActionForward
+	}
+}
+
+// readRecipients reads the RecipientBlocks of a forward or delegate action.
+func readRecipients(b *buffer, countSize int) []*mail.Address {
+	n := b.count(countSize)
+	recipients := make([]*mail.Address, 0)
+	for i := 0; i < n && b.err == nil; i++ {
+		b.uint8() // Reserved
+		props := b.count(countSize)
+		var name, email, smtp string
+		for j := 0; j < props && b.err == nil; j++ {
+			tag, value := readTaggedValue(b, countSize)
+			s, _ := value.(string)
+			switch tag >> 16 {
+			case 0x3001: // PidTagDisplayName
+				name = s
+			case 0x3003: // PidTagEmailAddress
+				email = s
+			case 0x39FE: // PidTagSmtpAddress
+				smtp = s
+			}
+		}
+		if len(smtp) == 0 {
+			smtp = email
+		}
+		recipients = append(recipients, &mail.Address{Name: name, Address: smtp})
+	}
+	return recipients
+}
@@ -0,0 +1,102 @@
+package rules
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrShortBuffer is returned when a rule structure is truncated.
+var ErrShortBuffer = errors.New("rule data truncated")
+
+// buffer is a little endian reader over a rule blob that remembers the first error.
+type buffer struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// remaining ...
+func (b *buffer) remaining() int {
+	return len(b.data) - b.pos
+}
+
+// next returns the next n bytes, or nil once the buffer is exhausted.
+func (b *buffer) next(n int) []byte {
+	if b.err != nil {
+		return nil
+	}
+	if n < 0 || n > b.remaining() {
+		b.err = ErrShortBuffer
+		b.pos = len(b.data)
+		return nil
+	}
+	p := b.data[b.pos : b.pos+n]
+	b.pos += n
+	return p
+}
+
+// uint8 ...
+func (b *buffer) uint8() uint8 {
+	if p := b.next(1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+// uint16 ...
+func (b *buffer) uint16() uint16 {
+	if p := b.next(2); p != nil {
+		return binary.LittleEndian.Uint16(p)
+	}
+	return 0
+}
+
+// uint32 ...
+func (b *buffer) uint32() uint32 {
+	if p := b.next(4); p != nil {
+		return binary.LittleEndian.Uint32(p)
+	}
+	return 0
+}
+
+// uint64 ...
+func (b *buffer) uint64() uint64 {
+	if p := b.next(8); p != nil {
+		return binary.LittleEndian.Uint64(p)
+	}
+	return 0
+}
+
+// count reads a COUNT field, which is 2 bytes wide for standard rules
+// and 4 bytes wide for extended rules.
+func (b *buffer) count(size int) int {
+	if size == 4 {
+		return int(b.uint32())
+	}
+	return int(b.uint16())
+}
+
+// until returns the bytes up to the terminator, skipping the terminator.
+// The terminator is matched on width byte boundaries.
+func (b *buffer) until(width int) []byte {
+	if b.err != nil {
+		return nil
+	}
+	for i := b.pos; i+width <= len(b.data); i += width {
+		zero := true
+		for _, c := range b.data[i : i+width] {
+			if c != 0 {
+				zero = false
+				break
+			}
+		}
+		if zero {
+			p := b.data[b.pos:i]
+			b.pos = i + width
+			return p
+		}
+	}
+	b.err = ErrShortBuffer
+	b.pos = len(b.data)
+	return nil
+}
@@ -0,0 +1,268 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/mel2oo/mailfile/msg"
+)
+
+// Restriction types, MS-OXCDATA 2.12.
+const (
+	RES_AND            = 0x00
+	RES_OR             = 0x01
+	RES_NOT            = 0x02
+	RES_CONTENT        = 0x03
+	RES_PROPERTY       = 0x04
+	RES_COMPAREPROPS   = 0x05
+	RES_BITMASK        = 0x06
+	RES_SIZE           = 0x07
+	RES_EXIST          = 0x08
+	RES_SUBRESTRICTION = 0x09
+	RES_COMMENT        = 0x0A
+	RES_COUNT          = 0x0B
+)
+
+// maxDepth bounds the nesting of restrictions in hostile input.
+const maxDepth = 64
+
+// restrictionTypes ...
+var restrictionTypes = map[uint8]string{
+	RES_AND:            "and",
+	RES_OR:             "or",
+	RES_NOT:            "not",
+	RES_CONTENT:        "content",
+	RES_PROPERTY:       "property",
+	RES_COMPAREPROPS:   "compare-properties",
+	RES_BITMASK:        "bitmask",
+	RES_SIZE:           "size",
+	RES_EXIST:          "exist",
+	RES_SUBRESTRICTION: "sub-object",
+	RES_COMMENT:        "comment",
+	RES_COUNT:          "count",
+}
+
+// relOps are the relational operators of property, compare and size restrictions.
+var relOps = map[uint8]string{
+	0x00: "<",
+	0x01: "<=",
+	0x02: ">",
+	0x03: ">=",
+	0x04: "==",
+	0x05: "!=",
+	0x06: "matches",
+	0x64: "member-of",
+}
+
+// Condition is a decoded rule restriction.
+type Condition struct {
+	// Type is the restriction type, e.g. "and", "content", "property".
+	Type string `json:"type"`
+	// Property is the name of the tested property, or its tag if unknown.
+	Property string `json:"property,omitempty"`
+	// Operator is the relational operator or content match mode.
+	Operator string `json:"operator,omitempty"`
+	// Value is the value compared against.
+	Value interface{} `json:"value,omitempty"`
+	// Children are the nested restrictions of and/or/not/sub-object/count restrictions.
+	Children []*Condition `json:"children,omitempty"`
+}
+
+// String renders the condition as a readable expression.
+func (c *Condition) String() string {
+	switch c.Type {
+	case "and", "or":
+		parts := make([]string, 0, len(c.Children))
+		for _, child := range c.Children {
+			parts = append(parts, child.String())
+		}
+		return "(" + strings.Join(parts, " "+c.Type+" ") + ")"
+	case "not":
+		if len(c.Children) > 0 {
+			return "not " + c.Children[0].String()
+		}
+	case "exist":
+		return "exists " + c.Property
+	}
+	s := strings.TrimSpace(fmt.Sprintf("%s %s %v", c.Property, c.Operator, c.Value))
+	if len(c.Children) > 0 {
+		s += " " + c.Children[0].String()
+	}
+	return s
+}
+
+// ParseRestriction parses a restriction. countSize is 2 for standard rules
+// (PidTagRuleCondition) and 4 for extended rules.
+func ParseRestriction(data []byte, countSize int) (*Condition, error) {
+	b := &buffer{data: data}
+	c := readRestriction(b, countSize, 0)
+	return c, b.err
+}
+
+// readRestriction ...
+func readRestriction(b *buffer, countSize, depth int) *Condition {
+	if depth > maxDepth {
+		b.err = fmt.Errorf("restriction nested deeper than %d", maxDepth)
+		return nil
+	}
+
+	rt := b.uint8()
+	c := &Condition{Type: restrictionTypes[rt]}
+	if len(c.Type) == 0 {
+		c.Type = fmt.Sprintf("unknown(0x%02X)", rt)
+		b.err = fmt.Errorf("unknown restriction type 0x%02X", rt)
+		return c
+	}
+
+	switch rt {
+	case RES_AND, RES_OR:
+		n := b.count(countSize)
+		for i := 0; i < n && b.err == nil; i++ {
+			c.Children = append(c.Children, readRestriction(b, countSize, depth+1))
+		}
+	case RES_NOT:
+		c.Children = append(c.Children, readRestriction(b, countSize, depth+1))
+	case RES_CONTENT:
+		low := b.uint16()
+		high := b.uint16()
+		c.Property = propertyName(b.uint32())
+		c.Operator = fuzzyLevel(low, high)
+		_, c.Value = readTaggedValue(b, countSize)
+	case RES_PROPERTY:
+		c.Operator = relOp(b.uint8())
+		c.Property = propertyName(b.uint32())
+		_, c.Value = readTaggedValue(b, countSize)
+	case RES_COMPAREPROPS:
+		c.Operator = relOp(b.uint8())
+		c.Property = propertyName(b.uint32())
+		c.Value = propertyName(b.uint32())
+	case RES_BITMASK:
+		if b.uint8() == 0 {
+			c.Operator = "&== 0"
+		} else {
+			c.Operator = "&!= 0"
+		}
+		c.Property = propertyName(b.uint32())
+		c.Value = b.uint32()
+	case RES_SIZE:
+		c.Operator = relOp(b.uint8())
+		c.Property = propertyName(b.uint32())
+		c.Value = b.uint32()
+	case RES_EXIST:
+		c.Property = propertyName(b.uint32())
+	case RES_SUBRESTRICTION:
+		c.Property = propertyName(b.uint32())
+		c.Children = append(c.Children, readRestriction(b, countSize, depth+1))
+	case RES_COMMENT:
+		n := int(b.uint8())
+		values := make(map[string]interface{})
+		for i := 0; i < n && b.err == nil; i++ {
+			tag, value := readTaggedValue(b, countSize)
+			values[propertyName(tag)] = value
+		}
+		c.Value = values
+		if b.uint8() != 0 {
+			c.Children = append(c.Children, readRestriction(b, countSize, depth+1))
+		}
+	case RES_COUNT:
+		c.Value = b.uint32()
+		c.Children = append(c.Children, readRestriction(b, countSize, depth+1))
+	}
+	return c
+}
+
+// relOp ...
+func relOp(op uint8) string {
+	if s, ok := relOps[op]; ok {
+		return s
+	}
+	return fmt.Sprintf("relop(0x%02X)", op)
+}
+
+// fuzzyLevel describes the match mode of a content restriction.
+func fuzzyLevel(low, high uint16) string {
+	var mode string
+	switch low {
+	case 0x0000:
+		mode = "equals"
+	case 0x0001:
+		mode = "contains"
+	case 0x0002:
+		mode = "starts-with"
+	default:
+		mode = fmt.Sprintf("fuzzy(0x%04X)", low)
+	}
+	if high&0x0001 != 0 {
+		mode += " (ignore case)"
+	}
+	return mode
+}
+
+// propertyName returns the name of a property tag from the MSG property table.
+func propertyName(tag uint32) string {
+	id := fmt.Sprintf("0x%04X", tag>>16)
+	if name, ok := msg.PROPS_TAG_MAP[fmt.Sprintf("0x%08X", tag)]; ok {
+		return name
+	}
+	if props, ok := msg.PROPS_ID_MAP[id]; ok {
+		return props["name"]
+	}
+	return fmt.Sprintf("0x%08X", tag)
+}
+
+// readTaggedValue reads a TaggedPropertyValue: a property tag followed by its value.
+func readTaggedValue(b *buffer, countSize int) (uint32, interface{}) {
+	tag := b.uint32()
+	return tag, readValue(b, uint16(tag), countSize)
+}
+
+// readValue reads a property value of the given type, MS-OXCDATA 2.11.
+func readValue(b *buffer, ptype uint16, countSize int) interface{} {
+	switch ptype {
+	case 0x0002:
+		return b.uint16()
+	case 0x0003, 0x000A:
+		return b.uint32()
+	case 0x0004:
+		return math.Float32frombits(b.uint32())
+	case 0x0005, 0x0007:
+		return math.Float64frombits(b.uint64())
+	case 0x0006, 0x0014:
+		return b.uint64()
+	case 0x000B:
+		return b.uint8() != 0
+	case 0x001E:
+		return string(b.until(1))
+	case 0x001F:
+		return msg.UTF16ToUTF8(b.until(2))
+	case 0x0040:
+		return filetime(b.uint64())
+	case 0x0048:
+		return fmt.Sprintf("%X", b.next(16))
+	case 0x00FB, 0x0102:
+		return b.next(b.count(countSize))
+	case 0x1002, 0x1003, 0x1005, 0x1014, 0x101E, 0x101F, 0x1040, 0x1048, 0x1102:
+		n := b.count(countSize)
+		values := make([]interface{}, 0)
+		for i := 0; i < n && b.err == nil; i++ {
+			values = append(values, readValue(b, ptype&^0x1000, countSize))
+		}
+		return values
+	case 0x0001:
+		return nil
+	}
+	b.err = fmt.Errorf("unsupported property type 0x%04X", ptype)
+	return nil
+}
+
+// filetime converts a count of 100ns intervals since 1601 to a time.
+func filetime(ft uint64) time.Time {
+	const epochDelta = 116444736000000000 // 1601-01-01 to 1970-01-01 in 100ns
+	if ft < epochDelta {
+		return time.Time{}
+	}
+	ft -= epochDelta
+	return time.Unix(int64(ft/10000000), int64(ft%10000000)*100).UTC()
+}
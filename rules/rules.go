@@ -0,0 +1,165 @@
+// Package rules decodes Outlook inbox rules: server side rules stored in
+// PidTagRuleCondition / PidTagRuleActions and in extended rule messages
+// (MS-OXORULE), and client side rules stored in exported .rwz files and in the
+// PidTagRwRulesStream property of the rule organizer message.
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mel2oo/mailfile/msg"
+)
+
+// Rule states, MS-OXORULE 2.2.1.3.1.3.
+const (
+	ST_ENABLED          = 0x00000001
+	ST_ERROR            = 0x00000002
+	ST_ONLY_WHEN_OOF    = 0x00000004
+	ST_KEEP_OOF_HIST    = 0x00000008
+	ST_EXIT_LEVEL       = 0x00000010
+	ST_SKIP_IF_SCL_SAFE = 0x00000020
+	ST_RULE_PARSE_ERROR = 0x00000040
+)
+
+// ErrNoRules is returned when a message holds no rule properties.
+var ErrNoRules = errors.New("message holds no rules")
+
+// Rule is a decoded inbox rule.
+type Rule struct {
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+	State    uint32 `json:"state"`
+	Sequence uint32 `json:"sequence,omitempty"`
+	Provider string `json:"provider,omitempty"`
+
+	// ClientOnly is true for rules read from a .rwz file or a rules stream,
+	// which Outlook runs on the client instead of the server.
+	ClientOnly bool `json:"client-only"`
+
+	// Condition is the restriction a message must match, for server side rules.
+	Condition *Condition `json:"condition,omitempty"`
+
+	// Elements are the conditions, exceptions and actions of client side rules.
+	Elements []*Element `json:"elements,omitempty"`
+
+	Actions []*Action `json:"actions"`
+}
+
+// Suspicious reports whether any action of the rule is suspicious,
+// see Action.Suspicious.
+func (r *Rule) Suspicious() bool {
+	for _, a := range r.Actions {
+		if a.Suspicious() {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseServerRule decodes a standard server side rule from its
+// PidTagRuleCondition and PidTagRuleActions values.
+func ParseServerRule(name string, state uint32, condition, actions []byte) (*Rule, error) {
+	rule := &Rule{Name: name, State: state, Enabled: state&ST_ENABLED != 0}
+
+	var err error
+	if len(condition) > 0 {
+		if rule.Condition, err = ParseRestriction(condition, 2); err != nil {
+			return rule, fmt.Errorf("rule condition: %w", err)
+		}
+	}
+	if len(actions) > 0 {
+		if rule.Actions, err = ParseActions(actions, 2); err != nil {
+			return rule, fmt.Errorf("rule actions: %w", err)
+		}
+	}
+	return rule, nil
+}
+
+// ParseExtendedRule decodes an extended rule from the
+// PidTagExtendedRuleMessageCondition and PidTagExtendedRuleMessageActions values.
+func ParseExtendedRule(name string, state uint32, condition, actions []byte) (*Rule, error) {
+	rule := &Rule{Name: name, State: state, Enabled: state&ST_ENABLED != 0}
+
+	if len(condition) > 0 {
+		b := &buffer{data: condition}
+		skipNamedProperties(b)
+		rule.Condition = readRestriction(b, 4, 0)
+		if b.err != nil {
+			return rule, fmt.Errorf("extended rule condition: %w", b.err)
+		}
+	}
+
+	if len(actions) > 0 {
+		b := &buffer{data: actions}
+		skipNamedProperties(b)
+		if version := b.uint32(); b.err == nil && version != 1 {
+			return rule, fmt.Errorf("unsupported extended rule version %d", version)
+		}
+		var err error
+		if rule.Actions, err = ParseActions(actions[b.pos:], 4); err != nil {
+			return rule, fmt.Errorf("extended rule actions: %w", err)
+		}
+	}
+	return rule, nil
+}
+
+// skipNamedProperties skips the NamedPropertyInformation that prefixes
+// extended rule conditions and actions, MS-OXORULE 2.2.4.2.
+func skipNamedProperties(b *buffer) {
+	n := int(b.uint16())
+	if n == 0 {
+		return
+	}
+	b.next(n * 2) // PropId
+	b.next(int(b.uint32()))
+}
+
+// New reads the rules of an exported .rwz rules file.
+func New(file string) ([]*Rule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRWZ(data)
+}
+
+// FromMSG reads the rules held by a rule message saved as .msg: the rule
+// organizer message with its PidTagRwRulesStream, an extended rule message,
+// or a message carrying standard rule properties.
+func FromMSG(s *msg.Stream) ([]*Rule, error) {
+	props := s.Props()
+
+	if stream, ok := props["RwRulesStream"].([]byte); ok && len(stream) > 0 {
+		return ParseRWZ(stream)
+	}
+
+	state, _ := props["RuleMessageState"].(uint32)
+	sequence, _ := props["RuleMessageSequence"].(uint32)
+	name, _ := props["RuleMessageName"].(string)
+	provider, _ := props["RuleMessageProvider"].(string)
+	condition, _ := props["ExtendedRuleMessageCondition"].([]byte)
+	actions, _ := props["ExtendedRuleMessageActions"].([]byte)
+	if len(condition) > 0 || len(actions) > 0 {
+		rule, err := ParseExtendedRule(name, state, condition, actions)
+		rule.Sequence = sequence
+		rule.Provider = provider
+		return []*Rule{rule}, err
+	}
+
+	state, _ = props["RuleState"].(uint32)
+	sequence, _ = props["RuleSequence"].(uint32)
+	name, _ = props["RuleName"].(string)
+	provider, _ = props["RuleProvider"].(string)
+	condition, _ = props["RuleCondition"].([]byte)
+	actions, _ = props["RuleActions"].([]byte)
+	if len(condition) > 0 || len(actions) > 0 {
+		rule, err := ParseServerRule(name, state, condition, actions)
+		rule.Sequence = sequence
+		rule.Provider = provider
+		return []*Rule{rule}, err
+	}
+
+	return nil, ErrNoRules
+}
@@ -0,0 +1,276 @@
+package rules
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/mel2oo/mailfile/msg"
+)
+
+// ErrNoRuleObjects is returned when no serialized rule objects are found.
+var ErrNoRuleObjects = errors.New("no rule objects found")
+
+// Client side rules are not documented by Microsoft. Both the .rwz file and the
+// PidTagRwRulesStream property hold MFC archive serialized objects, optionally
+// preceded by a header:
+//
+//	class tag:  0xFFFF, schema (2 bytes), name length (2 bytes), ASCII class name
+//	            on the first use of a class, 0x8000|class index afterwards
+//	string:     0xFF, 0xFFFE, length (1 byte, or 0xFF + 2 bytes), UTF-16LE text
+//
+// The first class in the stream is the rule class. A rule object starts with a
+// flags field (bit 0 set when the rule is enabled) followed by the rule name, and
+// is followed by one object per condition, exception and action, each starting
+// with its 4 byte element identifier. The parser only relies on this framing;
+// element identifiers are reported as is, and classified through ElementKinds.
+// Elements not classified that carry addresses are reported as forward
+// candidates, see Action.Candidate.
+
+// ElementKinds maps client side rule element identifiers to an Action type or
+// to a condition name. It is empty by default, identifiers confirmed for the
+// Outlook versions in use can be registered by the caller.
+var ElementKinds = map[uint32]string{}
+
+// Element is a condition, exception or action object of a client side rule.
+type Element struct {
+	Class string `json:"class"`
+	ID    uint32 `json:"id"`
+	Kind  string `json:"kind,omitempty"`
+
+	// Strings are the string arguments of the element: addresses, words,
+	// folder names, script names.
+	Strings []string `json:"strings,omitempty"`
+
+	// Data is the raw serialized element, after its class tag.
+	Data []byte `json:"-"`
+}
+
+const (
+	newClassTag   = 0xFFFF
+	classTagFlag  = 0x8000
+	maxClassName  = 64
+	unicodeMarker = 0xFFFE
+)
+
+// object is a serialized object found in the stream.
+type object struct {
+	class   string
+	start   int // first byte after the class tag
+	end     int
+	strings []string
+}
+
+// ParseRWZ parses client side rules from an .rwz file or a PidTagRwRulesStream value.
+func ParseRWZ(data []byte) ([]*Rule, error) {
+	objects := scanObjects(data)
+	if len(objects) == 0 {
+		return nil, ErrNoRuleObjects
+	}
+
+	ruleClass := objects[0].class
+	rules := make([]*Rule, 0)
+	var rule *Rule
+	for _, obj := range objects {
+		body := data[obj.start:obj.end]
+		if obj.class == ruleClass {
+			rule = &Rule{ClientOnly: true, Actions: make([]*Action, 0)}
+			if len(body) >= 4 {
+				rule.State = binary.LittleEndian.Uint32(body)
+				rule.Enabled = rule.State&ST_ENABLED != 0
+			}
+			if len(obj.strings) > 0 {
+				rule.Name = obj.strings[0]
+			}
+			rules = append(rules, rule)
+			continue
+		}
+		if rule == nil {
+			continue
+		}
+
+		element := &Element{Class: obj.class, Strings: obj.strings, Data: body}
+		if len(body) >= 4 {
+			element.ID = binary.LittleEndian.Uint32(body)
+		}
+		element.Kind = ElementKinds[element.ID]
+		rule.Elements = append(rule.Elements, element)
+
+		if action := elementAction(element); action != nil {
+			rule.Actions = append(rule.Actions, action)
+		}
+	}
+	return rules, nil
+}
+
+// scanObjects walks the stream, collecting objects and the strings inside them.
+func scanObjects(data []byte) []*object {
+	var (
+		objects []*object
+		classes = make(map[uint16]string)
+		count   = uint16(1) // MFC archive map indices start at 1
+	)
+
+	for pos := 0; pos+2 <= len(data); {
+		if name, next, ok := readNewClass(data, pos); ok {
+			classes[count] = name
+			count += 2 // the class and its first object
+			objects = appendObject(objects, name, next, pos)
+			pos = next
+			continue
+		}
+
+		tag := binary.LittleEndian.Uint16(data[pos:])
+		if tag&classTagFlag != 0 && len(objects) > 0 && pos-objects[len(objects)-1].start >= 4 {
+			if name, ok := classes[tag&^classTagFlag]; ok {
+				count++
+				objects = appendObject(objects, name, pos+2, pos)
+				pos += 2
+				continue
+			}
+		}
+
+		if s, next, ok := readCString(data, pos); ok {
+			if len(objects) > 0 {
+				obj := objects[len(objects)-1]
+				obj.strings = append(obj.strings, s)
+			}
+			pos = next
+			continue
+		}
+		pos++
+	}
+
+	if len(objects) > 0 {
+		objects[len(objects)-1].end = len(data)
+	}
+	return objects
+}
+
+// appendObject closes the previous object at tagPos and starts a new one.
+func appendObject(objects []*object, class string, start, tagPos int) []*object {
+	if len(objects) > 0 {
+		objects[len(objects)-1].end = tagPos
+	}
+	return append(objects, &object{class: class, start: start, end: start})
+}
+
+// readNewClass reads a new class tag at pos.
+func readNewClass(data []byte, pos int) (string, int, bool) {
+	if pos+6 > len(data) || binary.LittleEndian.Uint16(data[pos:]) != newClassTag {
+		return "", 0, false
+	}
+	n := int(binary.LittleEndian.Uint16(data[pos+4:]))
+	if n == 0 || n > maxClassName || pos+6+n > len(data) {
+		return "", 0, false
+	}
+	name := data[pos+6 : pos+6+n]
+	if name[0] != 'C' {
+		return "", 0, false
+	}
+	for _, c := range name {
+		if !(c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return "", 0, false
+		}
+	}
+	return string(name), pos + 6 + n, true
+}
+
+// readCString reads a Unicode MFC CString at pos.
+func readCString(data []byte, pos int) (string, int, bool) {
+	if pos+4 > len(data) || data[pos] != 0xFF || binary.LittleEndian.Uint16(data[pos+1:]) != unicodeMarker {
+		return "", 0, false
+	}
+	pos += 3
+
+	n := int(data[pos])
+	switch {
+	case n == 0:
+		return "", pos + 1, true
+	case n < 0xFF:
+		if pos+1+n*2 > len(data) {
+			return "", 0, false
+		}
+		str, next := msg.ReadUTF16BE(pos, data)
+		return msg.UTF16ToUTF8(str), next, true
+	}
+
+	if pos+3 > len(data) {
+		return "", 0, false
+	}
+	n = int(binary.LittleEndian.Uint16(data[pos+1:]))
+	pos += 3
+	if pos+n*2 > len(data) {
+		return "", 0, false
+	}
+	return msg.UTF16ToUTF8(data[pos : pos+n*2]), pos + n*2, true
+}
+
+var (
+	// expScript matches the VBA procedure of a "run a script" action,
+	// e.g. "Project1.ThisOutlookSession.Forward".
+	expScript = regexp.MustCompile(`(?i)^(Project\d*\.\w+|\w+\.ThisOutlookSession)\.\w+$`)
+	// expProgram matches the program path of a "start application" action.
+	expProgram = regexp.MustCompile(`(?i)^([a-z]:)?[\\/].*\.(exe|bat|cmd|com|scr|ps1|vbs|js|hta|lnk)$`)
+)
+
+// elementAction builds an action for elements whose kind is registered in
+// ElementKinds as an action, whose arguments can only belong to the
+// "run a script" and "start application" actions, or, as a forward candidate,
+// that carry addresses.
+func elementAction(e *Element) *Action {
+	switch e.Kind {
+	case ActionMove, ActionCopy, ActionForward, ActionRedirect, ActionForwardAttach,
+		ActionDelete, ActionReply, ActionMarkAsRead:
+		action := &Action{Type: e.Kind, Data: e.Data}
+		for _, s := range e.Strings {
+			if addr := parseRecipient(s); addr != nil {
+				action.Recipients = append(action.Recipients, addr)
+			} else if e.Kind == ActionMove || e.Kind == ActionCopy {
+				action.Folder = s
+			}
+		}
+		return action
+	}
+
+	for _, s := range e.Strings {
+		s = strings.TrimSpace(s)
+		if e.Kind == ActionRunScript || expScript.MatchString(s) {
+			return &Action{Type: ActionRunScript, Script: s, Data: e.Data}
+		}
+		if e.Kind == ActionStartApplication || expProgram.MatchString(s) {
+			return &Action{Type: ActionStartApplication, Script: s, Data: e.Data}
+		}
+	}
+
+	// an element of unknown kind sending to addresses may forward mail out,
+	// it may as well be a "from" or "sent to" condition
+	if len(e.Kind) == 0 {
+		action := &Action{Type: ActionForward, Candidate: true, Data: e.Data}
+		for _, s := range e.Strings {
+			if addr := parseRecipient(s); addr != nil {
+				action.Recipients = append(action.Recipients, addr)
+			}
+		}
+		if len(action.Recipients) > 0 {
+			return action
+		}
+	}
+	return nil
+}
+
+// parseRecipient parses an address argument, "name <address>", "address" or
+// "SMTP:address", returning nil for other strings.
+func parseRecipient(s string) *mail.Address {
+	s = strings.TrimSpace(s)
+	if len(s) > 5 && strings.EqualFold(s[:5], "SMTP:") {
+		s = s[5:]
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return nil
+	}
+	return addr
+}
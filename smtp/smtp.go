@@ -0,0 +1,387 @@
+// Package smtp delivers an eml.Message to an SMTP server, with the envelope
+// taken from its header.
+package smtp
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	gosmtp "net/smtp"
+	"strings"
+	"time"
+
+	"github.com/mel2oo/mailfile/eml"
+)
+
+// Security is how the connection to the server is secured.
+type Security int
+
+const (
+	// Opportunistic upgrades the connection with STARTTLS when the server
+	// offers it, and goes on in plain text otherwise.
+	Opportunistic Security = iota
+	// StartTLS requires the server to offer STARTTLS.
+	StartTLS
+	// ImplicitTLS connects over TLS from the start, usually on port 465.
+	ImplicitTLS
+	// Plaintext never uses TLS.
+	Plaintext
+)
+
+// DefaultTimeout bounds the whole SMTP session when Sender.Timeout is 0.
+const DefaultTimeout = 5 * time.Minute
+
+// Sender sends messages to one SMTP server.
+type Sender struct {
+	// Addr is the "host:port" address of the server.
+	Addr string
+
+	// Security is how the connection is secured, Opportunistic by default.
+	Security Security
+
+	// TLSConfig is used for STARTTLS and implicit TLS. The server name is
+	// the host of Addr if it is not set.
+	TLSConfig *tls.Config
+
+	// Username and Password authenticate with AUTH PLAIN, or LOGIN if the
+	// server does not offer PLAIN. There is no authentication without a
+	// Username. PLAIN is only used over TLS or to localhost.
+	Username string
+	Password string
+
+	// LocalName is the name sent with EHLO, "localhost" by default.
+	LocalName string
+
+	// Timeout bounds the whole session, DefaultTimeout if 0.
+	Timeout time.Duration
+}
+
+// RecipientError is a recipient refused by the server.
+type RecipientError struct {
+	Recipient string
+	Err       error
+}
+
+// Error ...
+func (e *RecipientError) Error() string {
+	return e.Recipient + ": " + e.Err.Error()
+}
+
+// Unwrap ...
+func (e *RecipientError) Unwrap() error {
+	return e.Err
+}
+
+// SendError lists the recipients refused by the server. The message was sent
+// to the other recipients, if any were accepted.
+type SendError struct {
+	Sent       bool
+	Recipients []*RecipientError
+}
+
+// Error ...
+func (e *SendError) Error() string {
+	errs := make([]string, 0, len(e.Recipients))
+	for _, err := range e.Recipients {
+		errs = append(errs, err.Error())
+	}
+	if e.Sent {
+		return "smtp: some recipients refused: " + strings.Join(errs, "; ")
+	}
+	return "smtp: all recipients refused: " + strings.Join(errs, "; ")
+}
+
+var (
+	// ErrNoSender is returned when the header has no sender address.
+	ErrNoSender = errors.New("smtp: message has no sender address")
+	// ErrNoRecipients is returned when the header has no recipient address.
+	ErrNoRecipients = errors.New("smtp: message has no recipient address")
+	// ErrNoSTARTTLS is returned when StartTLS is required and not offered.
+	ErrNoSTARTTLS = errors.New("smtp: server does not offer STARTTLS")
+	// ErrNoAuth is returned when the server offers neither PLAIN nor LOGIN.
+	ErrNoAuth = errors.New("smtp: server offers no supported AUTH mechanism")
+	// ErrNo8BitMIME is returned for 8-bit data when 8BITMIME is not offered.
+	ErrNo8BitMIME = errors.New("smtp: message is not 7-bit and server does not offer 8BITMIME")
+	// ErrNoSMTPUTF8 is returned for UTF-8 addresses when SMTPUTF8 is not offered.
+	ErrNoSMTPUTF8 = errors.New("smtp: addresses are not ASCII and server does not offer SMTPUTF8")
+)
+
+// Envelope returns the envelope of a message: the sender is the first
+// Sender or From address, the recipients the To, Cc and Bcc addresses.
+// A message holding Resent- fields is being resent, and the envelope is
+// taken from the latest Resent- fields instead.
+func Envelope(m *eml.Message) (string, []string, error) {
+	prefix := ""
+	if m.Header.IsSet("Resent-From") || m.Header.IsSet("Resent-To") {
+		prefix = "Resent-"
+	}
+
+	var from string
+	for _, key := range []string{prefix + "Sender", prefix + "From"} {
+		if list, err := m.Header.AddressList(key); err == nil {
+			from = list[0].Address
+			break
+		}
+	}
+	if len(from) == 0 {
+		return "", nil, ErrNoSender
+	}
+
+	var to []string
+	seen := make(map[string]bool)
+	for _, key := range []string{prefix + "To", prefix + "Cc", prefix + "Bcc"} {
+		values := m.Header[key]
+		if len(prefix) > 0 && len(values) > 0 {
+			// resent blocks are prepended, the first one is the latest
+			values = values[:1]
+		}
+		for _, value := range values {
+			list, _ := (eml.Header{key: {value}}).AddressList(key)
+			for _, addr := range list {
+				if lower := strings.ToLower(addr.Address); !seen[lower] {
+					seen[lower] = true
+					to = append(to, addr.Address)
+				}
+			}
+		}
+	}
+	if len(to) == 0 {
+		return "", nil, ErrNoRecipients
+	}
+	return from, to, nil
+}
+
+// Send sends m to the recipients of its envelope, see Envelope.
+func (s *Sender) Send(m *eml.Message) error {
+	from, to, err := Envelope(m)
+	if err != nil {
+		return err
+	}
+	return s.SendEnvelope(from, to, m)
+}
+
+// SendEnvelope sends m from the envelope sender to the envelope recipients.
+// Bcc fields are removed from the data sent. A *SendError is returned when
+// some recipients are refused.
+func (s *Sender) SendEnvelope(from string, to []string, m *eml.Message) error {
+	data, err := withoutBcc(m).Bytes()
+	if err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	tlsConfig := s.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if len(tlsConfig.ServerName) == 0 {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	if s.Security == ImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.Addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", s.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	c, err := gosmtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if err := s.hello(c, tlsConfig); err != nil {
+		return err
+	}
+	if err := s.auth(c, host); err != nil {
+		return err
+	}
+	if err := checkExtensions(c, from, to, data); err != nil {
+		return err
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+
+	sendErr := &SendError{}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			sendErr.Recipients = append(sendErr.Recipients, &RecipientError{Recipient: rcpt, Err: err})
+		}
+	}
+	if len(sendErr.Recipients) == len(to) {
+		c.Reset()
+		c.Quit()
+		return sendErr
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	sendErr.Sent = true
+	if err := c.Quit(); err != nil {
+		return err
+	}
+	if len(sendErr.Recipients) > 0 {
+		return sendErr
+	}
+	return nil
+}
+
+// hello sends EHLO, and upgrades the connection with STARTTLS.
+func (s *Sender) hello(c *gosmtp.Client, tlsConfig *tls.Config) error {
+	localName := s.LocalName
+	if len(localName) == 0 {
+		localName = "localhost"
+	}
+	if err := c.Hello(localName); err != nil {
+		return err
+	}
+	if s.Security == ImplicitTLS || s.Security == Plaintext {
+		return nil
+	}
+	if ok, _ := c.Extension("STARTTLS"); !ok {
+		if s.Security == StartTLS {
+			return ErrNoSTARTTLS
+		}
+		return nil
+	}
+	return c.StartTLS(tlsConfig)
+}
+
+// auth authenticates with PLAIN, or LOGIN if PLAIN is not offered.
+func (s *Sender) auth(c *gosmtp.Client, host string) error {
+	if len(s.Username) == 0 {
+		return nil
+	}
+	ok, mechanisms := c.Extension("AUTH")
+	if !ok {
+		return ErrNoAuth
+	}
+	offered := make(map[string]bool)
+	for _, mechanism := range strings.Fields(strings.ToUpper(mechanisms)) {
+		offered[mechanism] = true
+	}
+	switch {
+	case offered["PLAIN"]:
+		return c.Auth(gosmtp.PlainAuth("", s.Username, s.Password, host))
+	case offered["LOGIN"]:
+		return c.Auth(&loginAuth{username: s.Username, password: s.Password, host: host})
+	}
+	return ErrNoAuth
+}
+
+// checkExtensions checks that the server can take the message: 8-bit data
+// needs 8BITMIME and UTF-8 addresses SMTPUTF8. net/smtp sends the BODY and
+// SMTPUTF8 parameters with MAIL whenever the server offers them.
+func checkExtensions(c *gosmtp.Client, from string, to []string, data []byte) error {
+	if !is7Bit(data) {
+		if ok, _ := c.Extension("8BITMIME"); !ok {
+			return ErrNo8BitMIME
+		}
+	}
+	for _, addr := range append([]string{from}, to...) {
+		if !is7Bit([]byte(addr)) {
+			if ok, _ := c.Extension("SMTPUTF8"); !ok {
+				return ErrNoSMTPUTF8
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// is7Bit ...
+func is7Bit(data []byte) bool {
+	for _, c := range data {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// withoutBcc returns m, or a copy of it without the Bcc and Resent-Bcc fields.
+func withoutBcc(m *eml.Message) *eml.Message {
+	keys := []string{"Bcc", "Resent-Bcc"}
+	found := false
+	for _, key := range keys {
+		found = found || m.Header.IsSet(key) || m.Fields.IsSet(key)
+	}
+	if !found {
+		return m
+	}
+
+	c := *m
+	c.Header = make(eml.Header, len(m.Header))
+	for key, values := range m.Header {
+		c.Header[key] = values
+	}
+	c.Fields = append(eml.Fields(nil), m.Fields...)
+	for _, key := range keys {
+		c.Header.Del(key)
+		c.Fields.Del(key)
+	}
+	return &c
+}
+
+// loginAuth is the LOGIN mechanism, which net/smtp lacks. Like PlainAuth, it
+// sends the password only over TLS or to localhost.
+type loginAuth struct {
+	username, password, host string
+}
+
+// Start ...
+func (a *loginAuth) Start(server *gosmtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("smtp: unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("smtp: wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+// Next ...
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch prompt := strings.ToLower(string(bytes.TrimSpace(fromServer))); {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("smtp: unexpected LOGIN challenge %q", fromServer)
+	}
+}
+
+// isLocalhost ...
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
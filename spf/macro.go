@@ -0,0 +1,173 @@
+package spf
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// expand expands the macros of a domain-spec, or of an explanation string
+// if exp is set, where the c, r and t macros are also allowed (RFC 7208,
+// section 7).
+func (c *checker) expand(spec, domain string, exp bool) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(spec); i++ {
+		if spec[i] != '%' {
+			b.WriteByte(spec[i])
+			continue
+		}
+		if i++; i == len(spec) {
+			return "", fmt.Errorf("spf: invalid macro in %q", spec)
+		}
+		switch spec[i] {
+		case '%':
+			b.WriteByte('%')
+			continue
+		case '_':
+			b.WriteByte(' ')
+			continue
+		case '-':
+			b.WriteString("%20")
+			continue
+		case '{':
+		default:
+			return "", fmt.Errorf("spf: invalid macro in %q", spec)
+		}
+
+		end := strings.IndexByte(spec[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("spf: unterminated macro in %q", spec)
+		}
+		value, err := c.macro(spec[i+1:i+end], domain, exp)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value)
+		i += end
+	}
+
+	expanded := b.String()
+	if !exp {
+		// keep the rightmost labels of a name too long for DNS
+		for len(expanded) > 253 {
+			dot := strings.IndexByte(expanded, '.')
+			if dot < 0 {
+				break
+			}
+			expanded = expanded[dot+1:]
+		}
+	}
+	return expanded, nil
+}
+
+// macro expands the body of a single %{...} macro: a letter, an optional
+// count of labels to keep and 'r' to reverse them, and the delimiters to
+// split on.
+func (c *checker) macro(body, domain string, exp bool) (string, error) {
+	if len(body) == 0 {
+		return "", fmt.Errorf("spf: empty macro")
+	}
+	letter := body[0]
+	rest := body[1:]
+
+	var value string
+	switch letter | 0x20 { // lower case
+	case 's':
+		value = c.sender
+	case 'l':
+		value = c.sender[:strings.LastIndexByte(c.sender, '@')]
+	case 'o':
+		value = senderDomain(c.sender)
+	case 'd':
+		value = domain
+	case 'i':
+		if ip4 := c.ip.To4(); ip4 != nil {
+			value = ip4.String()
+		} else {
+			value = ipNibbles(c.ip)
+		}
+	case 'p':
+		value = "unknown"
+		names := c.validatedNames()
+		for _, name := range names {
+			if canonicalName(name) == canonicalName(domain) {
+				value = name
+				break
+			}
+		}
+		if value == "unknown" && len(names) > 0 {
+			value = names[0]
+		}
+		value = strings.TrimSuffix(value, ".")
+	case 'v':
+		value = "ip6"
+		if c.ip.To4() != nil {
+			value = "in-addr"
+		}
+	case 'h':
+		value = c.helo
+	case 'c', 'r', 't':
+		if !exp {
+			return "", fmt.Errorf("spf: macro %%{%c} outside an explanation", letter)
+		}
+		switch letter | 0x20 {
+		case 'c':
+			value = c.ip.String()
+		case 'r':
+			value = "unknown"
+		default:
+			value = strconv.FormatInt(time.Now().Unix(), 10)
+		}
+	default:
+		return "", fmt.Errorf("spf: unknown macro %%{%s}", body)
+	}
+
+	// the transformers
+	digits := 0
+	for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+		digits++
+	}
+	keep := 0
+	if digits > 0 {
+		n, err := strconv.Atoi(rest[:digits])
+		if err != nil || n == 0 {
+			return "", fmt.Errorf("spf: invalid macro %%{%s}", body)
+		}
+		keep = n
+	}
+	rest = rest[digits:]
+	reverse := len(rest) > 0 && (rest[0] == 'r' || rest[0] == 'R')
+	if reverse {
+		rest = rest[1:]
+	}
+	delimiters := "."
+	if len(rest) > 0 {
+		if strings.Trim(rest, ".-+,/_=") != "" {
+			return "", fmt.Errorf("spf: invalid macro %%{%s}", body)
+		}
+		delimiters = rest
+	}
+
+	if keep > 0 || reverse || delimiters != "." {
+		labels := strings.FieldsFunc(value, func(r rune) bool {
+			return strings.ContainsRune(delimiters, r)
+		})
+		if reverse {
+			for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+				labels[i], labels[j] = labels[j], labels[i]
+			}
+		}
+		if keep > 0 && keep < len(labels) {
+			labels = labels[len(labels)-keep:]
+		}
+		value = strings.Join(labels, ".")
+	}
+
+	// upper case letters escape the value as a URL
+	if letter >= 'A' && letter <= 'Z' {
+		value = strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+	}
+	return value, nil
+}
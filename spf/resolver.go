@@ -0,0 +1,217 @@
+package spf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mel2oo/mailfile"
+)
+
+// Resolver looks up the DNS records SPF needs. Lookups of a name with no
+// record of the type return ErrNotFound, which counts as a void lookup.
+type Resolver interface {
+	LookupTXT(name string) ([]string, error)
+	// LookupIP returns the A and AAAA records of a name.
+	LookupIP(name string) ([]net.IP, error)
+	LookupMX(name string) ([]*net.MX, error)
+	// LookupAddr returns the PTR records of an IP address.
+	LookupAddr(addr string) ([]string, error)
+}
+
+// ErrNotFound is returned by a Resolver for a name with no such records.
+var ErrNotFound = errors.New("spf: no such record")
+
+// DNSResolver looks up records in DNS.
+type DNSResolver struct{}
+
+// LookupTXT ...
+func (DNSResolver) LookupTXT(name string) ([]string, error) {
+	records, err := net.LookupTXT(name)
+	return records, dnsError(err)
+}
+
+// LookupIP ...
+func (DNSResolver) LookupIP(name string) ([]net.IP, error) {
+	ips, err := net.LookupIP(name)
+	return ips, dnsError(err)
+}
+
+// LookupMX ...
+func (DNSResolver) LookupMX(name string) ([]*net.MX, error) {
+	mxs, err := net.LookupMX(name)
+	return mxs, dnsError(err)
+}
+
+// LookupAddr ...
+func (DNSResolver) LookupAddr(addr string) ([]string, error) {
+	names, err := net.LookupAddr(addr)
+	return names, dnsError(err)
+}
+
+// dnsError maps a missing name to ErrNotFound.
+func dnsError(err error) error {
+	if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Zone is a Resolver answering from records held in memory, such as a zone
+// file or a snapshot of the DNS taken when a message was received.
+type Zone struct {
+	records map[string]map[string][]string // by name, then type
+}
+
+// ParseZone reads records from lines in the style of a zone file:
+//
+//	example.com.        3600 IN TXT  "v=spf1 ip4:192.0.2.0/24 mx -all"
+//	example.com.             IN MX   10 mx.example.com.
+//	mx.example.com.          IN A    192.0.2.10
+//	10.2.0.192.in-addr.arpa. IN PTR  mx.example.com.
+//
+// Names are fully qualified, the TTL and class are optional, the types are
+// TXT, A, AAAA, MX and PTR, and lines starting with ';' or '#' are comments.
+func ParseZone(r io.Reader) (*Zone, error) {
+	z := &Zone{records: make(map[string]map[string][]string)}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		name := fields[0]
+		rest := strings.TrimSpace(line[len(name):])
+
+		// skip the TTL and the class, up to the type
+		var rtype string
+		for len(rest) > 0 {
+			word := strings.Fields(rest)[0]
+			rest = strings.TrimSpace(rest[len(word):])
+			if _, err := strconv.Atoi(word); err == nil || strings.EqualFold(word, "IN") {
+				continue
+			}
+			rtype = strings.ToUpper(word)
+			break
+		}
+		switch rtype {
+		case "TXT":
+			rest = mailfile.UnquoteTXT(rest)
+		case "A", "AAAA":
+			if net.ParseIP(rest) == nil {
+				return nil, fmt.Errorf("spf: zone line %d: invalid address %q", lineNo, rest)
+			}
+		case "MX":
+			if mx := strings.Fields(rest); len(mx) != 2 {
+				return nil, fmt.Errorf("spf: zone line %d: invalid MX record", lineNo)
+			}
+		case "PTR":
+		default:
+			return nil, fmt.Errorf("spf: zone line %d: unsupported record type %q", lineNo, rtype)
+		}
+		z.Add(name, rtype, rest)
+	}
+	return z, scanner.Err()
+}
+
+// Add adds a record, its data written as in a zone file.
+func (z *Zone) Add(name, rtype, data string) {
+	if z.records == nil {
+		z.records = make(map[string]map[string][]string)
+	}
+	name = canonicalName(name)
+	if z.records[name] == nil {
+		z.records[name] = make(map[string][]string)
+	}
+	rtype = strings.ToUpper(rtype)
+	z.records[name][rtype] = append(z.records[name][rtype], data)
+}
+
+// lookup ...
+func (z *Zone) lookup(name, rtype string) ([]string, error) {
+	records := z.records[canonicalName(name)][rtype]
+	if len(records) == 0 {
+		return nil, ErrNotFound
+	}
+	return records, nil
+}
+
+// LookupTXT ...
+func (z *Zone) LookupTXT(name string) ([]string, error) {
+	return z.lookup(name, "TXT")
+}
+
+// LookupIP ...
+func (z *Zone) LookupIP(name string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, rtype := range []string{"A", "AAAA"} {
+		records, _ := z.lookup(name, rtype)
+		for _, record := range records {
+			ips = append(ips, net.ParseIP(record))
+		}
+	}
+	if len(ips) == 0 {
+		return nil, ErrNotFound
+	}
+	return ips, nil
+}
+
+// LookupMX ...
+func (z *Zone) LookupMX(name string) ([]*net.MX, error) {
+	records, err := z.lookup(name, "MX")
+	if err != nil {
+		return nil, err
+	}
+	mxs := make([]*net.MX, 0, len(records))
+	for _, record := range records {
+		fields := strings.Fields(record)
+		pref, _ := strconv.Atoi(fields[0])
+		mxs = append(mxs, &net.MX{Host: fields[1], Pref: uint16(pref)})
+	}
+	sort.SliceStable(mxs, func(i, j int) bool { return mxs[i].Pref < mxs[j].Pref })
+	return mxs, nil
+}
+
+// LookupAddr ...
+func (z *Zone) LookupAddr(addr string) ([]string, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, ErrNotFound
+	}
+	return z.lookup(reverseName(ip), "PTR")
+}
+
+// reverseName returns the in-addr.arpa or ip6.arpa name of an IP address.
+func reverseName(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+	nibbles := strings.Split(ipNibbles(ip), ".")
+	for i, j := 0, len(nibbles)-1; i < j; i, j = i+1, j-1 {
+		nibbles[i], nibbles[j] = nibbles[j], nibbles[i]
+	}
+	return strings.Join(nibbles, ".") + ".ip6.arpa"
+}
+
+// ipNibbles returns the hexadecimal nibbles of an IPv6 address, dot
+// separated, as for the i macro.
+func ipNibbles(ip net.IP) string {
+	ip16 := ip.To16()
+	nibbles := make([]string, 0, 32)
+	for _, b := range ip16 {
+		nibbles = append(nibbles, strconv.FormatUint(uint64(b>>4), 16), strconv.FormatUint(uint64(b&0xf), 16))
+	}
+	return strings.Join(nibbles, ".")
+}
+
+// canonicalName ...
+func canonicalName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
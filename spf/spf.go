@@ -0,0 +1,550 @@
+// Package spf evaluates the Sender Policy Framework (RFC 7208) for the
+// client that sent a message, through a Resolver, so that SPF can be checked
+// again at analysis time against a zone file or a snapshot of the DNS.
+package spf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mel2oo/mailfile"
+)
+
+// Result is the result of an SPF check.
+type Result string
+
+const (
+	None      Result = "none"
+	Neutral   Result = "neutral"
+	Pass      Result = "pass"
+	Fail      Result = "fail"
+	SoftFail  Result = "softfail"
+	TempError Result = "temperror"
+	PermError Result = "permerror"
+)
+
+const (
+	// MaxLookups is the limit of mechanisms and modifiers doing DNS lookups.
+	MaxLookups = 10
+	// MaxVoidLookups is the limit of DNS lookups finding no record.
+	MaxVoidLookups = 2
+)
+
+// Outcome is the result of checking a client against the SPF policy of a
+// domain.
+type Outcome struct {
+	Result Result `json:"result"`
+	// Err tells why the result is TempError or PermError.
+	Err error `json:"-"`
+
+	IP     string `json:"ip"`
+	Sender string `json:"sender"`
+	Helo   string `json:"helo"`
+	Domain string `json:"domain"`
+
+	// Mechanism is the mechanism that matched, such as "-all", empty if the
+	// result comes from no match.
+	Mechanism string `json:"mechanism"`
+	// Explanation is the explanation of a Fail, from the exp= modifier.
+	Explanation string `json:"explanation"`
+
+	// Lookups and VoidLookups count the DNS lookups done.
+	Lookups     int `json:"lookups"`
+	VoidLookups int `json:"void-lookups"`
+}
+
+// Check checks the SPF policy of the domain of sender for the client ip, as
+// check_host() of RFC 7208. A null sender is replaced with postmaster at the
+// HELO name, as the RFC requires.
+func Check(ip net.IP, sender, helo string, r Resolver) *Outcome {
+	if r == nil {
+		r = DNSResolver{}
+	}
+	sender = strings.Trim(strings.TrimSpace(sender), "<>")
+	if len(sender) == 0 {
+		sender = "postmaster@" + helo
+	} else if !strings.Contains(sender, "@") {
+		sender = "postmaster@" + sender
+	}
+
+	o := &Outcome{Sender: sender, Helo: helo, Domain: senderDomain(sender)}
+	if ip == nil {
+		o.Result, o.Err = PermError, errors.New("spf: no client IP address")
+		return o
+	}
+	o.IP = ip.String()
+
+	c := &checker{ip: ip, sender: sender, helo: helo, r: r, outcome: o}
+	o.Result, o.Err = c.checkHost(o.Domain, 0)
+	o.Lookups, o.VoidLookups = c.lookups, c.voids
+	return o
+}
+
+// CheckMessage checks SPF for a normalized message: the client is the origin
+// hop of the Received chain, as found by mailfile.ParseTrace with the trusted
+// relays, with the HELO name it gave, and the sender is the Return-Path. The
+// result is appended to msg.Auth.
+func CheckMessage(msg *mailfile.Message, r Resolver, trustedRelays ...string) *Outcome {
+	var ip net.IP
+	var helo string
+	if hop := mailfile.ParseTrace(msg.Headers, trustedRelays...).Origin; hop != nil {
+		ip, helo = net.ParseIP(hop.FromIP), hop.Helo
+	}
+	sender := msg.Headers.Get("Return-Path")
+
+	o := Check(ip, sender, helo, r)
+	reason := o.Mechanism
+	if o.Err != nil {
+		reason = o.Err.Error()
+	} else if len(reason) > 0 {
+		reason = "matched " + reason
+	}
+	msg.Auth = append(msg.Auth, mailfile.AuthResult{
+		Method: "spf",
+		Result: string(o.Result),
+		Reason: reason,
+		Properties: map[string]string{
+			"smtp.mailfrom": o.Sender,
+			"smtp.helo":     o.Helo,
+			"client-ip":     o.IP,
+		},
+	})
+	return o
+}
+
+// errLimit is the error of a check going past the lookup limits.
+var errLimit = errors.New("spf: too many DNS lookups")
+
+// checker holds the state of a check across includes and redirects.
+type checker struct {
+	ip      net.IP
+	sender  string
+	helo    string
+	r       Resolver
+	outcome *Outcome
+	// included is the depth of include mechanisms being evaluated, whose
+	// matches are not the outcome
+	included int
+	lookups  int
+	voids    int
+}
+
+// term is a directive or a modifier of a record.
+type term struct {
+	qualifier byte // '+', '-', '~' or '?', 0 for a modifier
+	name      string
+	value     string // the domain-spec, or the modifier value
+	cidr4     int
+	cidr6     int
+	text      string
+}
+
+// checkHost evaluates the record of a domain.
+func (c *checker) checkHost(domain string, depth int) (Result, error) {
+	if depth > MaxLookups {
+		return PermError, errLimit
+	}
+	if !validDomain(domain) {
+		return None, fmt.Errorf("spf: invalid domain %q", domain)
+	}
+
+	record, result, err := c.record(domain)
+	if len(record) == 0 {
+		return result, err
+	}
+	terms, err := parseRecord(record)
+	if err != nil {
+		return PermError, err
+	}
+
+	var redirect, exp string
+	for _, t := range terms {
+		switch {
+		case t.qualifier == 0 && t.name == "redirect":
+			redirect = t.value
+		case t.qualifier == 0 && t.name == "exp":
+			exp = t.value
+		}
+	}
+	for _, t := range terms {
+		if t.qualifier == 0 {
+			continue
+		}
+		match, result, err := c.match(t, domain, depth)
+		if err != nil {
+			return result, err
+		}
+		if !match {
+			continue
+		}
+		result = qualifierResult(t.qualifier)
+		if c.included == 0 {
+			c.outcome.Mechanism = t.text
+			if result == Fail && len(exp) > 0 {
+				c.outcome.Explanation = c.explain(exp, domain)
+			}
+		}
+		return result, nil
+	}
+
+	if len(redirect) > 0 {
+		target, err := c.expand(redirect, domain, false)
+		if err != nil {
+			return PermError, err
+		}
+		if err := c.count(); err != nil {
+			return PermError, err
+		}
+		result, err := c.checkHost(target, depth+1)
+		if result == None {
+			return PermError, fmt.Errorf("spf: redirect to %q has no record", target)
+		}
+		if c.included == 0 && result != PermError {
+			c.outcome.Domain = target
+		}
+		return result, err
+	}
+	return Neutral, nil
+}
+
+// record returns the SPF record of a domain, or the result of there being
+// none or more than one.
+func (c *checker) record(domain string) (string, Result, error) {
+	txts, err := c.r.LookupTXT(domain)
+	if err == ErrNotFound {
+		return "", None, nil
+	} else if err != nil {
+		return "", TempError, err
+	}
+	var records []string
+	for _, txt := range txts {
+		if lower := strings.ToLower(txt); lower == "v=spf1" || strings.HasPrefix(lower, "v=spf1 ") {
+			records = append(records, txt)
+		}
+	}
+	switch len(records) {
+	case 0:
+		return "", None, nil
+	case 1:
+		return records[0], "", nil
+	}
+	return "", PermError, fmt.Errorf("spf: %q has more than one record", domain)
+}
+
+// expTerm matches a term: a qualified mechanism with its domain-spec and
+// CIDR lengths, or a modifier.
+var expTerm = regexp.MustCompile(`(?i)^([-+~?]?)([a-z][a-z0-9_.-]*)(?:([:=])([^/]*))?(?:/(\d+))?(?://(\d+))?$`)
+
+// parseRecord parses the terms of an SPF record.
+func parseRecord(record string) ([]*term, error) {
+	terms := make([]*term, 0)
+	seen := make(map[string]bool)
+	for _, text := range strings.Fields(record)[1:] {
+		match := expTerm.FindStringSubmatch(text)
+		if match == nil {
+			return nil, fmt.Errorf("spf: invalid term %q", text)
+		}
+		t := &term{name: strings.ToLower(match[2]), value: match[4], cidr4: -1, cidr6: -1, text: text}
+
+		if match[3] == "=" {
+			if len(match[1]) > 0 || len(match[5]) > 0 || len(match[6]) > 0 {
+				return nil, fmt.Errorf("spf: invalid modifier %q", text)
+			}
+			if (t.name == "redirect" || t.name == "exp") && seen[t.name] {
+				return nil, fmt.Errorf("spf: duplicate %s modifier", t.name)
+			}
+			seen[t.name] = true
+			terms = append(terms, t)
+			continue
+		}
+
+		t.qualifier = '+'
+		if len(match[1]) > 0 {
+			t.qualifier = match[1][0]
+		}
+		if len(match[5]) > 0 {
+			t.cidr4, _ = strconv.Atoi(match[5])
+		}
+		if len(match[6]) > 0 {
+			t.cidr6, _ = strconv.Atoi(match[6])
+		}
+
+		hasValue := match[3] == ":"
+		switch t.name {
+		case "all":
+			if hasValue || t.cidr4 >= 0 || t.cidr6 >= 0 {
+				return nil, fmt.Errorf("spf: invalid term %q", text)
+			}
+		case "include", "exists":
+			if !hasValue || len(t.value) == 0 || t.cidr4 >= 0 || t.cidr6 >= 0 {
+				return nil, fmt.Errorf("spf: invalid term %q", text)
+			}
+		case "a", "mx", "ptr":
+			if hasValue && len(t.value) == 0 || t.name == "ptr" && (t.cidr4 >= 0 || t.cidr6 >= 0) {
+				return nil, fmt.Errorf("spf: invalid term %q", text)
+			}
+		case "ip4", "ip6":
+			// the address holds colons, keep all of it
+			value := text[strings.IndexByte(text, ':')+1:]
+			addr, bits, _ := strings.Cut(value, "/")
+			ip := net.ParseIP(addr)
+			if ip == nil || t.name == "ip4" && ip.To4() == nil || t.name == "ip6" && ip.To4() != nil && !strings.Contains(addr, ":") {
+				return nil, fmt.Errorf("spf: invalid address in %q", text)
+			}
+			t.value, t.cidr4, t.cidr6 = addr, -1, -1
+			if len(bits) > 0 {
+				n, err := strconv.Atoi(bits)
+				max := 128
+				if t.name == "ip4" {
+					max = 32
+				}
+				if err != nil || n < 0 || n > max {
+					return nil, fmt.Errorf("spf: invalid prefix length in %q", text)
+				}
+				if t.name == "ip4" {
+					t.cidr4 = n
+				} else {
+					t.cidr6 = n
+				}
+			}
+		default:
+			return nil, fmt.Errorf("spf: unknown mechanism %q", text)
+		}
+		if t.cidr4 > 32 || t.cidr6 > 128 {
+			return nil, fmt.Errorf("spf: invalid prefix length in %q", text)
+		}
+		terms = append(terms, t)
+	}
+	return terms, nil
+}
+
+// match reports whether a mechanism matches the client.
+func (c *checker) match(t *term, domain string, depth int) (bool, Result, error) {
+	switch t.name {
+	case "all":
+		return true, "", nil
+
+	case "ip4", "ip6":
+		return inNetwork(c.ip, net.ParseIP(t.value), t.cidr4, t.cidr6), "", nil
+
+	case "include":
+		if err := c.count(); err != nil {
+			return false, PermError, err
+		}
+		target, err := c.expand(t.value, domain, false)
+		if err != nil {
+			return false, PermError, err
+		}
+		c.included++
+		result, err := c.checkHost(target, depth+1)
+		c.included--
+		switch result {
+		case Pass:
+			return true, "", nil
+		case Fail, SoftFail, Neutral:
+			return false, "", nil
+		case TempError:
+			return false, TempError, err
+		default:
+			if err == nil {
+				err = fmt.Errorf("spf: include of %q has no record", target)
+			}
+			return false, PermError, err
+		}
+
+	case "a", "mx", "ptr", "exists":
+		if err := c.count(); err != nil {
+			return false, PermError, err
+		}
+		target := domain
+		if len(t.value) > 0 {
+			var err error
+			if target, err = c.expand(t.value, domain, false); err != nil {
+				return false, PermError, err
+			}
+		}
+		switch t.name {
+		case "a":
+			return c.matchHosts([]string{target}, t)
+		case "mx":
+			mxs, err := c.r.LookupMX(target)
+			if result, err := c.void(err); err != nil {
+				return false, result, err
+			}
+			if len(mxs) > MaxLookups {
+				return false, PermError, fmt.Errorf("spf: %q has more than %d MX records", target, MaxLookups)
+			}
+			hosts := make([]string, 0, len(mxs))
+			for _, mx := range mxs {
+				hosts = append(hosts, mx.Host)
+			}
+			return c.matchHosts(hosts, t)
+		case "ptr":
+			for _, name := range c.validatedNames() {
+				name = canonicalName(name)
+				if target = canonicalName(target); name == target || strings.HasSuffix(name, "."+target) {
+					return true, "", nil
+				}
+			}
+			return false, "", nil
+		default: // exists
+			ips, err := c.r.LookupIP(target)
+			if result, err := c.void(err); err != nil {
+				return false, result, err
+			}
+			for _, ip := range ips {
+				if ip.To4() != nil {
+					return true, "", nil
+				}
+			}
+			return false, "", nil
+		}
+	}
+	return false, PermError, fmt.Errorf("spf: unknown mechanism %q", t.text)
+}
+
+// matchHosts reports whether the client is in the networks of the addresses
+// of hosts.
+func (c *checker) matchHosts(hosts []string, t *term) (bool, Result, error) {
+	for _, host := range hosts {
+		ips, err := c.r.LookupIP(host)
+		if result, err := c.void(err); err != nil {
+			return false, result, err
+		}
+		for _, ip := range ips {
+			if inNetwork(c.ip, ip, t.cidr4, t.cidr6) {
+				return true, "", nil
+			}
+		}
+	}
+	return false, "", nil
+}
+
+// validatedNames returns the names of the client address whose addresses
+// include it back, as for the ptr mechanism and the p macro.
+func (c *checker) validatedNames() []string {
+	names, err := c.r.LookupAddr(c.ip.String())
+	if err != nil {
+		return nil
+	}
+	if len(names) > MaxLookups {
+		names = names[:MaxLookups]
+	}
+	validated := make([]string, 0, len(names))
+	for _, name := range names {
+		ips, _ := c.r.LookupIP(name)
+		for _, ip := range ips {
+			if ip.Equal(c.ip) {
+				validated = append(validated, name)
+				break
+			}
+		}
+	}
+	return validated
+}
+
+// count counts a mechanism or modifier doing DNS lookups.
+func (c *checker) count() error {
+	c.lookups++
+	if c.lookups > MaxLookups {
+		return errLimit
+	}
+	return nil
+}
+
+// void counts a lookup finding no record, which is not an error below the
+// limit.
+func (c *checker) void(err error) (Result, error) {
+	switch {
+	case err == nil:
+		return "", nil
+	case err == ErrNotFound:
+		c.voids++
+		if c.voids > MaxVoidLookups {
+			return PermError, errors.New("spf: too many void DNS lookups")
+		}
+		return "", nil
+	}
+	return TempError, err
+}
+
+// explain returns the explanation of a Fail, empty if there is none.
+func (c *checker) explain(exp, domain string) string {
+	target, err := c.expand(exp, domain, false)
+	if err != nil {
+		return ""
+	}
+	txts, err := c.r.LookupTXT(target)
+	if err != nil || len(txts) != 1 {
+		return ""
+	}
+	text, err := c.expand(txts[0], domain, true)
+	if err != nil {
+		return ""
+	}
+	return text
+}
+
+// qualifierResult ...
+func qualifierResult(qualifier byte) Result {
+	switch qualifier {
+	case '-':
+		return Fail
+	case '~':
+		return SoftFail
+	case '?':
+		return Neutral
+	}
+	return Pass
+}
+
+// inNetwork reports whether ip is in the network of addr with the prefix
+// length of its family, the whole address if it is negative.
+func inNetwork(ip, addr net.IP, cidr4, cidr6 int) bool {
+	if addr == nil {
+		return false
+	}
+	if ip4, addr4 := ip.To4(), addr.To4(); ip4 != nil || addr4 != nil {
+		if ip4 == nil || addr4 == nil {
+			return false
+		}
+		if cidr4 < 0 {
+			cidr4 = 32
+		}
+		mask := net.CIDRMask(cidr4, 32)
+		return ip4.Mask(mask).Equal(addr4.Mask(mask))
+	}
+	if cidr6 < 0 {
+		cidr6 = 128
+	}
+	mask := net.CIDRMask(cidr6, 128)
+	return ip.To16().Mask(mask).Equal(addr.To16().Mask(mask))
+}
+
+// senderDomain returns the domain of a sender address.
+func senderDomain(sender string) string {
+	return sender[strings.LastIndexByte(sender, '@')+1:]
+}
+
+// validDomain reports whether a domain can be checked: a name of at least two
+// labels, none empty or longer than 63 characters.
+func validDomain(domain string) bool {
+	domain = strings.TrimSuffix(domain, ".")
+	if len(domain) == 0 || len(domain) > 253 {
+		return false
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+	}
+	return true
+}
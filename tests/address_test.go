@@ -0,0 +1,74 @@
+package test
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/mel2oo/mailfile"
+	"github.com/mel2oo/mailfile/eml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAddressList(t *testing.T) {
+	cases := []struct {
+		list  string
+		addrs []*mail.Address
+		rest  string
+	}{
+		{`"Doe, John" <john@example.com>,jane@example.com`, []*mail.Address{
+			{Name: "Doe, John", Address: "john@example.com"},
+			{Name: "", Address: "jane@example.com"},
+		}, ""},
+		{`team: a@example.com, "B" <b@example.com>; c@example.com`, []*mail.Address{
+			{Address: "a@example.com"},
+			{Name: "B", Address: "b@example.com"},
+			{Address: "c@example.com"},
+		}, ""},
+		{"undisclosed-recipients:;", nil, ""},
+		{"john@example.com (John Doe)", []*mail.Address{{Name: "John Doe", Address: "john@example.com"}}, ""},
+		{"<@relay.example.com,@mx.example.com:john@example.com>", []*mail.Address{{Address: "john@example.com"}}, ""},
+		{"张三 <zhangsan@example.com>", []*mail.Address{{Name: "张三", Address: "zhangsan@example.com"}}, ""},
+		{"=?utf-8?Q?Doe,_John?= <john@example.com>", []*mail.Address{{Name: "Doe, John", Address: "john@example.com"}}, ""},
+		{"John Doe john@example.com; 'Jane' <jane@example.com>", []*mail.Address{
+			{Name: "John Doe", Address: "john@example.com"},
+			{Name: "Jane", Address: "jane@example.com"},
+		}, ""},
+		{"John Doe, <>, jane@example.com", []*mail.Address{{Address: "jane@example.com"}}, "John Doe, <>"},
+	}
+
+	for _, c := range cases {
+		addrs, rest := mailfile.ParseAddressList(c.list)
+		assert.Equal(t, addrs, c.addrs, c.list)
+		assert.Equal(t, rest, c.rest, c.list)
+	}
+}
+
+func TestParseEMLAddresses(t *testing.T) {
+	raw := strings.Join([]string{
+		"From: =?utf-8?B?5byg5LiJ?= <zhangsan@example.com>",
+		`To: "Hill, Lawrence" <lvhill@example.com>,ops@example.com`,
+		"Cc: team: a@example.com, b@example.com;",
+		"Resent-From: relay@example.com",
+		"Resent-To: =?utf-8?Q?Doe,_Jane?= <jane@example.com>",
+		"Subject: addresses",
+		"",
+		"body",
+	}, "\r\n")
+
+	m, err := eml.ParseMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(m.Header.To()), 2)
+
+	res := m.Format()
+	assert.Equal(t, res.From[0].Name, "张三")
+	assert.Equal(t, len(res.To), 2)
+	assert.Equal(t, res.To[0].Name, "Hill, Lawrence")
+	assert.Equal(t, res.To[1].Address, "ops@example.com")
+	assert.Equal(t, len(res.Cc), 2)
+	assert.Equal(t, len(res.Resent), 1)
+	assert.Equal(t, res.Resent[0].From[0].Address, "relay@example.com")
+	assert.Equal(t, res.Resent[0].To[0].Name, "Doe, Jane")
+}
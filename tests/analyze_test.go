@@ -0,0 +1,90 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mel2oo/mailfile/analyze"
+	"github.com/mel2oo/mailfile/eml"
+	"github.com/stretchr/testify/assert"
+)
+
+// findingCodes returns the codes of findings, by code.
+func findingCodes(findings []analyze.Finding) map[string]analyze.Finding {
+	codes := make(map[string]analyze.Finding)
+	for _, f := range findings {
+		codes[f.Code] = f
+	}
+	return codes
+}
+
+func TestAnalyzeHeaders(t *testing.T) {
+	m, err := eml.ParseMessage(strings.NewReader("Received: from mail.example.net (mail.example.net [192.0.2.1]) by mx.example.com with ESMTP; Mon, 31 Oct 2022 16:12:19 +0000\r\n" +
+		"Return-Path: <bounce@esp.example.net>\r\n" +
+		"From: \"support@paypal.com\" <support@example.net>\r\n" +
+		"Sender: news@lists.example.org\r\n" +
+		"Reply-To: payments@example.org\r\n" +
+		"Subject: Account\r\n" +
+		"Subject: Account locked\r\n" +
+		"Date: Fri, 28 Oct 2022 16:12:19 +0000\r\n" +
+		"Message-ID: <1234@mailer.example.org>\r\n" +
+		"\r\n" +
+		"Hello\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codes := findingCodes(analyze.Headers(m.Format(), nil))
+	assert.Equal(t, analyze.Medium, codes[analyze.CodeReplyToMismatch].Severity)
+	assert.Equal(t, "payments@example.org", codes[analyze.CodeReplyToMismatch].Evidence["reply-to"])
+	assert.NotContains(t, codes, analyze.CodeReturnPathMismatch) // same organizational domain
+	assert.Equal(t, analyze.High, codes[analyze.CodeDisplayNameAddress].Severity)
+	assert.Equal(t, "support@paypal.com", codes[analyze.CodeDisplayNameAddress].Evidence["shown"])
+	assert.Equal(t, analyze.Medium, codes[analyze.CodeSenderMismatch].Severity)
+	assert.Equal(t, "<1234@mailer.example.org>", codes[analyze.CodeMessageIDDomain].Evidence["message-id"])
+	assert.Equal(t, "72h0m0s", codes[analyze.CodeDateSkew].Evidence["skew"])
+	assert.Equal(t, "Subject", codes[analyze.CodeDuplicateHeader].Evidence["field"])
+	assert.NotContains(t, codes, analyze.CodeMissingHeader)
+
+	codes = findingCodes(analyze.Headers(m.Format(), &analyze.Options{MaxDateSkew: 100 * time.Hour}))
+	assert.NotContains(t, codes, analyze.CodeDateSkew)
+}
+
+func TestAnalyzeHeadersDateSkew(t *testing.T) {
+	// the oldest Received has no date, the next one is used
+	m, err := eml.ParseMessage(strings.NewReader("Received: from relay.example.net (relay.example.net [192.0.2.2]) by mx.example.com with ESMTP; Mon, 31 Oct 2022 16:12:19 +0000\r\n" +
+		"Received: from [10.0.0.1] by relay.example.net with HTTP\r\n" +
+		"From: alice@example.net\r\n" +
+		"Subject: Account\r\n" +
+		"Date: Fri, 28 Oct 2022 16:12:19 +0000\r\n" +
+		"\r\n" +
+		"Hello\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codes := findingCodes(analyze.Headers(m.Format(), nil))
+	assert.Equal(t, "72h0m0s", codes[analyze.CodeDateSkew].Evidence["skew"])
+}
+
+func TestAnalyzeHeadersMissing(t *testing.T) {
+	m, err := eml.ParseMessage(strings.NewReader("To: user@example.com\r\n" +
+		"Date: yesterday\r\n" +
+		"\r\n" +
+		"Hello\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	findings := analyze.Message(m.Format(), nil)
+	codes := findingCodes(findings)
+	assert.Contains(t, codes, analyze.CodeInvalidDate)
+	missing := make([]string, 0)
+	for _, f := range findings {
+		if f.Code == analyze.CodeMissingHeader {
+			missing = append(missing, f.Evidence["field"])
+		}
+	}
+	assert.Equal(t, []string{"From", "Message-ID"}, missing)
+}
@@ -0,0 +1,111 @@
+package test
+
+import (
+	"net/mail"
+	"testing"
+
+	"github.com/mel2oo/mailfile/authres"
+	"github.com/mel2oo/mailfile/eml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAuthenticationResults(t *testing.T) {
+	r, err := authres.Parse(`mx.google.com;
+       dkim=pass header.i=@example.com header.s=20210112 header.b=Abc0+/de;
+       spf=pass (google.com: domain of user@example.com designates 192.0.2.1 as permitted sender) smtp.mailfrom=user@example.com;
+       dmarc=fail (p=REJECT sp=REJECT dis=NONE) reason="policy (strict)" header.from=example.com`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "mx.google.com", r.AuthServID)
+	assert.Equal(t, 1, r.Version)
+	if assert.Len(t, r.Results, 3) {
+		assert.Equal(t, "dkim", r.Results[0].Method)
+		assert.Equal(t, "pass", r.Results[0].Result)
+		assert.Equal(t, "@example.com", r.Results[0].Properties["header.i"])
+		assert.Equal(t, "Abc0+/de", r.Results[0].Properties["header.b"])
+		assert.Equal(t, "user@example.com", r.Results[1].Properties["smtp.mailfrom"])
+		assert.Equal(t, "fail", r.Results[2].Result)
+		assert.Equal(t, "policy (strict)", r.Results[2].Reason)
+		assert.Equal(t, "example.com", r.Results[2].Properties["header.from"])
+	}
+
+	r, err = authres.Parse("example.org 1; none")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "example.org", r.AuthServID)
+		assert.Empty(t, r.Results)
+	}
+
+	_, err = authres.Parse("example.org; spf pass")
+	assert.ErrorIs(t, err, authres.ErrSyntax)
+	_, err = authres.Parse("example.org; spf=pass (unterminated")
+	assert.ErrorIs(t, err, authres.ErrSyntax)
+}
+
+func TestParseReceivedSPF(t *testing.T) {
+	r, err := authres.ParseReceivedSPF(`Pass (protection.outlook.com: domain of example.com designates 192.0.2.1 as permitted sender) receiver=protection.outlook.com; client-ip=192.0.2.1; helo=mail.example.com; envelope-from="user@example.com"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "spf", r.Method)
+	assert.Equal(t, "pass", r.Result)
+	assert.Equal(t, "protection.outlook.com: domain of example.com designates 192.0.2.1 as permitted sender", r.Reason)
+	assert.Equal(t, "192.0.2.1", r.Properties["client-ip"])
+	assert.Equal(t, "user@example.com", r.Properties["envelope-from"])
+}
+
+func TestParseAuthHeaders(t *testing.T) {
+	m, err := eml.New("testdata/927e94db23827c4247e112f04ff80769.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := authres.ParseHeaders(m.Format().Headers)
+	assert.Empty(t, hs.Errors)
+
+	// Exchange Online leaves the authserv-id out
+	if assert.Len(t, hs.AuthenticationResults, 1) {
+		r := hs.AuthenticationResults[0]
+		assert.Equal(t, "", r.AuthServID)
+		assert.Equal(t, "spf", r.Results[0].Method)
+		assert.Equal(t, "unaula.edu.co", r.Results[0].Properties["smtp.mailfrom"])
+		assert.Equal(t, "unaulaedu.onmicrosoft.com", r.Results[1].Properties["header.d"])
+	}
+	if assert.Len(t, hs.ReceivedSPF, 1) {
+		assert.Equal(t, "pass", hs.ReceivedSPF[0].Result)
+		assert.Equal(t, "40.107.96.108", hs.ReceivedSPF[0].Properties["client-ip"])
+	}
+
+	arc := hs.ARC
+	assert.Equal(t, authres.ChainPass, arc.Status)
+	if assert.Len(t, arc.Sets, 2) {
+		assert.Equal(t, 1, arc.Sets[0].Instance)
+		assert.Equal(t, authres.ChainNone, arc.Sets[0].ChainValidation)
+		assert.Equal(t, "mx.microsoft.com", arc.Sets[0].Results.AuthServID)
+		assert.Equal(t, "microsoft.com", arc.Sets[1].SealDomain)
+		assert.Equal(t, "arcselector9901", arc.Sets[1].SignatureSelector)
+		assert.Contains(t, arc.Sets[1].SignedHeaders, "from")
+	}
+	assert.Len(t, hs.Trusted("mx.microsoft.com"), 0)
+	assert.Len(t, hs.Trusted(""), 4)
+}
+
+func TestParseARCBroken(t *testing.T) {
+	h := mail.Header{
+		"Arc-Authentication-Results": {"i=1; mx.example.org; spf=pass smtp.mailfrom=example.com", "i=2; mx.example.net; arc=pass"},
+		"Arc-Message-Signature":      {"i=1; a=rsa-sha256; d=example.org; s=arc; h=from; bh=x; b=y", "i=2; a=rsa-sha256; d=example.net; s=arc; h=from; bh=x; b=y"},
+		"Arc-Seal":                   {"i=1; a=rsa-sha256; d=example.org; s=arc; cv=none; b=z"},
+	}
+	arc, err := authres.ParseARC(h)
+	if assert.NoError(t, err) {
+		assert.Equal(t, authres.ChainFail, arc.Status)
+		assert.Equal(t, "ARC set 2 has 0 ARC-Seal fields", arc.Reason)
+	}
+
+	h["Arc-Seal"] = append(h["Arc-Seal"], "i=2; a=rsa-sha256; d=example.net; s=arc; cv=fail; b=z")
+	arc, _ = authres.ParseARC(h)
+	assert.Equal(t, authres.ChainFail, arc.Status)
+	assert.Equal(t, "ARC set 2 declares the chain failed", arc.Reason)
+
+	arc, _ = authres.ParseARC(mail.Header{})
+	assert.Equal(t, authres.ChainNone, arc.Status)
+}
@@ -0,0 +1,97 @@
+package test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mel2oo/mailfile/eml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilder(t *testing.T) {
+	forward, err := eml.ParseMessage(strings.NewReader("From: carol@example.com\r\nSubject: fwd\r\n\r\nforwarded\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := eml.NewBuilder().
+		From("Alice Martin <alice@example.com>").
+		To("bob@example.com", "李雷 <li@example.com>").
+		Bcc("hidden@example.com").
+		Subject("Réunion").
+		AddHeader("X-Mailer", "mailfile").
+		Text([]byte("hello"))
+	cid := b.Inline("logo.png", "", []byte{0x89, 'P', 'N', 'G'})
+	m, err := b.HTML([]byte(`<p>hello</p><img src="cid:`+cid+`">`)).
+		Attach("报告.pdf", "", []byte("%PDF-1.4")).
+		Forward(forward).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, strings.HasSuffix(cid, "logo.png@"+cid[strings.LastIndex(cid, "@")+1:]))
+	assert.NotEmpty(t, m.Header.Get("Message-Id"))
+	assert.Equal(t, m.Header.Get("Mime-Version"), "1.0")
+
+	data, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, string(data), "hidden@example.com")
+	assert.Contains(t, string(data), "filename*=utf-8''%E6%8A%A5%E5%91%8A.pdf")
+
+	parsed, err := eml.ParseMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, _, _ := parsed.Header.ContentType()
+	assert.Equal(t, mediaType, "multipart/mixed")
+	assert.Equal(t, len(parsed.Parts), 3)
+
+	alternative := parsed.Parts[0]
+	mediaType, _, _ = alternative.Header.ContentType()
+	assert.Equal(t, mediaType, "multipart/alternative")
+	related := alternative.Parts[1]
+	mediaType, _, _ = related.Header.ContentType()
+	assert.Equal(t, mediaType, "multipart/related")
+	assert.Equal(t, related.Parts[1].Header.Get("Content-Id"), "<"+cid+">")
+	assert.Equal(t, related.Parts[1].Header.Get("Content-Type"), "image/png")
+	assert.Equal(t, parsed.Parts[2].SubMessage.Body, []byte("forwarded\r\n"))
+
+	msg := parsed.Format()
+	assert.Equal(t, msg.Subject, "Réunion")
+	assert.Equal(t, msg.To[1].Name, "李雷")
+	text, _ := io.ReadAll(msg.Body)
+	assert.Equal(t, string(text), "hello")
+	assert.Equal(t, len(msg.Attachments), 1)
+	assert.Equal(t, msg.Attachments[0].Filename, "报告.pdf")
+	assert.Equal(t, len(msg.Embeddeds), 1)
+}
+
+func TestBuilderInvalid(t *testing.T) {
+	_, err := eml.NewBuilder().To("bob@example.com").Text([]byte("hello")).Build()
+	assert.NotNil(t, err)
+
+	m := &eml.Message{Header: eml.NewHeader("alice@example.com", "empty", "bob@example.com")}
+	m.Header.Set("Content-Type", "multipart/mixed; boundary=b")
+	assert.Nil(t, m.Save())
+	assert.Equal(t, m.Validate(), eml.ErrMessagePayload)
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("no entropy") }
+
+func TestBuilderRandomError(t *testing.T) {
+	reader := rand.Reader
+	rand.Reader = failingReader{}
+	defer func() { rand.Reader = reader }()
+
+	_, err := eml.NewBuilder().From("alice@example.com").To("bob@example.com").
+		Text([]byte("hello")).HTML([]byte("<p>hello</p>")).Build()
+	assert.NotNil(t, err)
+}
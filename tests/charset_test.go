@@ -0,0 +1,138 @@
+package test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mel2oo/mailfile"
+	"github.com/mel2oo/mailfile/charset"
+	"github.com/mel2oo/mailfile/eml"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+func TestParseEMLCharset(t *testing.T) {
+	raw := strings.Join([]string{
+		"From: <sender@example.com>",
+		"Subject: charset",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/alternative; boundary="b"`,
+		"",
+		"--b",
+		`Content-Type: text/plain; charset="Windows-1251"`,
+		"Content-Transfer-Encoding: quoted-printable",
+		"",
+		"=CF=F0=E8=E2=E5=F2",
+		"--b",
+		"Content-Type: text/html",
+		"",
+		`<html><head><meta http-equiv="Content-Type" content="text/html; charset=iso-8859-1"></head>` +
+			"<body>D\xe9claration</body></html>",
+		"--b--",
+		"",
+	}, "\r\n")
+
+	m, err := eml.ParseMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := m.Format()
+	assert.Equal(t, res.Charset, "windows-1251")
+
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, string(body), "Привет")
+
+	html, _ := io.ReadAll(res.Html)
+	assert.Contains(t, string(html), "Déclaration")
+}
+
+func TestDetectCharset(t *testing.T) {
+	cases := map[string]encoding.Encoding{
+		"gb18030":      simplifiedchinese.GBK,
+		"big5":         traditionalchinese.Big5,
+		"shift_jis":    japanese.ShiftJIS,
+		"euc-kr":       korean.EUCKR,
+		"windows-1251": charmap.Windows1251,
+		"koi8-r":       charmap.KOI8R,
+	}
+	texts := map[string]string{
+		"gb18030":      "您好，请查收附件中的发票，谢谢。",
+		"big5":         "您好，請查收附件中的發票，謝謝。",
+		"shift_jis":    "お世話になっております。請求書を添付いたします。",
+		"euc-kr":       "안녕하세요. 첨부된 청구서를 확인해 주세요.",
+		"windows-1251": "Здравствуйте, пожалуйста, проверьте счет во вложении.",
+		"koi8-r":       "Здравствуйте, пожалуйста, проверьте счет во вложении.",
+	}
+
+	for name, enc := range cases {
+		data, err := enc.NewEncoder().Bytes([]byte(texts[name]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, charset.Best(data), name)
+	}
+
+	assert.Equal(t, charset.Best([]byte("plain text")), "us-ascii")
+	assert.Equal(t, charset.Best([]byte("Größe")), "utf-8")
+}
+
+func TestParseEMLUndeclaredCharset(t *testing.T) {
+	body, _ := charmap.Windows1251.NewEncoder().Bytes([]byte("Пожалуйста, оплатите счет до пятницы."))
+	subject, _ := charmap.Windows1251.NewEncoder().Bytes([]byte("Счет"))
+	raw := "From: <sender@example.com>\r\nSubject: " + string(subject) + "\r\n" +
+		"Content-Type: text/plain\r\n\r\n" + string(body)
+
+	m, err := eml.ParseMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := m.Format()
+	assert.Equal(t, res.Subject, "Счет")
+	assert.Equal(t, res.Charset, "windows-1251")
+
+	text, _ := io.ReadAll(res.Body)
+	assert.Equal(t, string(text), "Пожалуйста, оплатите счет до пятницы.")
+}
+
+func TestConvertCharset(t *testing.T) {
+	cases := []struct {
+		charset string
+		data    []byte
+		text    string
+	}{
+		{"unicode-1-1-utf-7", []byte("Hi Mom -+Jjo--!"), "Hi Mom -☺-!"},
+		{"UTF-7", []byte("+ZeVnLIqe-"), "日本語"},
+		{"utf-7", []byte("1 +- 1 = 2"), "1 + 1 = 2"},
+		{"ks_c_5601-1987", []byte{0xC7, 0xD1, 0xB1, 0xDB}, "한글"},
+		{"GB2312", []byte{0xC4, 0xE3, 0xBA, 0xC3}, "你好"},
+		{"x-mac-cyrillic", []byte{0x8F, 0xF0, 0xE8, 0xE2, 0xE5, 0xF2}, "Привет"},
+		{"cp1252", []byte("\x93quoted\x94"), "“quoted”"},
+	}
+
+	for _, c := range cases {
+		text, err := mailfile.ConvertData(c.data, c.charset)
+		assert.Nil(t, err, c.charset)
+		assert.Equal(t, text, c.text, c.charset)
+	}
+
+	data, err := charset.UTF7.NewEncoder().String("Hi Mom -☺-! 日本語")
+	assert.Nil(t, err)
+	text, _ := charset.Convert([]byte(data), "utf-7")
+	assert.Equal(t, text, "Hi Mom -☺-! 日本語")
+
+	_, err = charset.Lookup("x-unknown-charset")
+	assert.NotNil(t, err)
+
+	charset.Register("x-unknown-charset", charmap.CodePage437)
+	text, err = charset.Convert([]byte{0x82}, "X-Unknown-Charset")
+	assert.Nil(t, err)
+	assert.Equal(t, text, "é")
+}
@@ -0,0 +1,224 @@
+package test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mel2oo/mailfile/dkim"
+	"github.com/mel2oo/mailfile/eml"
+	"github.com/stretchr/testify/assert"
+)
+
+// rfc8463Message is the example message of RFC 8463, signed with
+// rfc8463Seed by brisbane._domainkey.football.example.com.
+const rfc8463Message = "From: Joe SixPack <joe@football.example.com>\r\n" +
+	"To: Suzie Q <suzie@shopping.example.net>\r\n" +
+	"Subject: Is dinner ready?\r\n" +
+	"Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+	"Message-ID: <20030712040037.46341.5F8J@football.example.com>\r\n" +
+	"\r\n" +
+	"Hi.\r\n" +
+	"\r\n" +
+	"We lost the game.  Are you hungry yet?\r\n" +
+	"\r\n" +
+	"Joe.\r\n"
+
+const rfc8463Seed = "nWGxne/9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A="
+
+func rfc8463Key(t *testing.T) ed25519.PrivateKey {
+	seed, err := base64.StdEncoding.DecodeString(rfc8463Seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+func TestDKIMSign(t *testing.T) {
+	m, err := eml.ParseMessage(strings.NewReader(rfc8463Message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := rfc8463Key(t)
+
+	signed, err := dkim.SignMessage(m, &dkim.SignOptions{
+		Domain:   "football.example.com",
+		Selector: "brisbane",
+		Signer:   key,
+		Oversign: []string{"From", "Subject", "Date"},
+		Time:     time.Unix(1528637909, 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, strings.HasSuffix(string(signed), "\r\n"+rfc8463Message))
+	field := string(signed[:len(signed)-len(rfc8463Message)])
+	for _, line := range strings.Split(strings.TrimSuffix(field, "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 78)
+	}
+	unfolded := strings.NewReplacer("\r\n\t", " ").Replace(field)
+	assert.Contains(t, unfolded, "a=ed25519-sha256; c=relaxed/relaxed; d=football.example.com; s=brisbane; t=1528637909;")
+	assert.Contains(t, unfolded, "h=from:from:subject:subject:date:date:to:message-id;")
+	assert.Contains(t, unfolded, "bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;")
+
+	// with simple canonicalization, the signed data is the fields as they
+	// are, bottom up, then the signature field without the value of b=
+	signed, err = dkim.Sign([]byte(rfc8463Message), &dkim.SignOptions{
+		Domain:                 "football.example.com",
+		Selector:               "brisbane",
+		Signer:                 key,
+		HeaderCanonicalization: dkim.Simple,
+		BodyCanonicalization:   dkim.Simple,
+		Headers:                []string{"Subject", "To"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	field = string(signed[:len(signed)-len(rfc8463Message)])
+	b := regexp.MustCompile(`b=([\r\n\tA-Za-z0-9+/=]+)\r\n$`).FindStringSubmatch(field)
+	if b == nil {
+		t.Fatal(field)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.NewReplacer("\r\n\t", "").Replace(b[1]))
+	assert.Nil(t, err)
+	lines := strings.SplitAfter(rfc8463Message, "\r\n")
+	data := lines[0] + lines[2] + lines[1] + strings.TrimSuffix(field, b[1]+"\r\n")
+	sum := sha256.Sum256([]byte(data))
+	assert.True(t, ed25519.Verify(key.Public().(ed25519.PublicKey), sum[:], signature))
+
+	_, err = dkim.Sign([]byte(rfc8463Message), &dkim.SignOptions{Domain: "football.example.com"})
+	assert.Equal(t, err, dkim.ErrSignOptions)
+}
+
+// rfc8463Signature is the Ed25519 signature of rfc8463Message in RFC 8463.
+const rfc8463Signature = "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;\r\n" +
+	" d=football.example.com; i=@football.example.com;\r\n" +
+	" q=dns/txt; s=brisbane; t=1528637909; h=from : to :\r\n" +
+	" subject : date : message-id : from : subject : date;\r\n" +
+	" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+	" b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11Bus\r\n" +
+	" Fa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==\r\n"
+
+const rfc8463Keys = `; keys of RFC 8463
+brisbane._domainkey.football.example.com. IN TXT "v=DKIM1; k=ed25519; " "p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+`
+
+func TestDKIMVerify(t *testing.T) {
+	keys, err := dkim.LoadKeys(strings.NewReader(rfc8463Keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &dkim.VerifyOptions{Lookup: keys}
+
+	results, err := dkim.Verify([]byte(rfc8463Signature+rfc8463Message), opts)
+	assert.Nil(t, err)
+	assert.Equal(t, len(results), 1)
+	v := results[0]
+	assert.Equal(t, v.Result, dkim.Pass, v.Err)
+	assert.Equal(t, v.Domain, "football.example.com")
+	assert.Equal(t, v.Selector, "brisbane")
+	assert.Equal(t, v.Algorithm, "ed25519-sha256")
+	assert.Equal(t, v.HeaderCanonicalization, dkim.Relaxed)
+	assert.Equal(t, v.Headers, []string{"from", "to", "subject", "date", "message-id", "from", "subject", "date"})
+	assert.True(t, v.BodyHashMatch)
+
+	// a parsed message with bare LF line breaks
+	lf := strings.ReplaceAll(rfc8463Signature+rfc8463Message, "\r\n", "\n")
+	m, err := eml.ParseMessage(strings.NewReader(lf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, _ = dkim.VerifyMessage(m, opts)
+	assert.Equal(t, results[0].Result, dkim.Pass, results[0].Err)
+
+	// the body changed
+	results, _ = dkim.Verify([]byte(rfc8463Signature+rfc8463Message+"P.S.\r\n"), opts)
+	assert.Equal(t, results[0].Result, dkim.Fail)
+	assert.Equal(t, results[0].Err, dkim.ErrBodyHash)
+
+	// an oversigned field added
+	results, _ = dkim.Verify([]byte(rfc8463Signature+"Subject: Win!\r\n"+rfc8463Message), opts)
+	assert.Equal(t, results[0].Result, dkim.Fail)
+	assert.Equal(t, results[0].Err, dkim.ErrSignature)
+	assert.True(t, results[0].BodyHashMatch)
+
+	// the header alone, as in MSG transport headers
+	header := rfc8463Signature + rfc8463Message[:strings.Index(rfc8463Message, "\r\n\r\n")]
+	results, _ = dkim.VerifyHeader([]byte(header), nil, opts)
+	assert.Equal(t, results[0].Result, dkim.Neutral)
+	assert.Equal(t, results[0].Err, dkim.ErrBodyUnavailable)
+
+	// no key
+	results, _ = dkim.Verify([]byte(rfc8463Signature+rfc8463Message), &dkim.VerifyOptions{Lookup: dkim.Keys{}})
+	assert.Equal(t, results[0].Result, dkim.PermError)
+	assert.Equal(t, results[0].Err, dkim.ErrKeyNotFound)
+
+	results, _ = dkim.Verify([]byte(rfc8463Message), opts)
+	assert.Empty(t, results)
+}
+
+func TestDKIMVerifySignatureFirst(t *testing.T) {
+	keys, err := dkim.LoadKeys(strings.NewReader(rfc8463Keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// b= as the first tag, signed over the relaxed header
+	field := "DKIM-Signature: b=; v=1; a=ed25519-sha256; c=relaxed/relaxed; d=football.example.com; s=brisbane; h=from:subject; bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8="
+	signed := "from:Joe SixPack <joe@football.example.com>\r\n" +
+		"subject:Is dinner ready?\r\n" +
+		"dkim-signature:" + field[len("DKIM-Signature: "):]
+	sum := sha256.Sum256([]byte(signed))
+	b := base64.StdEncoding.EncodeToString(ed25519.Sign(rfc8463Key(t), sum[:]))
+	field = strings.Replace(field, "b=;", "b="+b+";", 1)
+
+	results, err := dkim.Verify([]byte(field+"\r\n"+rfc8463Message), &dkim.VerifyOptions{Lookup: keys})
+	assert.Nil(t, err)
+	if assert.Equal(t, len(results), 1) {
+		assert.Equal(t, results[0].Result, dkim.Pass, results[0].Err)
+	}
+}
+
+func TestDKIMSignVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := dkim.Keys{"mail._domainkey.example.com": {"v=DKIM1; p=" + base64.StdEncoding.EncodeToString(der)}}
+
+	m, err := eml.NewBuilder().From("alice@example.com").To("bob@example.com").Subject("Réunion").Text([]byte("hello  \n\n\n")).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []dkim.Canonicalization{dkim.Simple, dkim.Relaxed} {
+		signed, err := dkim.SignMessage(m, &dkim.SignOptions{
+			Domain:                 "example.com",
+			Selector:               "mail",
+			Signer:                 rsaKey,
+			HeaderCanonicalization: c,
+			BodyCanonicalization:   c,
+			Expiration:             time.Hour,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, _ := dkim.Verify(signed, &dkim.VerifyOptions{Lookup: keys})
+		assert.Equal(t, results[0].Result, dkim.Pass, results[0].Err)
+		assert.Equal(t, results[0].Algorithm, "rsa-sha256")
+
+		results, _ = dkim.Verify(signed, &dkim.VerifyOptions{Lookup: keys, Time: time.Now().Add(2 * time.Hour)})
+		assert.Equal(t, results[0].Result, dkim.PermError)
+		assert.Equal(t, results[0].Err, dkim.ErrExpired)
+	}
+}
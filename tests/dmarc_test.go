@@ -0,0 +1,116 @@
+package test
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/mel2oo/mailfile"
+	"github.com/mel2oo/mailfile/dkim"
+	"github.com/mel2oo/mailfile/dmarc"
+	"github.com/mel2oo/mailfile/spf"
+	"github.com/stretchr/testify/assert"
+)
+
+const dmarcZone = `
+_dmarc.example.com.  TXT "v=DMARC1; p=reject; sp=quarantine; rua=mailto:dmarc@example.com"
+_dmarc.strict.org.   TXT "v=DMARC1; p=quarantine; adkim=s; aspf=s; pct=50"
+_dmarc.bad.org.      TXT "v=DMARC1; p=always"
+_dmarc.twice.org.    TXT "v=DMARC1; p=reject"
+_dmarc.twice.org.    TXT "v=DMARC1; p=none"
+`
+
+func TestDMARCOrganizationalDomain(t *testing.T) {
+	cases := map[string]string{
+		"example.com":               "example.com",
+		"mail.example.com":          "example.com",
+		"a.b.example.co.uk":         "example.co.uk",
+		"news.sinochem.com.cn":      "sinochem.com.cn",
+		"user.github.io":            "user.github.io",
+		"www.ck":                    "www.ck",
+		"a.b.ck":                    "a.b.ck",
+		"co.uk":                     "",
+		"host.unlisted-tld":         "host.unlisted-tld",
+		"MAIL.Example.COM.":         "example.com",
+		"x.y.compute.amazonaws.com": "x.y.compute.amazonaws.com",
+		"victim.com.ng":             "victim.com.ng",
+		"shop.example.com.pk":       "example.com.pk",
+		"mail.bank.co.ke":           "bank.co.ke",
+		"com.ng":                    "",
+	}
+	for domain, org := range cases {
+		assert.Equal(t, org, dmarc.PublicSuffixes.OrganizationalDomain(domain), domain)
+	}
+}
+
+func TestDMARCEvaluate(t *testing.T) {
+	zone, err := spf.ParseZone(strings.NewReader(dmarcZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &dmarc.Options{Lookup: zone}
+	spfPass := func(sender string) *spf.Outcome {
+		return &spf.Outcome{Result: spf.Pass, Sender: sender}
+	}
+	dkimPass := func(domain string) []*dkim.Verification {
+		return []*dkim.Verification{{Result: dkim.Pass, Domain: domain}}
+	}
+
+	// relaxed SPF alignment of a subdomain
+	e := dmarc.Evaluate("news.example.com", spfPass("bounce@mail.example.com"), nil, opts)
+	assert.Equal(t, dmarc.Pass, e.Result)
+	assert.True(t, e.SPFAligned)
+	assert.Equal(t, "example.com", e.RecordDomain)
+	assert.Equal(t, dmarc.Quarantine, e.Policy)
+	assert.Equal(t, dmarc.PolicyNone, e.Disposition)
+	assert.Contains(t, e.Reasons, "SPF pass for mail.example.com is aligned with From domain news.example.com (relaxed)")
+
+	// neither aligns
+	e = dmarc.Evaluate("user@example.com", spfPass("bounce@esp.example.net"), dkimPass("esp.example.net"), opts)
+	assert.Equal(t, dmarc.Fail, e.Result)
+	assert.Equal(t, dmarc.Reject, e.Disposition)
+	assert.Contains(t, e.Reasons, "DKIM signature d=esp.example.net is not aligned with From domain example.com (relaxed, the organizational domains differ)")
+
+	// DKIM alignment alone is enough
+	e = dmarc.Evaluate("user@example.com", &spf.Outcome{Result: spf.Fail, Sender: "user@example.com"}, dkimPass("example.com"), opts)
+	assert.Equal(t, dmarc.Pass, e.Result)
+	assert.False(t, e.SPFAligned)
+	assert.True(t, e.DKIMAligned)
+
+	// strict alignment
+	e = dmarc.Evaluate("strict.org", spfPass("bounce@mail.strict.org"), dkimPass("strict.org"), opts)
+	assert.Equal(t, dmarc.Pass, e.Result)
+	assert.False(t, e.SPFAligned)
+	assert.Contains(t, e.Reasons, "SPF pass for mail.strict.org is not aligned with From domain strict.org (strict, the domains differ)")
+	e = dmarc.Evaluate("strict.org", nil, nil, opts)
+	assert.Equal(t, dmarc.Fail, e.Result)
+	assert.Contains(t, e.Reasons, "policy quarantine applies to 50% of failing messages")
+
+	e = dmarc.Evaluate("nopolicy.net", spfPass("user@nopolicy.net"), nil, opts)
+	assert.Equal(t, dmarc.None, e.Result)
+	e = dmarc.Evaluate("twice.org", nil, nil, opts)
+	assert.Equal(t, dmarc.None, e.Result)
+	e = dmarc.Evaluate("bad.org", nil, nil, opts)
+	assert.Equal(t, dmarc.PermError, e.Result)
+}
+
+func TestDMARCEvaluateMessage(t *testing.T) {
+	zone, err := spf.ParseZone(strings.NewReader(dmarcZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &mailfile.Message{From: []*mail.Address{{Address: "user@example.com"}}}
+	e := dmarc.EvaluateMessage(msg, nil, []*dkim.Verification{{Result: dkim.Pass, Domain: "example.com"}}, &dmarc.Options{Lookup: zone})
+	assert.Equal(t, dmarc.Pass, e.Result)
+	if assert.Len(t, msg.Auth, 1) {
+		assert.Equal(t, "dmarc", msg.Auth[0].Method)
+		assert.Equal(t, "pass", msg.Auth[0].Result)
+		assert.Equal(t, "example.com", msg.Auth[0].Properties["header.from"])
+		assert.Equal(t, "reject", msg.Auth[0].Properties["policy.dmarc"])
+	}
+
+	msg = &mailfile.Message{From: []*mail.Address{{Address: "a@example.com"}, {Address: "b@example.org"}}}
+	e = dmarc.EvaluateMessage(msg, nil, nil, &dmarc.Options{Lookup: zone})
+	assert.Equal(t, dmarc.PermError, e.Result)
+	assert.Equal(t, dmarc.ErrNoFrom, e.Err)
+}
@@ -0,0 +1,108 @@
+package test
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mel2oo/mailfile"
+	"github.com/mel2oo/mailfile/emlx"
+	"github.com/stretchr/testify/assert"
+)
+
+const emlxPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>date-received</key>
+	<integer>1667000000</integer>
+	<key>date-sent</key>
+	<integer>1666999990</integer>
+	<key>flags</key>
+	<integer>1045</integer>
+	<key>remote-id</key>
+	<string>4242</string>
+</dict>
+</plist>
+`
+
+func writeEmlx(t *testing.T, path, message string) {
+	data := fmt.Sprintf("%d      \n%s%s", len(message), message, emlxPlist)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseEMLX(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "Messages", "1.emlx")
+	writeEmlx(t, file, maildirMessage)
+
+	m, err := emlx.New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, m.Metadata.DateReceived, time.Unix(1667000000, 0).UTC())
+	assert.Equal(t, m.Metadata.RemoteID, "4242")
+	assert.Equal(t, m.Metadata.AttachmentCount(), 1)
+
+	res := m.Format()
+	assert.Equal(t, res.Subject, "hello")
+	assert.Equal(t, res.Flags, []string{mailfile.FlagSeen, mailfile.FlagReplied, mailfile.FlagFlagged})
+}
+
+func TestParseEMLXLength(t *testing.T) {
+	// counts larger than the data are errors, not allocations
+	for _, data := range []string{"99999999999999999\nFrom: a@b\n\nhi", "1000\nFrom: a@b\n\nhi", "-1\n", "x\n"} {
+		_, err := emlx.Parse(strings.NewReader(data))
+		assert.NotNil(t, err, data)
+	}
+}
+
+func TestParsePartialEMLX(t *testing.T) {
+	message := strings.Join([]string{
+		"From: alice@example.com",
+		"Subject: report",
+		"Content-Type: multipart/mixed; boundary=XX",
+		"",
+		"--XX",
+		"Content-Type: text/plain",
+		"",
+		"see attached",
+		"--XX",
+		"Content-Type: application/pdf; name=report.pdf",
+		"Content-Disposition: attachment; filename=report.pdf",
+		"Content-Transfer-Encoding: base64",
+		"X-Apple-Content-Length: 9",
+		"",
+		"",
+		"--XX--",
+		"",
+	}, "\r\n")
+
+	root := t.TempDir()
+	file := filepath.Join(root, "Messages", "77.partial.emlx")
+	writeEmlx(t, file, message)
+	os.MkdirAll(filepath.Join(root, "Attachments", "77", "2"), 0755)
+	os.WriteFile(filepath.Join(root, "Attachments", "77", "2", "report.pdf"), []byte("%PDF-1.4\n"), 0644)
+
+	m, err := emlx.New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, m.Partial)
+
+	res := m.Format()
+	if assert.Equal(t, len(res.Attachments), 1) {
+		assert.Equal(t, res.Attachments[0].Filename, "report.pdf")
+		data, _ := io.ReadAll(res.Attachments[0].Data)
+		assert.Equal(t, string(data), "%PDF-1.4\n")
+	}
+}
@@ -0,0 +1,55 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mel2oo/mailfile/eml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEMLFields(t *testing.T) {
+	header := strings.Join([]string{
+		"Received: from mx2.example.net (mx2.example.net [192.0.2.2])",
+		"\tby mx.example.com; Mon, 2 Jan 2023 10:00:02 +0000",
+		"Received: from client (unknown [198.51.100.7])",
+		"        by mx2.example.net; Mon, 2 Jan 2023 10:00:01 +0000",
+		"Subject: =?utf-8?B?5L2g5aW9?=",
+		"content-type: multipart/mixed; boundary=b",
+		"",
+		"",
+	}, "\r\n")
+	part := "Content-Type: text/plain\r\nX-Part: 1\r\n\r\n"
+	raw := header + "--b\r\n" + part + "hello\r\n--b--\r\n"
+
+	m, err := eml.ParseMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(m.Fields), 4)
+	assert.Equal(t, m.Fields[3].Name, "content-type")
+	assert.Equal(t, m.Fields.Values("Received"), []string{
+		"from mx2.example.net (mx2.example.net [192.0.2.2]) by mx.example.com; Mon, 2 Jan 2023 10:00:02 +0000",
+		"from client (unknown [198.51.100.7]) by mx2.example.net; Mon, 2 Jan 2023 10:00:01 +0000",
+	})
+	assert.Equal(t, m.Fields.Get("Subject"), "你好")
+	assert.Equal(t, string(m.Fields[2].Raw), "Subject: =?utf-8?B?5L2g5aW9?=\r\n")
+
+	data, err := m.Fields.Bytes()
+	assert.Nil(t, err)
+	assert.Equal(t, string(data)+"\r\n", header)
+
+	partData, err := m.Parts[0].Fields.Bytes()
+	assert.Nil(t, err)
+	assert.Equal(t, string(partData)+"\r\n", part)
+	assert.Equal(t, string(m.Parts[0].Body), "hello")
+
+	m.Fields.Set("Subject", "changed")
+	m.Fields.Add("X-Tag", "1")
+	m.Fields.Del("Received")
+	assert.Equal(t, len(m.Fields), 3)
+	assert.Nil(t, m.Fields[0].Raw)
+	assert.Equal(t, m.Fields.Header().Get("Subject"), "changed")
+	assert.Equal(t, m.Fields.Get("x-tag"), "1")
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mel2oo/mailfile/analyze"
+	"github.com/mel2oo/mailfile/eml"
+	"github.com/mel2oo/mailfile/msg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprintGmail(t *testing.T) {
+	m, err := eml.ParseMessage(strings.NewReader("MIME-Version: 1.0\r\n" +
+		"X-Gm-Message-State: ACrzQf1M4WgSuKM1lgjDuXQi5HPYLr3v7\r\n" +
+		"From: Alice <alice@gmail.com>\r\n" +
+		"Date: Mon, 31 Oct 2022 16:12:19 +0800\r\n" +
+		"Message-ID: <CALY8omuS6YkAq_e4JPd5OO-aBcO=uc5SEOj4b2GHRqsSOZXamg@mail.gmail.com>\r\n" +
+		"Subject: Hello\r\n" +
+		"To: bob@example.com\r\n" +
+		"Content-Type: multipart/alternative; boundary=\"000000000000a1b2c3d405ec3b1e\"\r\n" +
+		"\r\n" +
+		"--000000000000a1b2c3d405ec3b1e\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Hello\r\n" +
+		"--000000000000a1b2c3d405ec3b1e--\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprints := analyze.Fingerprints(m.Format())
+	if assert.NotEmpty(t, fingerprints) {
+		assert.Equal(t, "Gmail", fingerprints[0].Name)
+		assert.Equal(t, analyze.CategoryWebmail, fingerprints[0].Category)
+		assert.Equal(t, 7, fingerprints[0].Score)
+		assert.Equal(t, analyze.Clue{Field: "boundary", Value: "000000000000a1b2c3d405ec3b1e"}, fingerprints[0].Evidence[1])
+		assert.Equal(t, "header-order", fingerprints[0].Evidence[3].Field)
+	}
+}
+
+func TestFingerprintMismatch(t *testing.T) {
+	m, err := eml.ParseMessage(strings.NewReader("From: billing@example.com\r\n" +
+		"Subject: Invoice\r\n" +
+		"X-Mailer: Microsoft Outlook 16.0\r\n" +
+		"Message-ID: <TtCY6aL8wBwLt2U9gWZPpH1Sq4dJ0N2nd8T8hkhEw@example.com>\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b1_TtCY6aL8wBwLt2U9gWZPpH1Sq4dJ0N2nd8T8hkhEw\"\r\n" +
+		"\r\n" +
+		"--b1_TtCY6aL8wBwLt2U9gWZPpH1Sq4dJ0N2nd8T8hkhEw\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Hello\r\n" +
+		"--b1_TtCY6aL8wBwLt2U9gWZPpH1Sq4dJ0N2nd8T8hkhEw--\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprints := analyze.Fingerprints(m.Format())
+	if assert.Len(t, fingerprints, 2) {
+		assert.Equal(t, "Microsoft Outlook", fingerprints[0].Name)
+		assert.Equal(t, "16.0", fingerprints[0].Version)
+		assert.True(t, fingerprints[0].Claimed())
+		assert.Equal(t, "PHPMailer", fingerprints[1].Name)
+		assert.False(t, fingerprints[1].Claimed())
+	}
+
+	codes := findingCodes(analyze.Message(m.Format(), nil))
+	mismatch := codes[analyze.CodeMailerMismatch]
+	assert.Equal(t, analyze.High, mismatch.Severity)
+	assert.Equal(t, "Microsoft Outlook", mismatch.Evidence["claimed"])
+	assert.Equal(t, "PHPMailer", mismatch.Evidence["fingerprint"])
+	assert.Equal(t, "b1_TtCY6aL8wBwLt2U9gWZPpH1Sq4dJ0N2nd8T8hkhEw", mismatch.Evidence["boundary"])
+}
+
+func TestFingerprintPlatforms(t *testing.T) {
+	m, err := eml.ParseMessage(strings.NewReader("From: news@example.com\r\n" +
+		"X-Mailer: Leaf PHPMailer 2.7 (leafmailer.pw)\r\n" +
+		"Message-ID: <0100018431e5a2f0-3c4a0a2e-5b0e-4e1d-9b0a-6d5c0e8f1a2b-000000@email.amazonses.com>\r\n" +
+		"X-SES-Outgoing: 2022.11.01-54.240.8.1\r\n" +
+		"\r\n" +
+		"Hello\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprints := analyze.Fingerprints(m.Format())
+	if assert.Len(t, fingerprints, 2) {
+		assert.Equal(t, "Amazon SES", fingerprints[0].Name)
+		assert.Equal(t, 4, fingerprints[0].Score)
+		assert.Equal(t, analyze.CategoryPhishingKit, fingerprints[1].Category)
+	}
+	codes := findingCodes(analyze.Message(m.Format(), nil))
+	assert.Equal(t, "Leaf PHPMailer", codes[analyze.CodePhishingKit].Evidence["fingerprint"])
+	assert.NotContains(t, codes, analyze.CodeMailerMismatch)
+}
+
+func TestFingerprintTestdata(t *testing.T) {
+	m, err := eml.New("testdata/db84a1ca6bd634d671e39908bc3f3e0e.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprints := analyze.Fingerprints(m.Format())
+	if assert.NotEmpty(t, fingerprints) {
+		assert.Equal(t, "Microsoft Outlook", fingerprints[0].Name)
+		assert.Equal(t, "16.0", fingerprints[0].Version)
+	}
+
+	res, err := msg.New("testdata/0bb5983192375432403c74cf2d68ee67.msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprints = analyze.Fingerprints(res.Format())
+	if assert.NotEmpty(t, fingerprints) {
+		assert.Equal(t, "Mozilla Thunderbird", fingerprints[0].Name)
+		assert.Equal(t, "91.6.1", fingerprints[0].Version)
+		assert.Equal(t, 7, fingerprints[0].Score)
+	}
+}
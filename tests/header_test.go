@@ -0,0 +1,70 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mel2oo/mailfile"
+	"github.com/mel2oo/mailfile/eml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteHeader(t *testing.T) {
+	h := eml.NewHeader(`"Doe, John" <john@example.com>`, "Réunion 10h", "李雷 <li@example.com>", "bob@example.com")
+	h.Set("Message-Id", "<1234.5678@example.com>")
+	h.Set("Content-Type", `text/plain; charset="utf-8"`)
+	h.Set("X-Note", "plain =?utf-8?Q?not_a_word?=")
+	h.Set("Received", "from mx.example.net (mx.example.net [192.0.2.1]) by mx.example.com with ESMTPS id 4AbCdEf; Mon, 2 Jan 2023 10:00:00 +0000")
+
+	data, err := h.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\r\n"), "\r\n")
+	for _, line := range lines {
+		assert.LessOrEqual(t, len(line), 78, line)
+	}
+	text := string(data)
+	assert.Contains(t, text, "From: \"Doe, John\" <john@example.com>\r\n")
+	assert.Contains(t, text, "X-Note: plain =?UTF-8?b?PT91dGYtOD9RP25vdF9hX3dvcmQ/PQ==?=\r\n")
+	assert.Contains(t, text, "Message-Id: <1234.5678@example.com>\r\n")
+	assert.Contains(t, text, "Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	assert.Contains(t, text, "Subject: =?UTF-8?q?R=C3=A9union?= 10h\r\n")
+	assert.Contains(t, text, "To: =?UTF-8?b?5p2O6Zu3?= <li@example.com>, <bob@example.com>\r\n")
+	assert.Contains(t, text, "Received: from mx.example.net (mx.example.net [192.0.2.1]) by mx.example.com\r\n with ESMTPS")
+
+	// the reader gets back the values written
+	m, err := eml.ParseMessage(strings.NewReader(text + "\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, m.Header.Subject(), "Réunion 10h")
+	assert.Equal(t, m.Header.Get("X-Note"), "plain =?utf-8?Q?not_a_word?=")
+	addrs, _ := mailfile.ParseAddressList(m.Header.Get("To"))
+	assert.Equal(t, addrs[0].Name, "李雷")
+	assert.Equal(t, m.Header.Get("Received"), h.Get("Received"))
+}
+
+func TestWriteHeaderGroup(t *testing.T) {
+	h := eml.Header{}
+	h.Set("To", "Équipe: a@example.com, Zoë <b@example.com>;, c@example.com")
+	h.Set("Cc", `"Équipe 2":;`)
+
+	data, err := h.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	assert.Contains(t, text, "To: =?UTF-8?q?=C3=89quipe?=: <a@example.com>, =?UTF-8?q?Zo=C3=AB?=\r\n <b@example.com>;, <c@example.com>\r\n")
+	assert.Contains(t, text, "Cc: =?UTF-8?b?w4lxdWlwZSAy?=:;\r\n")
+
+	m, err := eml.ParseMessage(strings.NewReader(text + "\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, strings.HasPrefix(m.Header.Get("To"), "=?UTF-8?q?=C3=89quipe?=:"))
+	addrs, _ := mailfile.ParseAddressList(m.Header.Get("To"))
+	if assert.Equal(t, len(addrs), 3) {
+		assert.Equal(t, addrs[1].Name, "Zoë")
+	}
+}
@@ -0,0 +1,82 @@
+package test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mel2oo/mailfile/analyze"
+	"github.com/mel2oo/mailfile/eml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookalikeDomain(t *testing.T) {
+	opts := &analyze.Options{Protected: []string{"paypal.com", "apple.com"}, Brands: []string{"Microsoft"}}
+
+	for domain, technique := range map[string]string{
+		"pаypal.com":                 analyze.TechniqueHomograph,
+		"xn--pypal-4ve.com":          analyze.TechniqueHomograph,
+		"xn--80ak6aa92e.com":         analyze.TechniqueHomograph,
+		"paypa1.com":                 analyze.TechniqueConfusable,
+		"PAYPAL.co":                  analyze.TechniqueTLDSwap,
+		"paypal.com.ng":              analyze.TechniqueTLDSwap,
+		"paypal.com.evil.example":    analyze.TechniqueSubdomain,
+		"paypal-com.login.example":   analyze.TechniqueSubdomain,
+		"paypak.com":                 analyze.TechniqueKeyboardTypo,
+		"pyapal.com":                 analyze.TechniqueEditDistance,
+		"paypal-secure.example":      analyze.TechniqueBrand,
+		"login.micros0ft-online.net": analyze.TechniqueBrand,
+	} {
+		l := analyze.LookalikeDomain(domain, opts)
+		if assert.NotNil(t, l, domain) {
+			assert.Equal(t, technique, l.Technique, domain)
+		}
+	}
+
+	l := analyze.LookalikeDomain("xn--pypal-4ve.com", opts)
+	assert.Equal(t, "pаypal.com", l.Unicode)
+	assert.Equal(t, "paypal.com", l.Protected)
+
+	for _, domain := range []string{"paypal.com", "www.paypal.com", "example.com", "pineapple.org", "192.0.2.1"} {
+		assert.Nil(t, analyze.LookalikeDomain(domain, opts), domain)
+	}
+	assert.Nil(t, analyze.LookalikeDomain("paypa1.com", nil))
+
+	assert.Equal(t, "paypal", analyze.Skeleton("РАУРАL"))
+	assert.Equal(t, "microsoft", analyze.Skeleton("rnicrosoft"))
+}
+
+func TestLookalikes(t *testing.T) {
+	m, err := eml.ParseMessage(strings.NewReader("From: PayPal <service@paypa1.com>\r\n" +
+		"Reply-To: help@paypal.com\r\n" +
+		"Subject: Account\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		"<a href=\"https://www.paypal.com/signin\">Sign in</a> or " +
+		"<a href=\"http://paypal.com.verify.example/login?id=1\">verify</a>\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := m.Format()
+
+	opts := &analyze.Options{Protected: []string{"paypal.com"}}
+	lookalikes := analyze.Lookalikes(msg, opts)
+	if assert.Len(t, lookalikes, 2) {
+		assert.Equal(t, "from", lookalikes[0].Source)
+		assert.Equal(t, analyze.TechniqueConfusable, lookalikes[0].Technique)
+		assert.Equal(t, "url", lookalikes[1].Source)
+		assert.Equal(t, "http://paypal.com.verify.example/login?id=1", lookalikes[1].Value)
+		assert.Equal(t, analyze.TechniqueSubdomain, lookalikes[1].Technique)
+	}
+
+	codes := findingCodes(analyze.Message(msg, opts))
+	assert.Equal(t, analyze.High, codes[analyze.CodeLookalikeDomain].Severity)
+	assert.Empty(t, analyze.Lookalikes(msg, nil))
+
+	// the html body, also read as the text one, is left to be read
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(body), "Sign in")
+}
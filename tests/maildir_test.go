@@ -0,0 +1,81 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mel2oo/mailfile"
+	"github.com/mel2oo/mailfile/maildir"
+	"github.com/stretchr/testify/assert"
+)
+
+const maildirMessage = "From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.com\r\n" +
+	"Subject: hello\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"hi bob\r\n"
+
+func writeMailFile(t *testing.T, path string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(maildirMessage), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaildirFilename(t *testing.T) {
+	delivered, size, flags := maildir.ParseFilename("1204680122.M20191P13011.mail,S=1234,W=1260:2,RST")
+	assert.Equal(t, delivered, time.Unix(1204680122, 20191000).UTC())
+	assert.Equal(t, size, int64(1234))
+	assert.Equal(t, flags, []string{mailfile.FlagReplied, mailfile.FlagSeen, mailfile.FlagTrashed})
+}
+
+func TestMaildirWalk(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"cur", "new", "tmp", ".Sent/cur", ".Sent/new", ".Sent/tmp", ".Work.Projects/cur", ".Work.Projects/new", ".Work.Projects/tmp"} {
+		os.MkdirAll(filepath.Join(root, dir), 0755)
+	}
+	writeMailFile(t, filepath.Join(root, "cur", "1204680122.P1.mail:2,FS"))
+	writeMailFile(t, filepath.Join(root, "new", "1204680123.P2.mail"))
+	writeMailFile(t, filepath.Join(root, ".Sent", "cur", "1204680124.P3.mail:2,S"))
+	writeMailFile(t, filepath.Join(root, ".Work.Projects", "cur", "1204680125.P4.mail:2,D"))
+
+	folders := make(map[string][]string)
+	err := maildir.Walk(root, func(entry *maildir.Entry, msg *mailfile.Message, err error) error {
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, msg.Subject, "hello")
+		folders[msg.Folder] = append(folders[msg.Folder], msg.Flags...)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, folders["INBOX"], []string{mailfile.FlagRecent, mailfile.FlagFlagged, mailfile.FlagSeen})
+	assert.Equal(t, folders["Sent"], []string{mailfile.FlagSeen})
+	assert.Equal(t, folders["Work/Projects"], []string{mailfile.FlagDraft})
+}
+
+func TestMHWalk(t *testing.T) {
+	root := t.TempDir()
+	writeMailFile(t, filepath.Join(root, "1"))
+	writeMailFile(t, filepath.Join(root, "2"))
+	writeMailFile(t, filepath.Join(root, "archive", "1"))
+	os.WriteFile(filepath.Join(root, ".mh_sequences"), []byte("unseen: 2\nreplied: 1-2\n"), 0644)
+
+	flags := make(map[string][]string)
+	err := maildir.Walk(root, func(entry *maildir.Entry, msg *mailfile.Message, err error) error {
+		if err != nil {
+			return err
+		}
+		flags[msg.Folder+"/"+filepath.Base(entry.Path)] = msg.Flags
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, flags["INBOX/1"], []string{mailfile.FlagSeen, mailfile.FlagReplied})
+	assert.Equal(t, flags["INBOX/2"], []string{mailfile.FlagReplied})
+	assert.Equal(t, flags["archive/1"], []string{mailfile.FlagSeen})
+}
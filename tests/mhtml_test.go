@@ -0,0 +1,92 @@
+package test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mel2oo/mailfile/eml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMHTML(t *testing.T) {
+	archive := strings.Join([]string{
+		"From: <Saved by Blink>",
+		"Subject: login",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/related; type="text/html"; start="<root@mhtml>"; boundary="----MultipartBoundary--abc"`,
+		"",
+		"------MultipartBoundary--abc",
+		"Content-Type: image/png",
+		"Content-Transfer-Encoding: base64",
+		"Content-Location: https://login.example.com/static/logo.png",
+		"",
+		"iVBORw0KGgo=",
+		"------MultipartBoundary--abc",
+		"Content-Type: text/html",
+		"Content-ID: <root@mhtml>",
+		"Content-Location: https://login.example.com/index.html",
+		"",
+		`<html><img src="static/logo.png"><link href="cid:style@mhtml"></html>`,
+		"------MultipartBoundary--abc",
+		"Content-Type: text/css",
+		"Content-ID: <style@mhtml>",
+		"",
+		"body {}",
+		"------MultipartBoundary--abc--",
+		"",
+	}, "\r\n")
+
+	m, err := eml.ParseMHTML(strings.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, string(m.Html), `<img src="static/logo.png">`)
+	assert.Equal(t, m.Base, "https://login.example.com/index.html")
+	assert.Equal(t, len(m.Resources), 2)
+
+	logo := m.Resolve("static/logo.png")
+	if assert.NotNil(t, logo) {
+		assert.Equal(t, logo.ContentType, "image/png")
+		assert.Equal(t, logo.Data(), []byte("\x89PNG\r\n\x1a\n"))
+	}
+
+	style := m.Resolve("cid:style@mhtml")
+	if assert.NotNil(t, style) {
+		assert.Equal(t, string(style.Data()), "body {}")
+	}
+
+	res := m.Format()
+	assert.Equal(t, len(res.Embeddeds), 2)
+	assert.Equal(t, res.Embeddeds[0].Location, "https://login.example.com/static/logo.png")
+}
+
+func TestParseMHTMLCharset(t *testing.T) {
+	// windows-1251 declared by the part, then by a meta tag
+	for _, header := range []string{"Content-Type: text/html; charset=windows-1251", "Content-Type: text/html"} {
+		archive := strings.Join([]string{
+			"Subject: saved",
+			`Content-Type: multipart/related; type="text/html"; boundary="b"`,
+			"",
+			"--b",
+			header,
+			"",
+			"<html><meta charset=\"windows-1251\"><p>\xcf\xf0\xe8\xe2\xe5\xf2</p></html>",
+			"--b--",
+			"",
+		}, "\r\n")
+
+		m, err := eml.ParseMHTML(strings.NewReader(archive))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Contains(t, string(m.Html), "<p>Привет</p>", header)
+
+		body, err := io.ReadAll(m.Format().Html)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Contains(t, string(body), "<p>Привет</p>", header)
+	}
+}
@@ -48,7 +48,7 @@ func TestParseMSG3(t *testing.T) {
 	}
 
 	res := msg.Format()
-	assert.Equal(t, res.SenderAddress, "127.0.0.1")
+	assert.Equal(t, res.SenderAddress, "54.95.196.254")
 	assert.Equal(t, res.Attachments[0].Filename, "▶🔘─────.htm")
 }
 
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/mel2oo/mailfile"
+	"github.com/mel2oo/mailfile/olm"
+	"github.com/stretchr/testify/assert"
+)
+
+const olmMessage = `<?xml version="1.0" encoding="UTF-8"?>
+<emails>
+<email>
+<OPFMessageCopySentTime>2022-10-28T07:33:05</OPFMessageCopySentTime>
+<OPFMessageCopySubject xml:space="preserve">Invoice &amp; payment</OPFMessageCopySubject>
+<OPFMessageCopyMessageID>&lt;1234@example.com&gt;</OPFMessageCopyMessageID>
+<OPFMessageCopyFromAddresses><emailAddress OPFContactEmailAddressAddress="alice@example.com" OPFContactEmailAddressName="Alice" OPFContactEmailAddressType="0"/></OPFMessageCopyFromAddresses>
+<OPFMessageCopyToAddresses><emailAddress OPFContactEmailAddressAddress="bob@example.com" OPFContactEmailAddressName="bob@example.com" OPFContactEmailAddressType="0"/><emailAddress OPFContactEmailAddressAddress="carol@example.com" OPFContactEmailAddressName="Carol" OPFContactEmailAddressType="0"/></OPFMessageCopyToAddresses>
+<OPFMessageCopyBody xml:space="preserve">&lt;html&gt;&lt;body&gt;password: Secret123&lt;/body&gt;&lt;/html&gt;</OPFMessageCopyBody>
+<OPFMessageGetIsRead>1</OPFMessageGetIsRead>
+<OPFMessageCopyCategoryList><category OPFCategoryCopyName="Finance" OPFCategoryCopyBackgroundColor="#FF0000"/></OPFMessageCopyCategoryList>
+<OPFMessageCopyAttachmentList><messageAttachment OPFAttachmentContentExtension="pdf" OPFAttachmentContentFileSize="9" OPFAttachmentContentType="application/pdf" OPFAttachmentName="invoice.pdf" OPFAttachmentURL="Accounts/alice@example.com/com.microsoft.__Messages/Inbox/Billing/com.microsoft.__Attachments/invoice.pdf"/></OPFMessageCopyAttachmentList>
+</email>
+</emails>
+`
+
+// olmArchive returns an archive of the given files.
+func olmArchive(t *testing.T, files map[string]string) *olm.Archive {
+	buffer := &bytes.Buffer{}
+	zw := zip.NewWriter(buffer)
+	for name, data := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(data))
+	}
+	zw.Close()
+
+	archive, err := olm.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+func TestParseOLM(t *testing.T) {
+	archive := olmArchive(t, map[string]string{
+		"Accounts/alice@example.com/com.microsoft.__Messages/Inbox/Billing/message_00000.xml":                       olmMessage,
+		"Accounts/alice@example.com/com.microsoft.__Messages/Inbox/Billing/com.microsoft.__Attachments/invoice.pdf": "%PDF-1.4\n",
+	})
+
+	var msgs []*mailfile.Message
+	var entries []*olm.Entry
+	err := archive.Walk(func(entry *olm.Entry, msg *mailfile.Message, err error) error {
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		msgs = append(msgs, msg)
+		return nil
+	})
+	assert.Nil(t, err)
+	if !assert.Equal(t, len(msgs), 1) {
+		return
+	}
+
+	res := msgs[0]
+	assert.Equal(t, entries[0].Account, "alice@example.com")
+	assert.Equal(t, res.Folder, "Inbox/Billing")
+	assert.Equal(t, res.Subject, "Invoice & payment")
+	assert.Equal(t, res.MessageID, "<1234@example.com>")
+	assert.Equal(t, res.Date, "Fri, 28 Oct 2022 07:33:05 +0000")
+	assert.Equal(t, res.From[0].Name, "Alice")
+	assert.Equal(t, len(res.To), 2)
+	assert.Equal(t, res.To[0].Name, "")
+	assert.Equal(t, res.Categories, []string{"Finance"})
+	assert.Equal(t, res.Flags, []string{mailfile.FlagSeen})
+	assert.Equal(t, res.Pwd, []string{"Secret123"})
+
+	if assert.Equal(t, len(res.Attachments), 1) {
+		data, _ := io.ReadAll(res.Attachments[0].Data)
+		assert.Equal(t, string(data), "%PDF-1.4\n")
+	}
+}
+
+func TestParseOLMCharset(t *testing.T) {
+	message := func(encoding string) string {
+		return `<?xml version="1.0" encoding="` + encoding + `"?>` +
+			"<emails><email><OPFMessageCopySubject>Caf\xe9 &amp; cr\xe8me</OPFMessageCopySubject></email></emails>"
+	}
+
+	archive := olmArchive(t, map[string]string{
+		"Accounts/a/com.microsoft.__Messages/Inbox/message_00000.xml": message("windows-1252"),
+	})
+	var subjects []string
+	err := archive.Walk(func(entry *olm.Entry, msg *mailfile.Message, err error) error {
+		if err != nil {
+			return err
+		}
+		subjects = append(subjects, msg.Subject)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, subjects, []string{"Café & crème"})
+
+	// an unknown encoding is an error, not UTF-8
+	archive = olmArchive(t, map[string]string{
+		"Accounts/a/com.microsoft.__Messages/Inbox/message_00000.xml": message("x-unknown"),
+	})
+	err = archive.Walk(func(entry *olm.Entry, msg *mailfile.Message, err error) error {
+		return err
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,122 @@
+package test
+
+import (
+	"net/mail"
+	"testing"
+	"time"
+
+	"github.com/mel2oo/mailfile"
+	"github.com/mel2oo/mailfile/eml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReceived(t *testing.T) {
+	// Postfix
+	hop := mailfile.ParseReceived("from mail.example.com (mail.example.com [192.0.2.1])\r\n" +
+		"\t(using TLSv1.3 with cipher TLS_AES_256_GCM_SHA384 (256/256 bits))\r\n" +
+		"\t(No client certificate requested)\r\n" +
+		"\tby mx.example.net (Postfix) with ESMTPS id 4AB12C0FFEE\r\n" +
+		"\tfor <user@example.net>; Fri, 28 Oct 2022 03:57:37 +0900 (JST)")
+	assert.Equal(t, "mail.example.com", hop.Helo)
+	assert.Equal(t, "mail.example.com", hop.FromHost)
+	assert.Equal(t, "192.0.2.1", hop.FromIP)
+	assert.Equal(t, "mx.example.net", hop.By)
+	assert.Equal(t, "ESMTPS", hop.With)
+	assert.Equal(t, "using TLSv1.3 with cipher TLS_AES_256_GCM_SHA384 (256/256 bits)", hop.TLS)
+	assert.Equal(t, "4AB12C0FFEE", hop.ID)
+	assert.Equal(t, "user@example.net", hop.For)
+	assert.Equal(t, time.Date(2022, 10, 27, 18, 57, 37, 0, time.UTC), hop.Date.UTC())
+
+	// Exchange, IPv6
+	hop = mailfile.ParseReceived("from DM6NAM12FT062.eop-nam12.prod.protection.outlook.com (2603:10b6:8:2e:cafe::2b) " +
+		"by DS7P222CA0006.outlook.office365.com (2603:10b6:8:2e::23) with Microsoft SMTP Server " +
+		"(version=TLS1_2, cipher=TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384) id 15.20.5769.19 via Frontend Transport; " +
+		"Mon, 31 Oct 2022 16:12:19 +0000")
+	assert.Equal(t, "2603:10b6:8:2e:cafe::2b", hop.FromIP)
+	assert.Equal(t, "DS7P222CA0006.outlook.office365.com", hop.By)
+	assert.Equal(t, "Microsoft", hop.With)
+	assert.Equal(t, "version=TLS1_2, cipher=TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", hop.TLS)
+	assert.Equal(t, "15.20.5769.19", hop.ID)
+
+	// IronPort
+	hop = mailfile.ParseReceived("from fmkomailc1.emirates.net.ae (HELO afomail2.emirates.net.ae) ([5.195.192.169]) " +
+		"by esa2.hc2438-47.iphmx.com with ESMTP/TLS/ECDHE-RSA-AES128-GCM-SHA256; 31 Oct 2022 12:12:11 -0400")
+	assert.Equal(t, "afomail2.emirates.net.ae", hop.Helo)
+	assert.Equal(t, "fmkomailc1.emirates.net.ae", hop.FromHost)
+	assert.Equal(t, "5.195.192.169", hop.FromIP)
+	assert.Equal(t, "ESMTP", hop.With)
+	assert.Equal(t, "TLS/ECDHE-RSA-AES128-GCM-SHA256", hop.TLS)
+
+	// Exim, with an address literal
+	hop = mailfile.ParseReceived("from [198.51.100.7] (helo=client.example.org) by mx.example.com " +
+		"with esmtpsa (TLS1.2) tls TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 (Exim 4.92) " +
+		"(envelope-from <user@example.org>) id 1oABCD-0001xY-00; Mon, 31 Oct 2022 16:12:19 +0000")
+	assert.Equal(t, "client.example.org", hop.Helo)
+	assert.Equal(t, "198.51.100.7", hop.FromIP)
+	assert.Equal(t, "esmtpsa", hop.With)
+	assert.Equal(t, "TLS1.2 TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", hop.TLS)
+	assert.Equal(t, "1oABCD-0001xY-00", hop.ID)
+
+	// CommuniGate, the address literal declared in HELO is not the client
+	hop = mailfile.ParseReceived("from [93.125.114.11] (account user@example.by HELO [0.0.0.0]) " +
+		"by smail1.example.by (CommuniGate Pro SMTP 6.3.15) with ESMTPSA id 119883627 for user@example.ru; " +
+		"Mon, 03 Oct 2022 09:36:52 +0300")
+	assert.Equal(t, "[0.0.0.0]", hop.Helo)
+	assert.Equal(t, "93.125.114.11", hop.FromIP)
+}
+
+func TestParseTrace(t *testing.T) {
+	m, err := eml.New("testdata/db84a1ca6bd634d671e39908bc3f3e0e.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := m.Format().Headers
+
+	trace := mailfile.ParseTrace(headers)
+	if assert.Len(t, trace.Hops, 6) {
+		assert.Equal(t, "71.168.222.19", trace.Hops[0].FromIP)
+		assert.Equal(t, "afomail2.emirates.net.ae", trace.Hops[0].By)
+		assert.Equal(t, time.Duration(0), trace.Hops[0].Delay)
+		assert.Equal(t, 12*time.Second, trace.Hops[1].Delay)
+		assert.Equal(t, "::1", trace.Hops[5].FromIP)
+	}
+	assert.Equal(t, "71.168.222.19", trace.OriginatingIP)
+	assert.Equal(t, "Received", trace.OriginatingField)
+
+	// relays up to the Microsoft frontend are ours: the origin is the
+	// client that connected to it
+	trace = mailfile.ParseTrace(headers, "2603:10b6::/32", "10.0.0.0/8")
+	assert.Equal(t, "216.71.148.82", trace.OriginatingIP)
+	assert.Equal(t, "esa2.hc2438-47.iphmx.com", trace.Origin.Helo)
+
+	// private addresses are never the origin, webmail fields come first
+	trace = mailfile.ParseTrace(mail.Header{
+		"Received": {
+			"from webmail.example.com (webmail.example.com [203.0.113.5]) by mx.example.net with ESMTP; Mon, 31 Oct 2022 16:12:20 +0000",
+			"from [10.1.2.3] by webmail.example.com with HTTP; Mon, 31 Oct 2022 16:12:19 +0000",
+		},
+		"X-Originating-IP": {"[198.51.100.23]"},
+	})
+	assert.Equal(t, "198.51.100.23", trace.OriginatingIP)
+	assert.Equal(t, "X-Originating-IP", trace.OriginatingField)
+	assert.Equal(t, "203.0.113.5", trace.Origin.FromIP)
+	assert.Equal(t, time.Second, trace.Hops[1].Delay)
+
+	// webmail fields added outside the trusted relays are not taken
+	forged := mail.Header{
+		"Received": {
+			"from mail.evil.example (mail.evil.example [192.0.2.66]) by mx.example.net with ESMTP; Mon, 31 Oct 2022 16:12:20 +0000",
+			"from [10.1.2.3] by mail.evil.example with HTTP; Mon, 31 Oct 2022 16:12:19 +0000",
+		},
+		"X-Originating-IP": {"[198.51.100.23]"},
+	}
+	trace = mailfile.ParseTrace(forged, "203.0.113.0/24")
+	assert.Equal(t, "192.0.2.66", trace.OriginatingIP)
+	assert.Equal(t, "Received", trace.OriginatingField)
+
+	// and are when the message was submitted to a trusted relay
+	forged["Received"][0] = "from webmail.example.com (webmail.example.com [203.0.113.5]) by mx.example.net with ESMTP; Mon, 31 Oct 2022 16:12:20 +0000"
+	trace = mailfile.ParseTrace(forged, "203.0.113.0/24")
+	assert.Equal(t, "198.51.100.23", trace.OriginatingIP)
+	assert.Equal(t, "X-Originating-IP", trace.OriginatingField)
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mel2oo/mailfile"
+	"github.com/mel2oo/mailfile/eml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeHeader(t *testing.T) {
+	cases := map[string]string{
+		// whitespace between adjacent encoded-words is dropped, around text it is kept
+		"=?utf-8?Q?a?= =?utf-8?Q?b?=":         "ab",
+		"=?utf-8?Q?a?=\r\n =?utf-8?Q?b?= c":   "ab c",
+		"Re: =?utf-8?B?5L2g5aW9?= again":      "Re: 你好 again",
+		"=?utf-8?Q?a_b?=  =?utf-8?Q?_c?=":     "a b c",
+		"plain =?us-ascii?Q?text?=":           "plain text",
+		"=?ISO-8859-1?Q?Andr=E9?= Pirard":     "André Pirard",
+		"=?utf-8?Q?=E4=BD?==?utf-8?Q?=A0?=":   "你",
+		"=?gb2312?B?xOM=?= =?gb2312?B?usM=?=": "你好",
+		// the second character is split across two words
+		"=?utf-8?B?5L2g5Q==?= =?utf-8?B?pb0=?=": "你好",
+		// language tag, missing padding, truncated word, bad encoding
+		"=?utf-8*zh-CN?B?5L2g5aW9?=": "你好",
+		"=?utf-8?B?5L2g5aW9":         "你好",
+		"=?utf-8?X?abc?=":            "=?utf-8?X?abc?=",
+		"=?x-unknown?B?5L2g5aW9?=":   "你好",
+	}
+	for raw, value := range cases {
+		assert.Equal(t, mailfile.DecodeHeader(raw).Value, value, raw)
+	}
+
+	res := mailfile.DecodeHeader("=?UTF-8*en?Q?Hello?=")
+	assert.Equal(t, res.Raw, "=?UTF-8*en?Q?Hello?=")
+	assert.Equal(t, res.Charset, "utf-8")
+	assert.Equal(t, res.Language, "en")
+}
+
+func TestParseParams(t *testing.T) {
+	mediatype, params := mailfile.ParseParams(`attachment; ` +
+		`filename*0*=gbk'zh-cn'%C4%E3; filename*1*=%BA%C3; filename*2=".txt"; size=12`)
+	assert.Equal(t, mediatype, "attachment")
+	assert.Equal(t, params["filename"].Value, "你好.txt")
+	assert.Equal(t, params["filename"].Raw, "gbk'zh-cn'%C4%E3%BA%C3.txt")
+	assert.Equal(t, params["filename"].Charset, "gb18030")
+	assert.Equal(t, params["filename"].Language, "zh-cn")
+	assert.Equal(t, params["size"].Value, "12")
+
+	cases := map[string]string{
+		`text/plain; name*=utf-8''%E4%BD%A0%E5%A5%BD.txt`:      "你好.txt",
+		`text/plain; name="=?utf-8?B?5L2g5aW9LnR4dA==?="`:      "你好.txt",
+		`text/plain; name=report final.pdf`:                    "report final.pdf",
+		`text/plain; name="unterminated.pdf`:                   "unterminated.pdf",
+		`text/plain; name="a \"b\".txt"; charset=utf-8`:        `a "b".txt`,
+		`text/plain; name="plain.txt"; name*=utf-8''better`:    "better",
+		`=?utf-8?B?dGV4dC9wbGFpbjsgbmFtZT0i5L2g5aW9LnR4dCI=?=`: "你好.txt",
+	}
+	for raw, name := range cases {
+		mediatype, params := mailfile.ParseParams(raw)
+		assert.Equal(t, mediatype, "text/plain", raw)
+		assert.Equal(t, params["name"].Value, name, raw)
+	}
+}
+
+func TestParseEMLEncodedFilename(t *testing.T) {
+	raw := strings.Join([]string{
+		"From: =?gb2312?B?1cXI/Q==?= <zhangsan@example.com>",
+		"Subject: =?gb2312?B?uL28/g==?= =?utf-8?Q?_test?=",
+		`Content-Type: multipart/mixed; boundary="b"`,
+		"",
+		"--b",
+		"Content-Type: application/octet-stream",
+		"Content-Disposition: attachment;",
+		" filename*0*=utf-8''%E6%8A%A5%E5%91%8A;",
+		" filename*1*=%2Epdf",
+		"",
+		"data",
+		"--b--",
+		"",
+	}, "\r\n")
+
+	m, err := eml.ParseMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := m.Format()
+	assert.Equal(t, res.Subject, "附件 test")
+	assert.Equal(t, res.From[0].Name, "张三")
+	assert.Equal(t, len(res.Attachments), 1)
+	assert.Equal(t, res.Attachments[0].Filename, "报告.pdf")
+}
+
+func TestParseEMLDecodedOnce(t *testing.T) {
+	// values that decode to a literal encoded-word
+	raw := strings.Join([]string{
+		"Subject: =?utf-8?Q?=3D=3Futf-8=3FB=3FSGk=3D=3F=3D?=",
+		`Content-Type: multipart/mixed; boundary="b"`,
+		"",
+		"--b",
+		"Content-Type: application/octet-stream",
+		"Content-Disposition: attachment; filename*=utf-8''%3D%3Futf-8%3FB%3FSGk%3D%3F%3D",
+		"",
+		"data",
+		"--b--",
+		"",
+	}, "\r\n")
+
+	m, err := eml.ParseMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := m.Format()
+	assert.Equal(t, res.Subject, "=?utf-8?B?SGk=?=")
+	if assert.Equal(t, len(res.Attachments), 1) {
+		assert.Equal(t, res.Attachments[0].Filename, "=?utf-8?B?SGk=?=")
+	}
+}
@@ -0,0 +1,80 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mel2oo/mailfile/eml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteEMLUnmodified(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := eml.New(file)
+		if err != nil {
+			continue
+		}
+		data, err := m.Bytes()
+		assert.Nil(t, err, file)
+		assert.Equal(t, string(raw), string(data), file)
+	}
+}
+
+func TestWriteEMLEdited(t *testing.T) {
+	text := "Content-Type: text/plain; charset=utf-8\n" +
+		"Content-Transfer-Encoding: quoted-printable\n\n" +
+		"caf=C3=A9 =\nau lait\n"
+	attachment := "Content-Type: application/octet-stream\n" +
+		"Content-Disposition: attachment; filename=a.bin\n" +
+		"Content-Transfer-Encoding: base64\n\n" +
+		"AAEC\n"
+	raw := "\n" +
+		"From: a@example.com\n" +
+		"Subject:  kept   as is\n" +
+		"X-Tag: 1\n" +
+		"Content-Type: multipart/mixed; boundary=b\n\n" +
+		"preamble\n--b\n" + text + "--b\n" + attachment + "--b--\nepilogue\n"
+
+	m, err := eml.ParseMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := m.Bytes()
+	assert.Nil(t, err)
+	assert.Equal(t, raw, string(data))
+
+	// removing a part keeps the others as read
+	m.Parts = m.Parts[:1]
+	data, err = m.Bytes()
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "Subject:  kept   as is\n")
+	assert.Contains(t, string(data), "\r\n--b\r\n"+strings.TrimSuffix(text, "\n")+"\r\n--b--\r\n")
+	assert.NotContains(t, string(data), "AAEC")
+
+	// editing a header field keeps its place and the other fields as read
+	m, _ = eml.ParseMessage(strings.NewReader(raw))
+	m.Header.Set("X-Tag", "2")
+	data, err = m.Bytes()
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Replace(raw[1:], "X-Tag: 1\n", "X-Tag: 2\r\n", 1), string(data[1:]))
+
+	// editing a body encodes it again, the other part is kept as read
+	m, _ = eml.ParseMessage(strings.NewReader(raw))
+	m.Parts[1].Body = []byte{3, 4, 5}
+	data, err = m.Bytes()
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "--b\n"+text+"--b\n")
+	assert.Contains(t, string(data), "Content-Disposition: attachment; filename=a.bin\n"+
+		"Content-Transfer-Encoding: base64\r\n\r\nAwQF\n--b--\nepilogue\n")
+}
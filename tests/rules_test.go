@@ -0,0 +1,310 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/mel2oo/mailfile/msg"
+	"github.com/mel2oo/mailfile/rules"
+	"github.com/stretchr/testify/assert"
+)
+
+type ruleWriter struct {
+	bytes.Buffer
+}
+
+func (w *ruleWriter) u8(v uint8)   { w.WriteByte(v) }
+func (w *ruleWriter) u16(v uint16) { binary.Write(w, binary.LittleEndian, v) }
+func (w *ruleWriter) u32(v uint32) { binary.Write(w, binary.LittleEndian, v) }
+
+func (w *ruleWriter) utf16(s string, terminate bool) {
+	for _, c := range utf16.Encode([]rune(s)) {
+		w.u16(c)
+	}
+	if terminate {
+		w.u16(0)
+	}
+}
+
+func (w *ruleWriter) cstring(s string) {
+	w.Write([]byte{0xFF, 0xFE, 0xFF, byte(len(s))})
+	w.utf16(s, false)
+}
+
+// compoundFile writes a version 3 compound file holding streams of less than
+// 4096 bytes, all in the root storage and the mini stream, in order.
+func compoundFile(names []string, streams map[string][]byte) []byte {
+	const (
+		free       = 0xFFFFFFFF
+		endOfChain = 0xFFFFFFFE
+		fatSect    = 0xFFFFFFFD
+	)
+
+	// mini stream, 64 byte sectors
+	mini, miniFAT := &ruleWriter{}, &ruleWriter{}
+	starts := make([]uint32, len(names))
+	for i, name := range names {
+		data := streams[name]
+		starts[i] = uint32(mini.Len() / 64)
+		mini.Write(data)
+		mini.Write(make([]byte, (64-len(data)%64)%64))
+		for n := uint32(len(data)+63) / 64; n > 0; n-- {
+			if n == 1 {
+				miniFAT.u32(endOfChain)
+			} else {
+				miniFAT.u32(uint32(miniFAT.Len()/4) + 1)
+			}
+		}
+	}
+
+	// directory, 4 entries per sector: the root then the streams as right
+	// siblings of each other
+	dir := &ruleWriter{}
+	entry := func(name string, kind uint8, child, right, start uint32, size int) {
+		var field [64]byte
+		for i, c := range utf16.Encode([]rune(name)) {
+			binary.LittleEndian.PutUint16(field[i*2:], c)
+		}
+		dir.Write(field[:])
+		dir.u16(uint16(len(utf16.Encode([]rune(name)))*2 + 2))
+		dir.u8(kind)
+		dir.u8(1)
+		dir.u32(free)
+		dir.u32(right)
+		dir.u32(child)
+		dir.Write(make([]byte, 36))
+		dir.u32(start)
+		dir.u32(uint32(size))
+		dir.u32(0)
+	}
+
+	// sectors: FAT, directory, mini FAT, mini stream
+	sectors := func(n int) int { return (n + 511) / 512 }
+	dirSectors := sectors((len(names) + 1) * 128)
+	miniFATSectors := sectors(miniFAT.Len())
+	miniSectors := sectors(mini.Len())
+	firstMini := uint32(1 + dirSectors + miniFATSectors)
+
+	entry("Root Entry", 5, 1, free, firstMini, mini.Len())
+	for i, name := range names {
+		right := uint32(i + 2)
+		if i == len(names)-1 {
+			right = free
+		}
+		entry(name, 2, free, right, starts[i], len(streams[name]))
+	}
+	for dir.Len()%512 != 0 {
+		entry("", 0, free, free, 0, 0)
+	}
+
+	fat := &ruleWriter{}
+	fat.u32(fatSect)
+	for _, n := range []int{dirSectors, miniFATSectors, miniSectors} {
+		for ; n > 0; n-- {
+			if n == 1 {
+				fat.u32(endOfChain)
+			} else {
+				fat.u32(uint32(fat.Len()/4) + 1)
+			}
+		}
+	}
+	for fat.Len() < 512 {
+		fat.u32(free)
+	}
+
+	w := &ruleWriter{}
+	w.Write([]byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1})
+	w.Write(make([]byte, 16))
+	w.u16(0x3E)
+	w.u16(3)
+	w.u16(0xFFFE)
+	w.u16(9)
+	w.u16(6)
+	w.Write(make([]byte, 10))
+	w.u32(1)
+	w.u32(1)
+	w.u32(0)
+	w.u32(4096)
+	w.u32(uint32(1 + dirSectors))
+	w.u32(uint32(miniFATSectors))
+	w.u32(endOfChain)
+	w.u32(0)
+	w.u32(0)
+	for w.Len() < 512 {
+		w.u32(free)
+	}
+	w.Write(fat.Bytes())
+	w.Write(dir.Bytes())
+	for _, data := range [][]byte{miniFAT.Bytes(), mini.Bytes()} {
+		w.Write(data)
+		w.Write(make([]byte, (512-len(data)%512)%512))
+	}
+	return w.Bytes()
+}
+
+func TestParseServerRule(t *testing.T) {
+	// subject contains "invoice" (ignore case)
+	cond := &ruleWriter{}
+	cond.u8(rules.RES_CONTENT)
+	cond.u16(0x0001)
+	cond.u16(0x0001)
+	cond.u32(0x0037001F)
+	cond.u32(0x0037001F)
+	cond.utf16("invoice", true)
+
+	// redirect to attacker@evil.example, then delete
+	act := &ruleWriter{}
+	block := &ruleWriter{}
+	block.u8(rules.OP_FORWARD)
+	block.u32(rules.FWD_PRESERVE | rules.FWD_DO_NOT_MUNGE)
+	block.u32(0)
+	block.u16(1)
+	block.u8(1)
+	block.u16(2)
+	block.u32(0x3001001F)
+	block.utf16("Mallory", true)
+	block.u32(0x39FE001F)
+	block.utf16("attacker@evil.example", true)
+	act.u16(2)
+	act.u16(uint16(block.Len()))
+	act.Write(block.Bytes())
+	act.u16(9)
+	act.u8(rules.OP_DELETE)
+	act.u32(0)
+	act.u32(0)
+
+	rule, err := rules.ParseServerRule(".", rules.ST_ENABLED, cond.Bytes(), act.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, rule.Enabled)
+	assert.Equal(t, rule.Condition.Property, "Subject")
+	assert.Equal(t, rule.Condition.Operator, "contains (ignore case)")
+	assert.Equal(t, rule.Condition.Value, "invoice")
+	if assert.Equal(t, len(rule.Actions), 2) {
+		assert.Equal(t, rule.Actions[0].Type, rules.ActionRedirect)
+		assert.Equal(t, rule.Actions[0].Recipients[0].Address, "attacker@evil.example")
+		assert.Equal(t, rule.Actions[1].Type, rules.ActionDelete)
+	}
+	assert.True(t, rule.Suspicious())
+}
+
+func TestParseRWZ(t *testing.T) {
+	w := &ruleWriter{}
+	w.Write([]byte("header"))
+	// rule object, class defined on first use
+	w.u16(0xFFFF)
+	w.u16(1)
+	w.u16(uint16(len("CRuleElement")))
+	w.WriteString("CRuleElement")
+	w.u32(rules.ST_ENABLED)
+	w.cstring("Clean up")
+	// action element of a second class
+	w.u16(0xFFFF)
+	w.u16(1)
+	w.u16(uint16(len("CActionElement")))
+	w.WriteString("CActionElement")
+	w.u32(0x0000012C)
+	w.cstring("Project1.ThisOutlookSession.Exfiltrate")
+	// second rule, referencing the rule class
+	w.u16(0x8001)
+	w.u32(0)
+	w.cstring("Disabled rule")
+	// element of an unknown kind carrying an address
+	w.u16(0x8003)
+	w.u32(0x000001F4)
+	w.cstring("SMTP:attacker@evil.example")
+
+	list, err := rules.ParseRWZ(w.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Equal(t, len(list), 2) {
+		return
+	}
+
+	assert.Equal(t, list[0].Name, "Clean up")
+	assert.True(t, list[0].Enabled)
+	assert.True(t, list[0].ClientOnly)
+	assert.Equal(t, list[0].Elements[0].ID, uint32(0x12C))
+	if assert.Equal(t, len(list[0].Actions), 1) {
+		assert.Equal(t, list[0].Actions[0].Type, rules.ActionRunScript)
+		assert.Equal(t, list[0].Actions[0].Script, "Project1.ThisOutlookSession.Exfiltrate")
+	}
+	assert.Equal(t, list[1].Name, "Disabled rule")
+	assert.False(t, list[1].Enabled)
+	if assert.Equal(t, len(list[1].Actions), 1) {
+		assert.Equal(t, list[1].Elements[0].Kind, "")
+		assert.Equal(t, list[1].Actions[0].Type, rules.ActionForward)
+		assert.True(t, list[1].Actions[0].Candidate)
+		assert.Equal(t, list[1].Actions[0].Recipients[0].Address, "attacker@evil.example")
+	}
+	assert.True(t, list[1].Suspicious())
+}
+
+func TestRulesFromMSG(t *testing.T) {
+	// forward to attacker@evil.example, MS-OXORULE 2.2.4
+	block := &ruleWriter{}
+	block.u8(rules.OP_FORWARD)
+	block.u32(0)
+	block.u32(0)
+	block.u32(1)
+	block.u8(1)
+	block.u32(1)
+	block.u32(0x39FE001F)
+	block.utf16("attacker@evil.example", true)
+	act := &ruleWriter{}
+	act.u16(0)
+	act.u32(1)
+	act.u32(1)
+	act.u32(uint32(block.Len()))
+	act.Write(block.Bytes())
+
+	name := &ruleWriter{}
+	name.utf16("Forward everything", false)
+
+	// RuleMessageState is a fixed length property, after the 32 byte header
+	props := &ruleWriter{}
+	props.Write(make([]byte, 32))
+	props.u32(0x65E90003)
+	props.u32(0x00000002)
+	props.u32(rules.ST_ENABLED)
+	props.u32(0)
+
+	names := []string{"__substg1.0_65EC001F", "__substg1.0_0E990102", "__properties_version1.0"}
+	file := filepath.Join(t.TempDir(), "rule.msg")
+	err := os.WriteFile(file, compoundFile(names, map[string][]byte{
+		names[0]: name.Bytes(),
+		names[1]: act.Bytes(),
+		names[2]: props.Bytes(),
+	}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := msg.New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := rules.FromMSG(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Equal(t, len(list), 1) {
+		return
+	}
+
+	assert.Equal(t, list[0].Name, "Forward everything")
+	assert.Equal(t, list[0].State, uint32(rules.ST_ENABLED))
+	assert.True(t, list[0].Enabled)
+	if assert.Equal(t, len(list[0].Actions), 1) {
+		assert.Equal(t, list[0].Actions[0].Type, rules.ActionForward)
+		assert.Equal(t, list[0].Actions[0].Recipients[0].Address, "attacker@evil.example")
+	}
+	assert.True(t, list[0].Suspicious())
+}
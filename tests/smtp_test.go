@@ -0,0 +1,157 @@
+package test
+
+import (
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/mel2oo/mailfile/eml"
+	"github.com/mel2oo/mailfile/smtp"
+	"github.com/stretchr/testify/assert"
+)
+
+// smtpSession is what the stand-in server received.
+type smtpSession struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// serveSMTP accepts one session on a local port, offering extensions and
+// refusing the recipients in refuse.
+func serveSMTP(t *testing.T, extensions []string, refuse map[string]bool) (string, chan *smtpSession) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan *smtpSession, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		session := &smtpSession{}
+		defer func() { done <- session }()
+
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO":
+				lines := append([]string{"localhost"}, extensions...)
+				for i, ext := range lines {
+					sep := "-"
+					if i == len(lines)-1 {
+						sep = " "
+					}
+					tp.PrintfLine("250%s%s", sep, ext)
+				}
+			case "AUTH":
+				if strings.HasPrefix(arg, "LOGIN") {
+					tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Username:")))
+					user, _ := tp.ReadLine()
+					tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Password:")))
+					pass, _ := tp.ReadLine()
+					u, _ := base64.StdEncoding.DecodeString(user)
+					p, _ := base64.StdEncoding.DecodeString(pass)
+					session.auth = "LOGIN " + string(u) + ":" + string(p)
+				} else {
+					session.auth = arg
+				}
+				tp.PrintfLine("235 ok")
+			case "MAIL":
+				session.from = arg
+				tp.PrintfLine("250 ok")
+			case "RCPT":
+				rcpt := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+				if refuse[rcpt] {
+					tp.PrintfLine("550 no such user")
+					continue
+				}
+				session.to = append(session.to, rcpt)
+				tp.PrintfLine("250 ok")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				data, _ := tp.ReadDotBytes()
+				session.data = string(data)
+				tp.PrintfLine("250 queued")
+			case "RSET":
+				tp.PrintfLine("250 ok")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("502 unknown")
+			}
+		}
+	}()
+	return l.Addr().String(), done
+}
+
+func TestSMTPSend(t *testing.T) {
+	raw := "From: Alice <alice@example.com>\r\n" +
+		"To: bob@example.com, nobody@example.com\r\n" +
+		"Bcc: hidden@example.com\r\n" +
+		"Subject: caf\xc3\xa9\r\n\r\nhello\r\n"
+	m, err := eml.ParseMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from, to, err := smtp.Envelope(m)
+	assert.Nil(t, err)
+	assert.Equal(t, from, "alice@example.com")
+	assert.Equal(t, to, []string{"bob@example.com", "nobody@example.com", "hidden@example.com"})
+
+	addr, done := serveSMTP(t, []string{"8BITMIME", "AUTH LOGIN"}, map[string]bool{"nobody@example.com": true})
+	s := &smtp.Sender{Addr: addr, Security: smtp.Plaintext, Username: "alice", Password: "secret"}
+	err = s.Send(m)
+	session := <-done
+
+	var sendErr *smtp.SendError
+	assert.True(t, errors.As(err, &sendErr))
+	assert.True(t, sendErr.Sent)
+	assert.Equal(t, len(sendErr.Recipients), 1)
+	assert.Equal(t, sendErr.Recipients[0].Recipient, "nobody@example.com")
+
+	assert.Equal(t, session.auth, "LOGIN alice:secret")
+	assert.Equal(t, session.from, "FROM:<alice@example.com> BODY=8BITMIME")
+	assert.Equal(t, session.to, []string{"bob@example.com", "hidden@example.com"})
+	// the stand-in reads lines ending with LF
+	sent := strings.Replace(raw, "Bcc: hidden@example.com\r\n", "", 1)
+	assert.Equal(t, session.data, strings.ReplaceAll(sent, "\r\n", "\n"))
+}
+
+func TestSMTPSendRefused(t *testing.T) {
+	m, err := eml.NewBuilder().From("alice@example.com").To("bob@example.com").Text([]byte("caf\xc3\xa9")).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr, done := serveSMTP(t, []string{"AUTH PLAIN"}, map[string]bool{"bob@example.com": true})
+	s := &smtp.Sender{Addr: addr, Security: smtp.StartTLS}
+	assert.Equal(t, s.Send(m), smtp.ErrNoSTARTTLS)
+	<-done
+
+	addr, done = serveSMTP(t, []string{"AUTH PLAIN"}, map[string]bool{"bob@example.com": true})
+	s = &smtp.Sender{Addr: addr, Username: "alice", Password: "secret"}
+	err = s.Send(m)
+	session := <-done
+
+	var sendErr *smtp.SendError
+	assert.True(t, errors.As(err, &sendErr))
+	assert.False(t, sendErr.Sent)
+	assert.Equal(t, session.auth, "PLAIN "+base64.StdEncoding.EncodeToString([]byte("\x00alice\x00secret")))
+	assert.Equal(t, session.data, "")
+}
@@ -0,0 +1,113 @@
+package test
+
+import (
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/mel2oo/mailfile"
+	"github.com/mel2oo/mailfile/spf"
+	"github.com/stretchr/testify/assert"
+)
+
+const spfZone = `
+; the examples of RFC 7208, appendix A
+example.com.          TXT  "v=spf1 +mx a:colo.example.com/28 include:out.example.net -all"
+example.com.          MX   10 mail-a.example.com.
+example.com.          MX   20 mail-b.example.com.
+example.com.          A    192.0.2.10
+mail-a.example.com.   A    192.0.2.129
+mail-b.example.com.   A    192.0.2.130
+colo.example.com.     A    192.0.2.140
+out.example.net.      3600 IN TXT "v=spf1 ip4:198.51.100.0/24 ip6:2001:db8::/32 ?all"
+redirect.example.org. TXT  "v=spf1 redirect=example.com"
+exists.example.org.   TXT  "v=spf1 exists:%{ir}.%{l1r+-}._spf.%{d} -all exp=explain.%{d}"
+explain.exists.example.org. TXT "%{i} is not one of %{d}'s designated mail servers."
+1.2.0.192.jdoe._spf.exists.example.org. A 127.0.0.2
+soft.example.org.     TXT  "v=spf1 ~all"
+twice.example.org.    TXT  "v=spf1 -all"
+twice.example.org.    TXT  "v=spf1 +all"
+void.example.org.     TXT  "v=spf1 a:none1.example.org a:none2.example.org a:none3.example.org +all"
+loop.example.org.     TXT  "v=spf1 include:loop.example.org -all"
+bad.example.org.      TXT  "v=spf1 ip4:300.0.0.1 -all"
+`
+
+func spfResolver(t *testing.T) *spf.Zone {
+	zone, err := spf.ParseZone(strings.NewReader(spfZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zone
+}
+
+func TestSPFCheck(t *testing.T) {
+	zone := spfResolver(t)
+
+	cases := []struct {
+		ip, sender string
+		result     spf.Result
+		mechanism  string
+	}{
+		{"192.0.2.129", "user@example.com", spf.Pass, "+mx"},
+		{"192.0.2.142", "user@example.com", spf.Pass, "a:colo.example.com/28"},
+		{"198.51.100.7", "user@example.com", spf.Pass, "include:out.example.net"},
+		{"2001:db8::1", "user@example.com", spf.Pass, "include:out.example.net"},
+		{"203.0.113.1", "user@example.com", spf.Fail, "-all"},
+		{"192.0.2.130", "<user@redirect.example.org>", spf.Pass, "+mx"},
+		{"192.0.2.1", "jdoe@exists.example.org", spf.Pass, "exists:%{ir}.%{l1r+-}._spf.%{d}"},
+		{"203.0.113.1", "user@soft.example.org", spf.SoftFail, "~all"},
+		{"203.0.113.1", "user@twice.example.org", spf.PermError, ""},
+		{"203.0.113.1", "user@void.example.org", spf.PermError, ""},
+		{"203.0.113.1", "user@loop.example.org", spf.PermError, ""},
+		{"203.0.113.1", "user@bad.example.org", spf.PermError, ""},
+		{"203.0.113.1", "user@unknown.example.org", spf.None, ""},
+	}
+	for _, c := range cases {
+		o := spf.Check(net.ParseIP(c.ip), c.sender, "mx.example.net", zone)
+		assert.Equal(t, c.result, o.Result, c.sender+" from "+c.ip)
+		assert.Equal(t, c.mechanism, o.Mechanism, c.sender+" from "+c.ip)
+	}
+
+	o := spf.Check(net.ParseIP("192.0.2.129"), "user@redirect.example.org", "", zone)
+	assert.Equal(t, "example.com", o.Domain)
+
+	o = spf.Check(net.ParseIP("203.0.113.1"), "user@loop.example.org", "", zone)
+	assert.Greater(t, o.Lookups, spf.MaxLookups)
+
+	o = spf.Check(net.ParseIP("192.0.2.2"), "jdoe@exists.example.org", "", zone)
+	assert.Equal(t, spf.Fail, o.Result)
+	assert.Equal(t, "192.0.2.2 is not one of exists.example.org's designated mail servers.", o.Explanation)
+
+	// a null sender is checked at the HELO name
+	o = spf.Check(net.ParseIP("192.0.2.129"), "<>", "example.com", zone)
+	assert.Equal(t, spf.Pass, o.Result)
+	assert.Equal(t, "postmaster@example.com", o.Sender)
+}
+
+func TestSPFCheckMessage(t *testing.T) {
+	msg := &mailfile.Message{Headers: mail.Header{
+		"Received": []string{
+			"by mx.example.net with ESMTP id 1234; Fri, 11 Jul 2003 21:01:54 -0700",
+			"from mail-a.example.com (mail-a.example.com [192.0.2.129]) by mx.example.net; Fri, 11 Jul 2003 21:01:53 -0700",
+		},
+		"Return-Path": []string{"<user@example.com>"},
+	}}
+
+	o := spf.CheckMessage(msg, spfResolver(t))
+	assert.Equal(t, spf.Pass, o.Result)
+	assert.Equal(t, "mail-a.example.com", o.Helo)
+	if assert.Len(t, msg.Auth, 1) {
+		assert.Equal(t, "spf", msg.Auth[0].Method)
+		assert.Equal(t, "pass", msg.Auth[0].Result)
+		assert.Equal(t, "user@example.com", msg.Auth[0].Properties["smtp.mailfrom"])
+		assert.Equal(t, "192.0.2.129", msg.Auth[0].Properties["client-ip"])
+	}
+}
+
+func TestUnquoteTXT(t *testing.T) {
+	assert.Equal(t, "v=spf1 -all", mailfile.UnquoteTXT(`v=spf1 -all`))
+	assert.Equal(t, "v=DKIM1; p=abc", mailfile.UnquoteTXT(`"v=DKIM1; " "p=abc"`))
+	assert.Equal(t, `say "hi"`, mailfile.UnquoteTXT(`"say \"hi\""`))
+	assert.Equal(t, "open", mailfile.UnquoteTXT(`"open`))
+}
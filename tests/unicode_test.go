@@ -0,0 +1,88 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mel2oo/mailfile/analyze"
+	"github.com/mel2oo/mailfile/eml"
+	"github.com/mel2oo/mailfile/msg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnicodeInspect(t *testing.T) {
+	in := analyze.Inspect("invoice\u202efdp.exe")
+	assert.Equal(t, "invoiceexe.pdf", in.Rendered)
+	if assert.Len(t, in.Tricks, 1) {
+		assert.Equal(t, analyze.Trick{Kind: analyze.TrickBidiControl, Position: 7, Length: 1, Text: "U+202E", Name: "RIGHT-TO-LEFT OVERRIDE"}, in.Tricks[0])
+	}
+
+	// the override ends at its PDF, and nests
+	assert.Equal(t, "a cba d", analyze.Inspect("a \u202eabc\u202c d").Rendered)
+	assert.Equal(t, "x defcba", analyze.Inspect("x \u202eabc\u202ddef").Rendered)
+
+	in = analyze.Inspect("Pay\u200b\u200bPal account")
+	assert.Equal(t, "PayPal account", in.Rendered)
+	if assert.Len(t, in.Tricks, 1) {
+		assert.Equal(t, analyze.TrickInvisible, in.Tricks[0].Kind)
+		assert.Equal(t, 3, in.Tricks[0].Position)
+		assert.Equal(t, "U+200B U+200B", in.Tricks[0].Text)
+	}
+
+	in = analyze.Inspect("Рayment notice")
+	assert.Equal(t, "payment notice", in.Skeleton)
+	if assert.Len(t, in.Tricks, 1) {
+		assert.Equal(t, analyze.Trick{Kind: analyze.TrickMixedScript, Position: 0, Length: 7, Text: "Рayment", Name: "Cyrillic, Latin"}, in.Tricks[0])
+	}
+
+	in = analyze.Inspect("line\u2028break")
+	if assert.Len(t, in.Tricks, 1) {
+		assert.Equal(t, analyze.TrickSeparator, in.Tricks[0].Kind)
+	}
+
+	// emoji sequences, right-to-left marks and CJK mixed with Latin are not tricks
+	for _, s := range []string{"👨\u200d👩\u200d👧 family", "שלום\u200f world", "Office365文件", "Привет мир", "▶🔘─────.htm"} {
+		assert.Empty(t, analyze.Inspect(s).Tricks, s)
+	}
+}
+
+func TestUnicodeInspections(t *testing.T) {
+	m, err := eml.ParseMessage(strings.NewReader("From: =?utf-8?B?0KBheVBhbCBTdXBwb3J0?= <support@example.com>\r\n" +
+		"Subject: Invoice\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"See attached\r\n" +
+		"--b\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename*=utf-8''invoice%E2%80%AEfdp.exe\r\n" +
+		"\r\n" +
+		"MZ\r\n" +
+		"--b--\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inspections := analyze.Inspections(m.Format())
+	if assert.Len(t, inspections, 2) {
+		assert.Equal(t, "from", inspections[0].Field)
+		assert.Equal(t, "paypal support", inspections[0].Skeleton)
+		assert.Equal(t, "attachment", inspections[1].Field)
+		assert.Equal(t, "invoiceexe.pdf", inspections[1].Rendered)
+	}
+
+	codes := findingCodes(analyze.Message(m.Format(), nil))
+	assert.Equal(t, analyze.High, codes[analyze.CodeBidiControl].Severity)
+	assert.Equal(t, ".exe", codes[analyze.CodeBidiControl].Evidence["extension"])
+	assert.Equal(t, "7", codes[analyze.CodeBidiControl].Evidence["positions"])
+	assert.Equal(t, analyze.Medium, codes[analyze.CodeMixedScript].Severity)
+
+	// TestParseMSG3's filename is drawn with symbols, not tricks
+	res, err := msg.New("testdata/5499732e4b2d8f6da3f053e086ee479f.msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, analyze.Inspections(res.Format()))
+}
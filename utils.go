@@ -9,90 +9,26 @@ import (
 	"regexp"
 	"strings"
 
-	"github.com/axgle/mahonia"
-	"github.com/djimenez/iconv-go"
+	"github.com/mel2oo/mailfile/charset"
 )
 
-// 解析 带有 =?utf-8?B?bWxlbW9z?= 格式字符串
+// 解析 带有 =?utf-8?B?bWxlbW9z?= 格式字符串，见 DecodeHeader
 func ParseContext(data string) string {
-	bindex := strings.Index(data, "=?")
-	if bindex == -1 {
-		return data
-	}
-
-	eindex := strings.Index(data[bindex:], "?=")
-	if eindex == -1 {
-		return data
-	}
-
-	if bindex+eindex+2 > len(data) {
-		return data
-	}
-
-	prefix := data[:bindex]
-	decode := ParseTitle(data[bindex : bindex+eindex+2])
-	suffix := ParseContext(data[bindex+eindex+2:])
-	return strings.TrimSpace(prefix) + strings.TrimSpace(decode) + strings.TrimSpace(suffix)
+	return DecodeHeader(data).Value
 }
 
+// ParseFrom 解析地址列表，见 ParseAddressList，没有解析出地址时返回错误
 func ParseFrom(from string) ([]*mail.Address, error) {
-	if !strings.HasPrefix(from, "=?") {
-		return mail.ParseAddressList(from)
+	addrs, rest := ParseAddressList(from)
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("mail: no address in %q", rest)
 	}
-	idx := strings.LastIndex(from, "?=")
-	if idx == -1 {
-		return mail.ParseAddressList(from)
-	}
-
-	name := ParseTitle(from[:idx+2])
-	from = name + from[idx+2:]
-	return mail.ParseAddressList(from)
+	return addrs, nil
 }
 
+// ParseTitle 解码主题，见 DecodeHeader
 func ParseTitle(subject string) string {
-	if strings.Count(subject, "?=") > 1 && len(strings.Split(subject, " ")) > 1 { // 有多个 =?[]?[]?[]?= 格式字符串
-		var r strings.Builder
-		subjects := strings.Split(subject, " ")
-		for _, s := range subjects {
-			s = ParseTitle(strings.TrimSpace(s))
-			r.WriteString(s)
-		}
-
-		return r.String()
-	}
-
-	if !strings.HasPrefix(subject, "=?") {
-		return subject
-	}
-	if len(subject)-2 <= 2 {
-		return subject
-	}
-	title := subject[2 : len(subject)-2]
-	lists := strings.SplitN(title, "?", 3)
-	if len(lists) != 3 {
-		return subject
-	}
-
-	var charset string
-	if lists[1] == "b" || lists[1] == "B" {
-		charset = "base64"
-	} else if lists[1] == "q" || lists[1] == "Q" {
-		charset = "quoted-printable"
-	} else {
-		return subject
-	}
-
-	texts, err := DecodeString(lists[2], charset)
-	if err != nil {
-		return subject
-	}
-
-	retstr, err := ConvertData(texts, lists[0])
-	if err == nil {
-		return retstr
-	}
-
-	return subject
+	return DecodeHeader(subject).Value
 }
 
 func DecodeString(str string, etype string) ([]byte, error) {
@@ -110,31 +46,9 @@ func DecodeString(str string, etype string) ([]byte, error) {
 	}
 }
 
-func ConvertData(data []byte, charset string) (string, error) {
-	charset = strings.ToLower(charset)
-	switch strings.ToLower(charset) {
-	case "utf-8", "utf8":
-		return string(data), nil
-	default:
-		data, err := iconv.ConvertString(string(data), charset, "utf-8")
-		if err == nil {
-			return data, err
-		}
-
-		decoder1 := mahonia.NewDecoder(charset)
-		if decoder1 == nil {
-			return string(data), fmt.Errorf("not found decode %s", charset)
-		}
-
-		decoder2 := mahonia.NewDecoder("utf-8")
-		if decoder2 == nil {
-			return string(data), fmt.Errorf("not found decode %s", charset)
-		}
-
-		_, cdata, err := decoder2.Translate([]byte(
-			decoder1.ConvertString(string(data))), true)
-		return string(cdata), err
-	}
+// ConvertData 将 charset 编码的数据转换为 UTF-8 字符串，编码表见 charset.Lookup。
+func ConvertData(data []byte, name string) (string, error) {
+	return charset.Convert(data, name)
 }
 
 func ParsePasswd(html, text []byte) []string {
@@ -158,6 +72,30 @@ func ParsePasswd(html, text []byte) []string {
 	return res
 }
 
+// ExtractURLs 提取 html 和文本正文中的网址，去重并保持出现顺序
+func ExtractURLs(html, text []byte) []string {
+	seen := make(map[string]bool)
+	urls := make([]string, 0)
+	add := func(u string) {
+		u = strings.TrimRight(strings.TrimSpace(u), ".,;:!?)]}'\"")
+		if len(u) == 0 || seen[u] {
+			return
+		}
+		seen[u] = true
+		urls = append(urls, u)
+	}
+
+	for _, data := range [][]byte{html, text} {
+		for _, u := range expURL.FindAllString(string(data), -1) {
+			add(u)
+		}
+	}
+	return urls
+}
+
+// 网址，以协议或 www. 开头
+var expURL = regexp.MustCompile(`(?i)\b(?:(?:https?|ftp)://|www\.)[^\s"'<>()\[\]{}]+`)
+
 var (
 	expHtml = regexp.MustCompile(`<[\s\S]*?>`)
 	// ExpUnicode    = regexp.MustCompile(`&#\d+;`)
@@ -328,3 +266,31 @@ func ExtractPwd(data string, filter *map[string]bool) {
 		}
 	}
 }
+
+// UnquoteTXT 拼接区域文件中 TXT 记录的各个带引号的字符串，没有引号时原样返回
+func UnquoteTXT(s string) string {
+	if !strings.HasPrefix(s, `"`) {
+		return s
+	}
+	var b strings.Builder
+	for len(s) > 0 {
+		start := strings.IndexByte(s, '"')
+		if start < 0 {
+			break
+		}
+		s = s[start+1:]
+		end := 0
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' && end+1 < len(s) {
+				end++
+			}
+			end++
+		}
+		b.WriteString(strings.ReplaceAll(s[:end], `\"`, `"`))
+		if end < len(s) {
+			end++
+		}
+		s = s[end:]
+	}
+	return b.String()
+}